@@ -11,6 +11,10 @@ import (
 	"github.com/joshleeeeee/go-lite-auth/internal/config"
 	"github.com/joshleeeeee/go-lite-auth/internal/database"
 	"github.com/joshleeeeee/go-lite-auth/internal/router"
+	"github.com/joshleeeeee/go-lite-auth/internal/service"
+	"github.com/joshleeeeee/go-lite-auth/pkg/hasher"
+	"github.com/joshleeeeee/go-lite-auth/pkg/jwt"
+	"github.com/joshleeeeee/go-lite-auth/pkg/mailer"
 )
 
 func main() {
@@ -42,6 +46,35 @@ func main() {
 	}
 	defer database.CloseRedis()
 
+	// Load the token signing keys
+	if err := jwt.InitKeys(&cfg.JWT); err != nil {
+		log.Fatalf("Failed to load signing keys: %v", err)
+	}
+
+	// Initialize the mailer
+	if err := mailer.Init(&cfg.Mail); err != nil {
+		log.Fatalf("Failed to initialize mailer: %v", err)
+	}
+
+	// Load the key of email verification links
+	if err := service.InitEmailVerification(&cfg.Email); err != nil {
+		log.Fatalf("Failed to initialize email verification: %v", err)
+	}
+
+	// Select the password hashing algorithm
+	if err := hasher.Init(&cfg.Password.Hash); err != nil {
+		log.Fatalf("Failed to initialize password hashing: %v", err)
+	}
+
+	// Hash client secrets that are still stored in plaintext
+	hashed, err := service.MigrateClientSecrets()
+	if err != nil {
+		log.Fatalf("Failed to hash client secrets: %v", err)
+	}
+	if hashed > 0 {
+		log.Printf("Hashed %d plaintext client secrets", hashed)
+	}
+
 	// Setup router
 	r := router.Setup(cfg.Server.Mode)
 
@@ -9,14 +9,23 @@ import (
 )
 
 type Config struct {
-	Server   ServerConfig   `mapstructure:"server"`
-	Database DatabaseConfig `mapstructure:"database"`
-	MySQL    MySQLConfig    `mapstructure:"mysql"`
-	SQLite   SQLiteConfig   `mapstructure:"sqlite"`
-	Postgres PostgresConfig `mapstructure:"postgres"`
-	Redis    RedisConfig    `mapstructure:"redis"`
-	JWT      JWTConfig      `mapstructure:"jwt"`
-	Session  SessionConfig  `mapstructure:"session"`
+	Server       ServerConfig       `mapstructure:"server"`
+	Database     DatabaseConfig     `mapstructure:"database"`
+	MySQL        MySQLConfig        `mapstructure:"mysql"`
+	SQLite       SQLiteConfig       `mapstructure:"sqlite"`
+	Postgres     PostgresConfig     `mapstructure:"postgres"`
+	Redis        RedisConfig        `mapstructure:"redis"`
+	JWT          JWTConfig          `mapstructure:"jwt"`
+	Session      SessionConfig      `mapstructure:"session"`
+	SSO          SSOConfig          `mapstructure:"sso"`
+	OAuth        OAuthConfig        `mapstructure:"oauth"`
+	OIDC         OIDCConfig         `mapstructure:"oidc"`
+	Mail         MailConfig         `mapstructure:"mail"`
+	Password     PasswordConfig     `mapstructure:"password"`
+	Email        EmailConfig        `mapstructure:"email"`
+	MFA          MFAConfig          `mapstructure:"mfa"`
+	WebAuthn     WebAuthnConfig     `mapstructure:"webauthn"`
+	Passwordless PasswordlessConfig `mapstructure:"passwordless"`
 }
 
 type DatabaseConfig struct {
@@ -77,10 +86,14 @@ func (c *RedisConfig) Addr() string {
 }
 
 type JWTConfig struct {
-	Secret             string `mapstructure:"secret"`
-	AccessTokenExpire  int    `mapstructure:"access_token_expire"`
-	RefreshTokenExpire int    `mapstructure:"refresh_token_expire"`
-	Issuer             string `mapstructure:"issuer"`
+	Secret               string   `mapstructure:"secret"`
+	AccessTokenExpire    int      `mapstructure:"access_token_expire"`
+	RefreshTokenExpire   int      `mapstructure:"refresh_token_expire"`
+	Issuer               string   `mapstructure:"issuer"`
+	Algorithm            string   `mapstructure:"algorithm"`
+	SigningKeyFile       string   `mapstructure:"signing_key_file"`
+	VerificationKeyFiles []string `mapstructure:"verification_key_files"`
+	KeyRotationInterval  int      `mapstructure:"key_rotation_interval"`
 }
 
 func (c *JWTConfig) AccessTokenDuration() time.Duration {
@@ -91,6 +104,10 @@ func (c *JWTConfig) RefreshTokenDuration() time.Duration {
 	return time.Duration(c.RefreshTokenExpire) * time.Second
 }
 
+func (c *JWTConfig) KeyRotationDuration() time.Duration {
+	return time.Duration(c.KeyRotationInterval) * time.Second
+}
+
 type SessionConfig struct {
 	Expire int `mapstructure:"expire"`
 }
@@ -99,6 +116,194 @@ func (c *SessionConfig) ExpireDuration() time.Duration {
 	return time.Duration(c.Expire) * time.Second
 }
 
+type SSOConfig struct {
+	TGTExpire       int    `mapstructure:"tgt_expire"`
+	CookieName      string `mapstructure:"cookie_name"`
+	CookieDomain    string `mapstructure:"cookie_domain"`
+	CookieSecure    bool   `mapstructure:"cookie_secure"`
+	LogoutTimeout   int    `mapstructure:"logout_timeout"`
+	LogoutRetries   int    `mapstructure:"logout_retries"`
+	ProxyTimeout    int    `mapstructure:"proxy_callback_timeout"`
+	ServiceCacheTTL int    `mapstructure:"service_cache_ttl"`
+}
+
+func (c *SSOConfig) TGTExpireDuration() time.Duration {
+	return time.Duration(c.TGTExpire) * time.Second
+}
+
+// DefaultServiceCacheTTL is how long registered services are cached when sso.service_cache_ttl is unset
+const DefaultServiceCacheTTL = 30 * time.Second
+
+func (c *SSOConfig) ServiceCacheDuration() time.Duration {
+	if c.ServiceCacheTTL <= 0 {
+		return DefaultServiceCacheTTL
+	}
+	return time.Duration(c.ServiceCacheTTL) * time.Second
+}
+
+// Timeouts of requests to services when sso.logout_timeout / sso.proxy_callback_timeout are unset
+const (
+	DefaultLogoutTimeout = 5 * time.Second
+	DefaultProxyTimeout  = 5 * time.Second
+)
+
+func (c *SSOConfig) LogoutTimeoutDuration() time.Duration {
+	if c.LogoutTimeout <= 0 {
+		return DefaultLogoutTimeout
+	}
+	return time.Duration(c.LogoutTimeout) * time.Second
+}
+
+func (c *SSOConfig) ProxyTimeoutDuration() time.Duration {
+	if c.ProxyTimeout <= 0 {
+		return DefaultProxyTimeout
+	}
+	return time.Duration(c.ProxyTimeout) * time.Second
+}
+
+type OAuthConfig struct {
+	AuthCodeExpire     int `mapstructure:"auth_code_expire"`
+	DeviceCodeExpire   int `mapstructure:"device_code_expire"`
+	DevicePollInterval int `mapstructure:"device_poll_interval"`
+	ConsentExpire      int `mapstructure:"consent_expire"`
+}
+
+func (c *OAuthConfig) AuthCodeDuration() time.Duration {
+	return time.Duration(c.AuthCodeExpire) * time.Second
+}
+
+func (c *OAuthConfig) DeviceCodeDuration() time.Duration {
+	return time.Duration(c.DeviceCodeExpire) * time.Second
+}
+
+func (c *OAuthConfig) ConsentDuration() time.Duration {
+	return time.Duration(c.ConsentExpire) * time.Second
+}
+
+type OIDCConfig struct {
+	Issuer        string `mapstructure:"issuer"`
+	IDTokenExpire int    `mapstructure:"id_token_expire"`
+}
+
+func (c *OIDCConfig) IDTokenDuration() time.Duration {
+	return time.Duration(c.IDTokenExpire) * time.Second
+}
+
+type MailConfig struct {
+	Driver      string     `mapstructure:"driver"` // smtp or log
+	From        string     `mapstructure:"from"`
+	LogDir      string     `mapstructure:"log_dir"`
+	TemplateDir string     `mapstructure:"template_dir"`
+	SMTP        SMTPConfig `mapstructure:"smtp"`
+}
+
+type SMTPConfig struct {
+	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+}
+
+func (c *SMTPConfig) Addr() string {
+	return fmt.Sprintf("%s:%d", c.Host, c.Port)
+}
+
+type PasswordConfig struct {
+	ResetTokenExpire    int                `mapstructure:"reset_token_expire"`
+	ResetResendInterval int                `mapstructure:"reset_resend_interval"`
+	ResetURL            string             `mapstructure:"reset_url"`
+	Hash                PasswordHashConfig `mapstructure:"hash"`
+}
+
+type PasswordHashConfig struct {
+	Algorithm string         `mapstructure:"algorithm"` // argon2id, scrypt or bcrypt
+	Bcrypt    BcryptConfig   `mapstructure:"bcrypt"`
+	Argon2id  Argon2idConfig `mapstructure:"argon2id"`
+	Scrypt    ScryptConfig   `mapstructure:"scrypt"`
+}
+
+type BcryptConfig struct {
+	Cost int `mapstructure:"cost"`
+}
+
+type Argon2idConfig struct {
+	Memory      uint32 `mapstructure:"memory"` // KiB
+	Iterations  uint32 `mapstructure:"iterations"`
+	Parallelism uint8  `mapstructure:"parallelism"`
+}
+
+type ScryptConfig struct {
+	LN int `mapstructure:"ln"` // log2 of the CPU/memory cost N
+	R  int `mapstructure:"r"`
+	P  int `mapstructure:"p"`
+}
+
+func (c *PasswordConfig) ResetTokenDuration() time.Duration {
+	return time.Duration(c.ResetTokenExpire) * time.Second
+}
+
+func (c *PasswordConfig) ResetResendDuration() time.Duration {
+	return time.Duration(c.ResetResendInterval) * time.Second
+}
+
+type EmailConfig struct {
+	VerificationRequired bool   `mapstructure:"verification_required"`
+	VerifyLinkExpire     int    `mapstructure:"verify_link_expire"`
+	VerifyResendInterval int    `mapstructure:"verify_resend_interval"`
+	VerifyURL            string `mapstructure:"verify_url"`
+	VerifySecret         string `mapstructure:"verify_secret"`
+}
+
+func (c *EmailConfig) VerifyLinkDuration() time.Duration {
+	return time.Duration(c.VerifyLinkExpire) * time.Second
+}
+
+func (c *EmailConfig) VerifyResendDuration() time.Duration {
+	return time.Duration(c.VerifyResendInterval) * time.Second
+}
+
+type MFAConfig struct {
+	Issuer      string `mapstructure:"issuer"`
+	TokenExpire int    `mapstructure:"mfa_token_expire"`
+	TOTPSkew    int    `mapstructure:"totp_skew"`
+}
+
+func (c *MFAConfig) TokenDuration() time.Duration {
+	return time.Duration(c.TokenExpire) * time.Second
+}
+
+type WebAuthnConfig struct {
+	RPID            string   `mapstructure:"rp_id"`
+	RPDisplayName   string   `mapstructure:"rp_display_name"`
+	RPOrigins       []string `mapstructure:"rp_origins"`
+	ChallengeExpire int      `mapstructure:"challenge_expire"`
+}
+
+func (c *WebAuthnConfig) ChallengeDuration() time.Duration {
+	return time.Duration(c.ChallengeExpire) * time.Second
+}
+
+type PasswordlessConfig struct {
+	MagicLinkExpire   int    `mapstructure:"magic_link_expire"`
+	MagicLinkURL      string `mapstructure:"magic_link_url"`
+	OTPExpire         int    `mapstructure:"otp_expire"`
+	SendWindow        int    `mapstructure:"send_window"`
+	SendLimitPerEmail int    `mapstructure:"send_limit_per_email"`
+	SendLimitPerIP    int    `mapstructure:"send_limit_per_ip"`
+}
+
+func (c *PasswordlessConfig) MagicLinkDuration() time.Duration {
+	return time.Duration(c.MagicLinkExpire) * time.Second
+}
+
+func (c *PasswordlessConfig) OTPDuration() time.Duration {
+	return time.Duration(c.OTPExpire) * time.Second
+}
+
+func (c *PasswordlessConfig) SendWindowDuration() time.Duration {
+	return time.Duration(c.SendWindow) * time.Second
+}
+
 var GlobalConfig *Config
 
 // Load reads configuration from file, with optional local override
@@ -72,6 +72,14 @@ func AutoMigrate() error {
 	err := DB.AutoMigrate(
 		&model.User{},
 		&model.Client{},
+		&model.ClientServiceURI{},
+		&model.ClientScope{},
+		&model.UserGrant{},
+		&model.Role{},
+		&model.Permission{},
+		&model.UserTOTP{},
+		&model.RecoveryCode{},
+		&model.WebAuthnCredential{},
 	)
 	if err != nil {
 		return fmt.Errorf("failed to auto migrate: %w", err)
@@ -13,9 +13,91 @@ import (
 
 // TicketData stores ticket-related user and service information
 type TicketData struct {
-	UserID   uint   `json:"user_id"`
-	Username string `json:"username"`
-	Service  string `json:"service"`
+	UserID       uint     `json:"user_id"`
+	Username     string   `json:"username"`
+	Service      string   `json:"service"`
+	TGT          string   `json:"tgt,omitempty"`     // SSO session the ticket was issued under
+	Proxies      []string `json:"proxies,omitempty"` // proxy chain, most recent proxy first
+	FromNewLogin bool     `json:"from_new_login"`    // issued from primary credentials rather than a TGT
+}
+
+// TGTData stores the SSO session referenced by a Ticket-Granting Ticket
+type TGTData struct {
+	UserID    uint      `json:"user_id"`
+	Username  string    `json:"username"`
+	AMR       []string  `json:"amr,omitempty"` // authentication methods used to establish the session
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AuthCodeData stores an OAuth 2.0 authorization code grant
+type AuthCodeData struct {
+	ClientID            string    `json:"client_id"`
+	UserID              uint      `json:"user_id"`
+	Username            string    `json:"username"`
+	RedirectURI         string    `json:"redirect_uri"`
+	RedirectURIProvided bool      `json:"redirect_uri_provided,omitempty"` // the token request must then repeat redirect_uri
+	Scope               string    `json:"scope"`
+	CodeChallenge       string    `json:"code_challenge,omitempty"`
+	CodeChallengeMethod string    `json:"code_challenge_method,omitempty"`
+	Nonce               string    `json:"nonce,omitempty"`
+	AMR                 []string  `json:"amr,omitempty"`
+	AuthTime            time.Time `json:"auth_time"`
+}
+
+// ConsentData stores an authorization request waiting for the user's consent
+type ConsentData struct {
+	Code  AuthCodeData `json:"code"` // authorization code to issue once the user consents
+	State string       `json:"state,omitempty"`
+}
+
+// Device authorization states
+const (
+	DeviceStatusPending  = "pending"
+	DeviceStatusApproved = "approved"
+	DeviceStatusDenied   = "denied"
+)
+
+// DeviceCodeData stores an OAuth 2.0 device authorization request (RFC 8628)
+type DeviceCodeData struct {
+	ClientID string    `json:"client_id"`
+	Scope    string    `json:"scope"`
+	UserCode string    `json:"user_code"`
+	Interval int       `json:"interval"` // minimum seconds between polls
+	Status   string    `json:"status"`
+	UserID   uint      `json:"user_id,omitempty"`
+	Username string    `json:"username,omitempty"`
+	AMR      []string  `json:"amr,omitempty"`
+	AuthTime time.Time `json:"auth_time,omitempty"`
+}
+
+// MFAChallengeData stores a login that passed the first factor and waits for the second
+type MFAChallengeData struct {
+	UserID  uint     `json:"user_id"`
+	FailKey string   `json:"fail_key"`          // login-fail counter of the first factor, shared by the code check
+	Service string   `json:"service,omitempty"` // SSO service to issue a ticket for; empty for an API login
+	AMR     []string `json:"amr"`               // methods of the first factor
+}
+
+// WebAuthn ceremony purposes
+const (
+	WebAuthnRegistration = "registration"
+	WebAuthnLogin        = "login" // passwordless login with a passkey
+	WebAuthnMFA          = "mfa"   // passkey as the second factor of an mfa_token
+)
+
+// WebAuthnSessionData stores a WebAuthn ceremony until the browser returns the signed challenge
+type WebAuthnSessionData struct {
+	Purpose  string          `json:"purpose"`
+	UserID   uint            `json:"user_id,omitempty"`   // user registering a passkey, or completing an mfa_token
+	Service  string          `json:"service,omitempty"`   // SSO service to issue a ticket for after a passwordless login
+	MFAToken string          `json:"mfa_token,omitempty"` // login the passkey is the second factor of
+	Session  json.RawMessage `json:"session"`             // webauthn.SessionData
+}
+
+// PasswordlessData stores a magic link or email OTP waiting to be exchanged for a login
+type PasswordlessData struct {
+	UserID  uint   `json:"user_id"`
+	Service string `json:"service,omitempty"` // SSO service to issue a ticket for; empty for an API login
 }
 
 var RDB *redis.Client
@@ -42,11 +124,33 @@ func InitRedis(cfg *config.RedisConfig) error {
 
 // Redis key prefixes for different purposes
 const (
-	PrefixSession    = "session:"
-	PrefixBlacklist  = "blacklist:"
-	PrefixTicket     = "ticket:"
-	PrefixLoginFail  = "login_fail:"
-	PrefixRefreshToken = "refresh_token:"
+	PrefixSession        = "session:"
+	PrefixBlacklist      = "blacklist:"
+	PrefixTicket         = "ticket:"
+	PrefixTGT            = "tgt:"
+	PrefixTGTServices    = "tgt_services:"
+	PrefixPGT            = "pgt:"
+	PrefixAuthCode       = "auth_code:"
+	PrefixLoginFail      = "login_fail:"
+	PrefixRefreshToken   = "refresh_token:"
+	PrefixRevokedRefresh = "revoked_refresh:"
+	PrefixDeviceCode     = "device_code:"
+	PrefixUserCode       = "user_code:"
+	PrefixDevicePoll     = "device_poll:"
+	PrefixConsent        = "consent:"
+	PrefixUserFamilies   = "user_families:"
+	PrefixUserTGTs       = "user_tgts:"
+	PrefixPasswordReset  = "password_reset:"
+	PrefixResetSent      = "password_reset_sent:"
+	PrefixResetUser      = "password_reset_user:"
+	PrefixVerifySent     = "email_verify_sent:"
+	PrefixMFAToken       = "mfa_token:"
+	PrefixTOTPUsed       = "totp_used:"
+	PrefixWebAuthn       = "webauthn_session:"
+	PrefixMagicLink      = "magic_link:"
+	PrefixEmailOTP       = "email_otp:"
+	PrefixEmailOTPUser   = "email_otp_user:"
+	PrefixSendLimit      = "send_limit:"
 )
 
 // Session operations
@@ -77,6 +181,20 @@ func IsBlacklisted(ctx context.Context, tokenID string) (bool, error) {
 	return result > 0, nil
 }
 
+// RevokeRefreshLineage marks a revoked refresh token so that access tokens issued with it are rejected
+func RevokeRefreshLineage(ctx context.Context, refreshID string, expire time.Duration) error {
+	return RDB.Set(ctx, PrefixRevokedRefresh+refreshID, "1", expire).Err()
+}
+
+// AnyExists reports whether at least one of the keys exists, in a single round trip
+func AnyExists(ctx context.Context, keys ...string) (bool, error) {
+	result, err := RDB.Exists(ctx, keys...).Result()
+	if err != nil {
+		return false, err
+	}
+	return result > 0, nil
+}
+
 // SSO Ticket operations (one-time use with service validation)
 
 // SetTicketWithService stores a ticket with associated user and service data
@@ -104,6 +222,552 @@ func GetAndDeleteTicketData(ctx context.Context, ticketID string) (*TicketData,
 	return &data, nil
 }
 
+// SetProxyGrantingTicket stores a Proxy-Granting Ticket; unlike Service Tickets it may be used repeatedly
+func SetProxyGrantingTicket(ctx context.Context, pgtID string, data *TicketData, expire time.Duration) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal PGT data: %w", err)
+	}
+	return RDB.Set(ctx, PrefixPGT+pgtID, jsonData, expire).Err()
+}
+
+// GetProxyGrantingTicket retrieves the data of a Proxy-Granting Ticket
+func GetProxyGrantingTicket(ctx context.Context, pgtID string) (*TicketData, error) {
+	result, err := RDB.Get(ctx, PrefixPGT+pgtID).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var data TicketData
+	if err := json.Unmarshal([]byte(result), &data); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal PGT data: %w", err)
+	}
+
+	return &data, nil
+}
+
+// DeleteProxyGrantingTicket removes a Proxy-Granting Ticket
+func DeleteProxyGrantingTicket(ctx context.Context, pgtID string) error {
+	return RDB.Del(ctx, PrefixPGT+pgtID).Err()
+}
+
+// OAuth authorization code operations (one-time use, like SSO tickets)
+
+// SetAuthCode stores an authorization code with its grant data
+func SetAuthCode(ctx context.Context, code string, data *AuthCodeData, expire time.Duration) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal auth code data: %w", err)
+	}
+	return RDB.Set(ctx, PrefixAuthCode+code, jsonData, expire).Err()
+}
+
+// GetAndDeleteAuthCode atomically retrieves and deletes an authorization code (one-time use)
+func GetAndDeleteAuthCode(ctx context.Context, code string) (*AuthCodeData, error) {
+	result, err := RDB.GetDel(ctx, PrefixAuthCode+code).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var data AuthCodeData
+	if err := json.Unmarshal([]byte(result), &data); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal auth code data: %w", err)
+	}
+
+	return &data, nil
+}
+
+// OAuth consent operations
+
+// SetConsent stores an authorization request awaiting consent under a one-time challenge
+func SetConsent(ctx context.Context, challenge string, data *ConsentData, expire time.Duration) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal consent data: %w", err)
+	}
+	return RDB.Set(ctx, PrefixConsent+challenge, jsonData, expire).Err()
+}
+
+// GetAndDeleteConsent atomically retrieves and deletes a consent challenge (one-time use)
+func GetAndDeleteConsent(ctx context.Context, challenge string) (*ConsentData, error) {
+	result, err := RDB.GetDel(ctx, PrefixConsent+challenge).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var data ConsentData
+	if err := json.Unmarshal([]byte(result), &data); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal consent data: %w", err)
+	}
+
+	return &data, nil
+}
+
+// Password reset operations
+
+// SetPasswordReset stores the user a password reset token belongs to, under the hash of the token.
+// A user has at most one reset token: the previous one is deleted.
+func SetPasswordReset(ctx context.Context, tokenHash string, userID uint, expire time.Duration) error {
+	userKey := fmt.Sprintf("%s%d", PrefixResetUser, userID)
+	previous, err := RDB.SetArgs(ctx, userKey, tokenHash, redis.SetArgs{TTL: expire, Get: true}).Result()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+
+	pipe := RDB.TxPipeline()
+	if previous != "" {
+		pipe.Del(ctx, PrefixPasswordReset+previous)
+	}
+	pipe.Set(ctx, PrefixPasswordReset+tokenHash, userID, expire)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// GetAndDeletePasswordReset atomically retrieves and deletes a password reset token (one-time use)
+func GetAndDeletePasswordReset(ctx context.Context, tokenHash string) (uint, error) {
+	result, err := RDB.GetDel(ctx, PrefixPasswordReset+tokenHash).Uint64()
+	if err != nil {
+		return 0, err
+	}
+	RDB.Del(ctx, fmt.Sprintf("%s%d", PrefixResetUser, result))
+	return uint(result), nil
+}
+
+// MarkPasswordResetSent records a reset email to a user, returning false if one was sent within the interval
+func MarkPasswordResetSent(ctx context.Context, userID uint, interval time.Duration) (bool, error) {
+	return RDB.SetNX(ctx, fmt.Sprintf("%s%d", PrefixResetSent, userID), "1", interval).Result()
+}
+
+// Email verification operations
+
+// MarkEmailVerificationSent records a verification email to a user, returning false if one was sent within the interval
+func MarkEmailVerificationSent(ctx context.Context, userID uint, interval time.Duration) (bool, error) {
+	return RDB.SetNX(ctx, fmt.Sprintf("%s%d", PrefixVerifySent, userID), "1", interval).Result()
+}
+
+// MFA operations
+
+// SetMFAChallenge stores a pending second factor under its mfa_token
+func SetMFAChallenge(ctx context.Context, token string, data *MFAChallengeData, expire time.Duration) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal MFA challenge: %w", err)
+	}
+	return RDB.Set(ctx, PrefixMFAToken+token, jsonData, expire).Err()
+}
+
+// GetMFAChallenge retrieves a pending second factor; it is kept so the user can retry a wrong code
+func GetMFAChallenge(ctx context.Context, token string) (*MFAChallengeData, error) {
+	result, err := RDB.Get(ctx, PrefixMFAToken+token).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var data MFAChallengeData
+	if err := json.Unmarshal([]byte(result), &data); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal MFA challenge: %w", err)
+	}
+
+	return &data, nil
+}
+
+// DeleteMFAChallenge consumes an mfa_token, returning false if it was already consumed
+func DeleteMFAChallenge(ctx context.Context, token string) (bool, error) {
+	deleted, err := RDB.Del(ctx, PrefixMFAToken+token).Result()
+	return deleted > 0, err
+}
+
+// MarkTOTPUsed records the time step of an accepted TOTP code, returning false if it was already used
+func MarkTOTPUsed(ctx context.Context, userID uint, counter uint64, expire time.Duration) (bool, error) {
+	return RDB.SetNX(ctx, fmt.Sprintf("%s%d:%d", PrefixTOTPUsed, userID, counter), "1", expire).Result()
+}
+
+// WebAuthn operations
+
+// SetWebAuthnSession stores a WebAuthn ceremony under its challenge
+func SetWebAuthnSession(ctx context.Context, challenge string, data *WebAuthnSessionData, expire time.Duration) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal WebAuthn session: %w", err)
+	}
+	return RDB.Set(ctx, PrefixWebAuthn+challenge, jsonData, expire).Err()
+}
+
+// GetAndDeleteWebAuthnSession retrieves and consumes a WebAuthn ceremony (single-use)
+func GetAndDeleteWebAuthnSession(ctx context.Context, challenge string) (*WebAuthnSessionData, error) {
+	result, err := RDB.GetDel(ctx, PrefixWebAuthn+challenge).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var data WebAuthnSessionData
+	if err := json.Unmarshal([]byte(result), &data); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal WebAuthn session: %w", err)
+	}
+
+	return &data, nil
+}
+
+// Passwordless login operations
+
+// SetMagicLink stores a hashed magic link token
+func SetMagicLink(ctx context.Context, tokenHash string, data *PasswordlessData, expire time.Duration) error {
+	return setPasswordless(ctx, PrefixMagicLink+tokenHash, data, expire)
+}
+
+// GetAndDeleteMagicLink atomically retrieves and deletes a magic link token (one-time use)
+func GetAndDeleteMagicLink(ctx context.Context, tokenHash string) (*PasswordlessData, error) {
+	return getAndDeletePasswordless(ctx, PrefixMagicLink+tokenHash)
+}
+
+// SetEmailOTP stores an email OTP under the hash of the user and code. A user has at most one
+// code: the previous one is deleted.
+func SetEmailOTP(ctx context.Context, codeHash string, data *PasswordlessData, expire time.Duration) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal passwordless login: %w", err)
+	}
+
+	userKey := fmt.Sprintf("%s%d", PrefixEmailOTPUser, data.UserID)
+	previous, err := RDB.SetArgs(ctx, userKey, codeHash, redis.SetArgs{TTL: expire, Get: true}).Result()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+
+	pipe := RDB.TxPipeline()
+	if previous != "" {
+		pipe.Del(ctx, PrefixEmailOTP+previous)
+	}
+	pipe.Set(ctx, PrefixEmailOTP+codeHash, jsonData, expire)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// GetAndDeleteEmailOTP atomically retrieves and deletes an email OTP (one-time use)
+func GetAndDeleteEmailOTP(ctx context.Context, codeHash string) (*PasswordlessData, error) {
+	data, err := getAndDeletePasswordless(ctx, PrefixEmailOTP+codeHash)
+	if err != nil {
+		return nil, err
+	}
+	RDB.Del(ctx, fmt.Sprintf("%s%d", PrefixEmailOTPUser, data.UserID))
+	return data, nil
+}
+
+func setPasswordless(ctx context.Context, key string, data *PasswordlessData, expire time.Duration) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal passwordless login: %w", err)
+	}
+	return RDB.Set(ctx, key, jsonData, expire).Err()
+}
+
+func getAndDeletePasswordless(ctx context.Context, key string) (*PasswordlessData, error) {
+	result, err := RDB.GetDel(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var data PasswordlessData
+	if err := json.Unmarshal([]byte(result), &data); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal passwordless login: %w", err)
+	}
+
+	return &data, nil
+}
+
+// IncrSendCount counts a login email sent for a key (an email or IP) in the current window
+func IncrSendCount(ctx context.Context, key string, window time.Duration) (int64, error) {
+	count, err := RDB.Incr(ctx, PrefixSendLimit+key).Result()
+	if err != nil {
+		return 0, err
+	}
+	// The window starts with the first email
+	if count == 1 {
+		RDB.Expire(ctx, PrefixSendLimit+key, window)
+	}
+	return count, nil
+}
+
+// Refresh token family operations (rotation with reuse detection)
+
+// RefreshFamilyData stores a refresh token family: every refresh token rotated from one grant
+type RefreshFamilyData struct {
+	UserID   uint
+	ClientID string
+	Current  string // ID of the only refresh token of the family that may still be used
+}
+
+// Outcomes of a refresh token family rotation
+const (
+	FamilyRotated  = 1  // the presented token was current and has been replaced
+	FamilyReused   = 0  // the presented token was already rotated out
+	FamilyNotFound = -1 // the family was revoked or has expired
+)
+
+// rotateFamilyScript swaps the current refresh token ID only if the presented one is current.
+// The user's family index is extended with the family, so revocations keep finding it.
+var rotateFamilyScript = redis.NewScript(`
+local current = redis.call('HGET', KEYS[1], 'current')
+if not current then
+	return -1
+end
+if current ~= ARGV[1] then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'current', ARGV[2])
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+redis.call('SADD', KEYS[2], ARGV[4])
+redis.call('PEXPIRE', KEYS[2], ARGV[3])
+return 1
+`)
+
+// SetRefreshFamily stores a new refresh token family and indexes it under its user
+func SetRefreshFamily(ctx context.Context, familyID string, data *RefreshFamilyData, expire time.Duration) error {
+	key := PrefixRefreshToken + familyID
+	userKey := fmt.Sprintf("%s%d", PrefixUserFamilies, data.UserID)
+	pipe := RDB.TxPipeline()
+	pipe.HSet(ctx, key, "user_id", data.UserID, "client_id", data.ClientID, "current", data.Current)
+	pipe.Expire(ctx, key, expire)
+	pipe.SAdd(ctx, userKey, familyID)
+	pipe.Expire(ctx, userKey, expire)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// GetUserRefreshFamilies returns the live refresh token families of a user, mapped to their client ID.
+// Families that have expired or were revoked are dropped from the index.
+func GetUserRefreshFamilies(ctx context.Context, userID uint) (map[string]string, error) {
+	userKey := fmt.Sprintf("%s%d", PrefixUserFamilies, userID)
+	familyIDs, err := RDB.SMembers(ctx, userKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	families := make(map[string]string, len(familyIDs))
+	for _, familyID := range familyIDs {
+		values, err := RDB.HMGet(ctx, PrefixRefreshToken+familyID, "client_id", "current").Result()
+		if err != nil {
+			return nil, err
+		}
+		if values[1] == nil {
+			RDB.SRem(ctx, userKey, familyID)
+			continue
+		}
+		clientID, _ := values[0].(string)
+		families[familyID] = clientID
+	}
+	return families, nil
+}
+
+// RotateRefreshFamily atomically replaces the current refresh token of a family and
+// returns FamilyRotated, FamilyReused or FamilyNotFound
+func RotateRefreshFamily(ctx context.Context, userID uint, familyID, currentID, nextID string, expire time.Duration) (int, error) {
+	userKey := fmt.Sprintf("%s%d", PrefixUserFamilies, userID)
+	return rotateFamilyScript.Run(ctx, RDB, []string{PrefixRefreshToken + familyID, userKey},
+		currentID, nextID, expire.Milliseconds(), familyID).Int()
+}
+
+// RefreshFamilyExists reports whether a refresh token family is still valid
+func RefreshFamilyExists(ctx context.Context, familyID string) (bool, error) {
+	result, err := RDB.Exists(ctx, PrefixRefreshToken+familyID).Result()
+	if err != nil {
+		return false, err
+	}
+	return result > 0, nil
+}
+
+// DeleteRefreshFamily revokes a refresh token family
+func DeleteRefreshFamily(ctx context.Context, familyID string) error {
+	return RDB.Del(ctx, PrefixRefreshToken+familyID).Err()
+}
+
+// OAuth device authorization operations (RFC 8628)
+
+// SetDeviceCode stores a device authorization request under its device code and its user code
+func SetDeviceCode(ctx context.Context, deviceCode string, data *DeviceCodeData, expire time.Duration) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal device code data: %w", err)
+	}
+
+	pipe := RDB.TxPipeline()
+	pipe.Set(ctx, PrefixDeviceCode+deviceCode, jsonData, expire)
+	pipe.Set(ctx, PrefixUserCode+data.UserCode, deviceCode, expire)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// GetDeviceCode retrieves a device authorization request by device code
+func GetDeviceCode(ctx context.Context, deviceCode string) (*DeviceCodeData, error) {
+	result, err := RDB.Get(ctx, PrefixDeviceCode+deviceCode).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var data DeviceCodeData
+	if err := json.Unmarshal([]byte(result), &data); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal device code data: %w", err)
+	}
+
+	return &data, nil
+}
+
+// GetDeviceCodeByUserCode resolves the device code a user code was issued with
+func GetDeviceCodeByUserCode(ctx context.Context, userCode string) (string, error) {
+	return RDB.Get(ctx, PrefixUserCode+userCode).Result()
+}
+
+// slowDownDeviceScript raises the poll interval of a device code in place, so that it cannot
+// overwrite a decision recorded at the same time
+var slowDownDeviceScript = redis.NewScript(`
+local value = redis.call('GET', KEYS[1])
+if not value then
+	return 0
+end
+local data = cjson.decode(value)
+data.interval = data.interval + tonumber(ARGV[1])
+redis.call('SET', KEYS[1], cjson.encode(data), 'KEEPTTL')
+return 1
+`)
+
+// decideDeviceScript merges the user's decision into a device code only while it is pending
+var decideDeviceScript = redis.NewScript(`
+local value = redis.call('GET', KEYS[1])
+if not value then
+	return 0
+end
+local data = cjson.decode(value)
+if data.status ~= ARGV[1] then
+	return 0
+end
+for field, v in pairs(cjson.decode(ARGV[2])) do
+	data[field] = v
+end
+redis.call('SET', KEYS[1], cjson.encode(data), 'KEEPTTL')
+return 1
+`)
+
+// SlowDownDeviceCode adds seconds to the poll interval of a device code, keeping its expiry
+func SlowDownDeviceCode(ctx context.Context, deviceCode string, increment int) error {
+	return slowDownDeviceScript.Run(ctx, RDB, []string{PrefixDeviceCode + deviceCode}, increment).Err()
+}
+
+// DecideDeviceCode records the status, and for an approval the user, of a pending device code,
+// keeping its expiry. It returns false if the code has expired or was already decided.
+func DecideDeviceCode(ctx context.Context, deviceCode string, data *DeviceCodeData) (bool, error) {
+	decision, err := json.Marshal(struct {
+		Status   string    `json:"status"`
+		UserID   uint      `json:"user_id,omitempty"`
+		Username string    `json:"username,omitempty"`
+		AMR      []string  `json:"amr,omitempty"`
+		AuthTime time.Time `json:"auth_time"`
+	}{data.Status, data.UserID, data.Username, data.AMR, data.AuthTime})
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal device code data: %w", err)
+	}
+	return decideDeviceScript.Run(ctx, RDB, []string{PrefixDeviceCode + deviceCode},
+		DeviceStatusPending, decision).Bool()
+}
+
+// GetAndDeleteDeviceCode atomically retrieves and deletes a device code (one-time use)
+func GetAndDeleteDeviceCode(ctx context.Context, deviceCode string) (*DeviceCodeData, error) {
+	result, err := RDB.GetDel(ctx, PrefixDeviceCode+deviceCode).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var data DeviceCodeData
+	if err := json.Unmarshal([]byte(result), &data); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal device code data: %w", err)
+	}
+
+	RDB.Del(ctx, PrefixUserCode+data.UserCode, PrefixDevicePoll+deviceCode)
+	return &data, nil
+}
+
+// MarkDevicePoll records a poll for a device code, returning false if the previous
+// poll happened less than the interval ago
+func MarkDevicePoll(ctx context.Context, deviceCode string, interval time.Duration) (bool, error) {
+	return RDB.SetNX(ctx, PrefixDevicePoll+deviceCode, "1", interval).Result()
+}
+
+// SSO Ticket-Granting Ticket operations
+
+// SetTGT stores a Ticket-Granting Ticket with its session data and indexes it under its user
+func SetTGT(ctx context.Context, tgtID string, data *TGTData, expire time.Duration) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal TGT data: %w", err)
+	}
+
+	userKey := fmt.Sprintf("%s%d", PrefixUserTGTs, data.UserID)
+	pipe := RDB.TxPipeline()
+	pipe.Set(ctx, PrefixTGT+tgtID, jsonData, expire)
+	pipe.SAdd(ctx, userKey, tgtID)
+	pipe.Expire(ctx, userKey, expire)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// GetUserTGTs returns the live Ticket-Granting Tickets of a user.
+// TGTs that have expired or were destroyed are dropped from the index.
+func GetUserTGTs(ctx context.Context, userID uint) ([]string, error) {
+	userKey := fmt.Sprintf("%s%d", PrefixUserTGTs, userID)
+	tgtIDs, err := RDB.SMembers(ctx, userKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	live := make([]string, 0, len(tgtIDs))
+	for _, tgtID := range tgtIDs {
+		exists, err := RDB.Exists(ctx, PrefixTGT+tgtID).Result()
+		if err != nil {
+			return nil, err
+		}
+		if exists == 0 {
+			RDB.SRem(ctx, userKey, tgtID)
+			continue
+		}
+		live = append(live, tgtID)
+	}
+	return live, nil
+}
+
+// GetTGT retrieves the session data of a Ticket-Granting Ticket
+func GetTGT(ctx context.Context, tgtID string) (*TGTData, error) {
+	result, err := RDB.Get(ctx, PrefixTGT+tgtID).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var data TGTData
+	if err := json.Unmarshal([]byte(result), &data); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal TGT data: %w", err)
+	}
+
+	return &data, nil
+}
+
+// DeleteTGT removes a Ticket-Granting Ticket together with its service registrations
+func DeleteTGT(ctx context.Context, tgtID string) error {
+	return RDB.Del(ctx, PrefixTGT+tgtID, PrefixTGTServices+tgtID).Err()
+}
+
+// AddTGTService records that a Service Ticket was issued to a service under the given TGT
+func AddTGTService(ctx context.Context, tgtID, ticketID, service string, expire time.Duration) error {
+	key := PrefixTGTServices + tgtID
+	pipe := RDB.TxPipeline()
+	pipe.HSet(ctx, key, ticketID, service)
+	pipe.Expire(ctx, key, expire)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// GetTGTServices returns the services that were issued tickets under the given TGT, keyed by ticket ID
+func GetTGTServices(ctx context.Context, tgtID string) (map[string]string, error) {
+	return RDB.HGetAll(ctx, PrefixTGTServices+tgtID).Result()
+}
+
 // Login rate limiting
 
 func IncrLoginFail(ctx context.Context, key string, expire time.Duration) (int64, error) {
@@ -0,0 +1,226 @@
+package handler
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joshleeeeee/go-lite-auth/internal/service"
+)
+
+// AdminHandler handles user management requests from operators
+type AdminHandler struct {
+	adminService *service.AdminService
+}
+
+// NewAdminHandler creates a new AdminHandler instance
+func NewAdminHandler() *AdminHandler {
+	return &AdminHandler{
+		adminService: service.NewAdminService(),
+	}
+}
+
+// ListUsers returns a page of users
+// GET /api/admin/users?page=1&page_size=20&status=1&created_from=2024-01-01&created_to=2024-12-31&email_domain=example.com&q=alice&deleted=false
+func (h *AdminHandler) ListUsers(c *gin.Context) {
+	var req service.UserListRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		fail(c, 400, "Invalid request: "+err.Error())
+		return
+	}
+
+	resp, err := h.adminService.ListUsers(&req)
+	if err != nil {
+		adminFail(c, err)
+		return
+	}
+
+	success(c, resp)
+}
+
+// GetUser returns a user, including a soft-deleted one
+// GET /api/admin/users/:id
+func (h *AdminHandler) GetUser(c *gin.Context) {
+	id, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	user, err := h.adminService.GetUser(id)
+	if err != nil {
+		adminFail(c, err)
+		return
+	}
+
+	success(c, user)
+}
+
+// CreateUser creates a user
+// POST /api/admin/users
+func (h *AdminHandler) CreateUser(c *gin.Context) {
+	var req service.CreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		fail(c, 400, "Invalid request: "+err.Error())
+		return
+	}
+
+	user, err := h.adminService.CreateUser(c.Request.Context(), c.GetUint("userID"), &req)
+	if err != nil {
+		fail(c, 400, err.Error())
+		return
+	}
+
+	success(c, user)
+}
+
+// ImportUsers creates users with password hashes exported from another system
+// POST /api/admin/users/import
+func (h *AdminHandler) ImportUsers(c *gin.Context) {
+	var req service.ImportUsersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		fail(c, 400, "Invalid request: "+err.Error())
+		return
+	}
+
+	resp, err := h.adminService.ImportUsers(c.GetUint("userID"), &req)
+	if err != nil {
+		adminFail(c, err)
+		return
+	}
+
+	success(c, resp)
+}
+
+// DisableUser disables a user and revokes their tokens
+// POST /api/admin/users/:id/disable
+func (h *AdminHandler) DisableUser(c *gin.Context) {
+	id, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	user, err := h.adminService.DisableUser(c.Request.Context(), c.GetUint("userID"), id)
+	if err != nil {
+		adminFail(c, err)
+		return
+	}
+
+	success(c, user)
+}
+
+// EnableUser enables a user
+// POST /api/admin/users/:id/enable
+func (h *AdminHandler) EnableUser(c *gin.Context) {
+	id, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	user, err := h.adminService.EnableUser(c.GetUint("userID"), id)
+	if err != nil {
+		adminFail(c, err)
+		return
+	}
+
+	success(c, user)
+}
+
+// ForceLogout revokes every token and SSO session of a user
+// POST /api/admin/users/:id/logout
+func (h *AdminHandler) ForceLogout(c *gin.Context) {
+	id, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.adminService.ForceLogout(c.Request.Context(), c.GetUint("userID"), id); err != nil {
+		adminFail(c, err)
+		return
+	}
+
+	success(c, nil)
+}
+
+// ResetPassword sets a new password for a user, generating one when none is given
+// POST /api/admin/users/:id/reset-password
+func (h *AdminHandler) ResetPassword(c *gin.Context) {
+	id, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req service.ResetPasswordRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			fail(c, 400, "Invalid request: "+err.Error())
+			return
+		}
+	}
+
+	password, err := h.adminService.ResetPassword(c.Request.Context(), c.GetUint("userID"), id, &req)
+	if err != nil {
+		adminFail(c, err)
+		return
+	}
+
+	// Only a generated password is echoed back, the operator already knows a chosen one
+	if req.Password != "" {
+		success(c, nil)
+		return
+	}
+	success(c, gin.H{"password": password})
+}
+
+// DeleteUser soft-deletes a user and revokes their tokens
+// DELETE /api/admin/users/:id
+func (h *AdminHandler) DeleteUser(c *gin.Context) {
+	id, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.adminService.DeleteUser(c.Request.Context(), c.GetUint("userID"), id); err != nil {
+		adminFail(c, err)
+		return
+	}
+
+	success(c, nil)
+}
+
+// RestoreUser restores a soft-deleted user
+// POST /api/admin/users/:id/restore
+func (h *AdminHandler) RestoreUser(c *gin.Context) {
+	id, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	user, err := h.adminService.RestoreUser(c.GetUint("userID"), id)
+	if err != nil {
+		adminFail(c, err)
+		return
+	}
+
+	success(c, user)
+}
+
+// userIDParam parses the :id path parameter
+func userIDParam(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		fail(c, 400, "Invalid user ID")
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// adminFail maps admin service errors to responses
+func adminFail(c *gin.Context, err error) {
+	switch err {
+	case service.ErrUserNotFound:
+		fail(c, 404, err.Error())
+	case service.ErrInvalidFilter, service.ErrCannotModifySelf, service.ErrUserNotDeleted:
+		fail(c, 400, err.Error())
+	default:
+		fail(c, 500, "Internal server error")
+	}
+}
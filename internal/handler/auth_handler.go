@@ -163,6 +163,7 @@ func (h *AuthHandler) ValidateToken(c *gin.Context) {
 	success(c, gin.H{
 		"user_id":  claims.UserID,
 		"username": claims.Username,
+		"roles":    claims.Roles,
 		"valid":    true,
 	})
 }
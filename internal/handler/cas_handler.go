@@ -0,0 +1,227 @@
+package handler
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joshleeeeee/go-lite-auth/internal/service"
+)
+
+// CAS protocol namespace used by XML responses
+const casNamespace = "http://www.yale.edu/tp/cas"
+
+// CAS protocol error codes
+const (
+	CASInvalidRequest = "INVALID_REQUEST"
+	CASInvalidTicket  = "INVALID_TICKET"
+	CASInvalidService = "INVALID_SERVICE"
+	CASInternalError  = "INTERNAL_ERROR"
+
+	CASInvalidTicketSpec   = "INVALID_TICKET_SPEC"
+	CASUnauthorizedService = "UNAUTHORIZED_SERVICE"
+)
+
+// casServiceResponse is the <cas:serviceResponse> envelope of CAS protocol v2/v3
+type casServiceResponse struct {
+	XMLName   xml.Name                  `xml:"cas:serviceResponse" json:"-"`
+	Namespace string                    `xml:"xmlns:cas,attr" json:"-"`
+	Success   *casAuthenticationSuccess `xml:"cas:authenticationSuccess,omitempty" json:"authenticationSuccess,omitempty"`
+	Failure   *casFailure               `xml:"cas:authenticationFailure,omitempty" json:"authenticationFailure,omitempty"`
+	Proxy     *casProxySuccess          `xml:"cas:proxySuccess,omitempty" json:"proxySuccess,omitempty"`
+	ProxyFail *casFailure               `xml:"cas:proxyFailure,omitempty" json:"proxyFailure,omitempty"`
+}
+
+type casAuthenticationSuccess struct {
+	User                string        `xml:"cas:user" json:"user"`
+	Attributes          casAttributes `xml:"cas:attributes,omitempty" json:"attributes,omitempty"`
+	ProxyGrantingTicket string        `xml:"cas:proxyGrantingTicket,omitempty" json:"proxyGrantingTicket,omitempty"`
+	Proxies             casProxies    `xml:"cas:proxies,omitempty" json:"proxies,omitempty"`
+}
+
+type casProxySuccess struct {
+	ProxyTicket string `xml:"cas:proxyTicket" json:"proxyTicket"`
+}
+
+type casFailure struct {
+	Code        string `xml:"code,attr" json:"code"`
+	Description string `xml:",chardata" json:"description"`
+}
+
+// casAttributes renders each attribute as a <cas:name> element, repeating it for multi-valued attributes
+type casAttributes map[string]interface{}
+
+func (a casAttributes) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(a))
+	for name := range a {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		elem := xml.StartElement{Name: xml.Name{Local: "cas:" + name}}
+		for _, value := range attributeValues(a[name]) {
+			if err := e.EncodeElement(value, elem); err != nil {
+				return err
+			}
+		}
+	}
+
+	return e.EncodeToken(start.End())
+}
+
+// casProxies renders the proxy chain as <cas:proxy> elements, most recent proxy first
+type casProxies []string
+
+func (p casProxies) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, proxy := range p {
+		if err := e.EncodeElement(proxy, xml.StartElement{Name: xml.Name{Local: "cas:proxy"}}); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+// attributeValues flattens an attribute into its individual values
+func attributeValues(value interface{}) []string {
+	switch v := value.(type) {
+	case []string:
+		return v
+	case string:
+		return []string{v}
+	default:
+		return []string{fmt.Sprint(v)}
+	}
+}
+
+// ServiceValidate validates a Service Ticket using the CAS protocol
+// GET /sso/serviceValidate?ticket=xxx&service=xxx[&pgtUrl=xxx][&renew=true][&format=JSON]
+// GET /sso/p3/serviceValidate?ticket=xxx&service=xxx[&pgtUrl=xxx][&renew=true][&format=JSON]
+func (h *SSOHandler) ServiceValidate(c *gin.Context) {
+	h.casValidate(c, false)
+}
+
+// ProxyValidate validates a Service or Proxy Ticket and returns the proxy chain
+// GET /sso/proxyValidate?ticket=xxx&service=xxx[&pgtUrl=xxx][&renew=true][&format=JSON]
+// GET /sso/p3/proxyValidate?ticket=xxx&service=xxx[&pgtUrl=xxx][&renew=true][&format=JSON]
+func (h *SSOHandler) ProxyValidate(c *gin.Context) {
+	h.casValidate(c, true)
+}
+
+// Proxy issues a Proxy Ticket for a target service in exchange for a Proxy-Granting Ticket
+// GET /sso/proxy?pgt=xxx&targetService=xxx[&format=JSON]
+func (h *SSOHandler) Proxy(c *gin.Context) {
+	pgt := c.Query("pgt")
+	targetService := c.Query("targetService")
+
+	if pgt == "" || targetService == "" {
+		casProxyFail(c, CASInvalidRequest, "Both 'pgt' and 'targetService' parameters are required")
+		return
+	}
+
+	proxyTicket, err := h.ssoService.Proxy(c.Request.Context(), pgt, targetService)
+	if err != nil {
+		switch err {
+		case service.ErrPGTNotFound:
+			casProxyFail(c, CASInvalidTicket, fmt.Sprintf("Ticket '%s' not recognized", pgt))
+		case service.ErrInvalidService:
+			casProxyFail(c, CASUnauthorizedService, fmt.Sprintf("Service '%s' is not authorized to receive proxy tickets", targetService))
+		default:
+			casProxyFail(c, CASInternalError, "Failed to issue proxy ticket")
+		}
+		return
+	}
+
+	casRender(c, &casServiceResponse{
+		Proxy: &casProxySuccess{ProxyTicket: proxyTicket},
+	})
+}
+
+// casValidate implements the shared CAS ticket validation flow
+func (h *SSOHandler) casValidate(c *gin.Context, allowProxy bool) {
+	ticket := c.Query("ticket")
+	serviceURL := c.Query("service")
+
+	if ticket == "" || serviceURL == "" {
+		casFail(c, CASInvalidRequest, "Both 'ticket' and 'service' parameters are required")
+		return
+	}
+
+	userInfo, err := h.ssoService.ValidateTicket(c.Request.Context(), &service.TicketValidation{
+		Ticket:     ticket,
+		Service:    serviceURL,
+		PGTURL:     c.Query("pgtUrl"),
+		AllowProxy: allowProxy,
+		Renew:      queryFlag(c, "renew"),
+	})
+	if err != nil {
+		switch err {
+		case service.ErrTicketNotFound:
+			casFail(c, CASInvalidTicket, fmt.Sprintf("Ticket '%s' not recognized", ticket))
+		case service.ErrProxyTicket:
+			casFail(c, CASInvalidTicket, fmt.Sprintf("Ticket '%s' is a proxy ticket, use proxyValidate", ticket))
+		case service.ErrTicketNotRenewed:
+			casFail(c, CASInvalidTicketSpec, fmt.Sprintf("Ticket '%s' was not issued from a new login", ticket))
+		case service.ErrServiceMismatch, service.ErrInvalidService:
+			casFail(c, CASInvalidService, fmt.Sprintf("Ticket '%s' does not match supplied service", ticket))
+		default:
+			casFail(c, CASInternalError, "Failed to validate ticket")
+		}
+		return
+	}
+
+	attributes := casAttributes{service.AttributeFromNewLogin: userInfo.FromNewLogin}
+	for name, value := range userInfo.Attributes {
+		attributes[name] = value
+	}
+
+	casRender(c, &casServiceResponse{
+		Success: &casAuthenticationSuccess{
+			User:                userInfo.Username,
+			Attributes:          attributes,
+			ProxyGrantingTicket: userInfo.PGTIOU,
+			Proxies:             userInfo.Proxies,
+		},
+	})
+}
+
+// casFail writes a CAS authenticationFailure response
+func casFail(c *gin.Context, code, description string) {
+	casRender(c, &casServiceResponse{
+		Failure: &casFailure{
+			Code:        code,
+			Description: description,
+		},
+	})
+}
+
+// casProxyFail writes a CAS proxyFailure response
+func casProxyFail(c *gin.Context, code, description string) {
+	casRender(c, &casServiceResponse{
+		ProxyFail: &casFailure{
+			Code:        code,
+			Description: description,
+		},
+	})
+}
+
+// casRender writes a CAS service response as XML, or as JSON when format=JSON is requested
+func casRender(c *gin.Context, resp *casServiceResponse) {
+	if strings.EqualFold(c.Query("format"), "JSON") {
+		c.JSON(http.StatusOK, gin.H{"serviceResponse": resp})
+		return
+	}
+
+	resp.Namespace = casNamespace
+	c.XML(http.StatusOK, resp)
+}
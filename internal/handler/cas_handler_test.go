@@ -0,0 +1,356 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"github.com/joshleeeeee/go-lite-auth/internal/config"
+	"github.com/joshleeeeee/go-lite-auth/internal/database"
+	"github.com/joshleeeeee/go-lite-auth/internal/model"
+	"github.com/joshleeeeee/go-lite-auth/internal/service"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// Services registered by setupCAS
+const (
+	testService  = "https://app.example.com/cas"
+	proxyService = "https://backend.example.com/cas"
+)
+
+// casTest serves the CAS validation endpoints for a user alice with the roles hr and it
+type casTest struct {
+	router *gin.Engine
+	user   *model.User
+}
+
+// setupCAS points the database and Redis at fresh in-memory instances and registers two
+// services: one releasing alice's email and groups, the other the defaults
+func setupCAS(t *testing.T) *casTest {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	database.RDB = redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { database.RDB.Close() })
+
+	config.GlobalConfig = &config.Config{
+		SSO: config.SSOConfig{TGTExpire: 3600, LogoutTimeout: 1, ProxyTimeout: 1},
+	}
+
+	// Each test gets its own shared-cache database, named after the test
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	database.DB = db
+	if err := database.AutoMigrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	user := &model.User{Username: "alice", Email: "alice@example.com", Status: 1,
+		Roles: []model.Role{{Name: "hr"}, {Name: "it"}}}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	clients := []*model.Client{
+		{ClientID: "app", Name: "app", RedirectURI: testService, Status: 1,
+			AllowedAttributes: "email,groups", AttributeRenames: "email=mail"},
+		{ClientID: "backend", Name: "backend", RedirectURI: proxyService, Status: 1},
+	}
+	for _, client := range clients {
+		if err := db.Create(client).Error; err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+	}
+	service.InvalidateServiceRegistry()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	h := NewSSOHandler()
+	router.GET("/sso/serviceValidate", h.ServiceValidate)
+	router.GET("/sso/p3/serviceValidate", h.ServiceValidate)
+	router.GET("/sso/proxyValidate", h.ProxyValidate)
+	router.GET("/sso/proxy", h.Proxy)
+	return &casTest{router: router, user: user}
+}
+
+// ticket stores a ticket of alice for a service
+func (ct *casTest) ticket(t *testing.T, ticketID, serviceURL string, fromNewLogin bool, proxies ...string) string {
+	t.Helper()
+
+	data := &database.TicketData{UserID: ct.user.ID, Username: ct.user.Username, Service: serviceURL,
+		FromNewLogin: fromNewLogin, Proxies: proxies}
+	if err := database.SetTicketWithService(context.Background(), ticketID, data, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	return ticketID
+}
+
+// get requests a CAS endpoint and returns the response body
+func (ct *casTest) get(t *testing.T, path string, query url.Values) string {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	ct.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path+"?"+query.Encode(), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET %s = %d, want 200", path, w.Code)
+	}
+	return w.Body.String()
+}
+
+// xmlResponse is a <cas:serviceResponse> as read by a CAS client
+type xmlResponse struct {
+	XMLName xml.Name `xml:"http://www.yale.edu/tp/cas serviceResponse"`
+	Success *struct {
+		User       string `xml:"http://www.yale.edu/tp/cas user"`
+		Attributes struct {
+			Values []struct {
+				XMLName xml.Name
+				Value   string `xml:",chardata"`
+			} `xml:",any"`
+		} `xml:"http://www.yale.edu/tp/cas attributes"`
+		Proxies []string `xml:"http://www.yale.edu/tp/cas proxies>proxy"`
+	} `xml:"http://www.yale.edu/tp/cas authenticationSuccess"`
+	Failure      *xmlFailure `xml:"http://www.yale.edu/tp/cas authenticationFailure"`
+	ProxySuccess *struct {
+		ProxyTicket string `xml:"http://www.yale.edu/tp/cas proxyTicket"`
+	} `xml:"http://www.yale.edu/tp/cas proxySuccess"`
+	ProxyFailure *xmlFailure `xml:"http://www.yale.edu/tp/cas proxyFailure"`
+}
+
+type xmlFailure struct {
+	Code        string `xml:"code,attr"`
+	Description string `xml:",chardata"`
+}
+
+func parseXML(t *testing.T, body string) *xmlResponse {
+	t.Helper()
+
+	var resp xmlResponse
+	if err := xml.Unmarshal([]byte(body), &resp); err != nil {
+		t.Fatalf("response is not CAS XML: %v\n%s", err, body)
+	}
+	return &resp
+}
+
+// attributes collects the values of each attribute in document order
+func (r *xmlResponse) attributes() map[string][]string {
+	attributes := make(map[string][]string)
+	for _, value := range r.Success.Attributes.Values {
+		if value.XMLName.Space != "http://www.yale.edu/tp/cas" {
+			continue
+		}
+		attributes[value.XMLName.Local] = append(attributes[value.XMLName.Local], value.Value)
+	}
+	return attributes
+}
+
+func TestServiceValidateXML(t *testing.T) {
+	ct := setupCAS(t)
+	ticket := ct.ticket(t, "ST-xml", testService, true)
+
+	body := ct.get(t, "/sso/p3/serviceValidate", url.Values{"ticket": {ticket}, "service": {testService}})
+	want := `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">` +
+		`<cas:authenticationSuccess><cas:user>alice</cas:user><cas:attributes>` +
+		`<cas:groups>hr</cas:groups><cas:groups>it</cas:groups>` +
+		`<cas:isFromNewLogin>true</cas:isFromNewLogin>` +
+		`<cas:mail>alice@example.com</cas:mail>` +
+		`</cas:attributes></cas:authenticationSuccess></cas:serviceResponse>`
+	if body != want {
+		t.Errorf("serviceValidate body =\n%s\nwant\n%s", body, want)
+	}
+
+	resp := parseXML(t, body)
+	if resp.Success == nil || resp.Success.User != "alice" {
+		t.Fatalf("serviceValidate = %+v, want authenticationSuccess for alice", resp)
+	}
+	wantAttributes := map[string][]string{
+		"groups":         {"hr", "it"},
+		"isFromNewLogin": {"true"},
+		"mail":           {"alice@example.com"},
+	}
+	if got := resp.attributes(); !reflect.DeepEqual(got, wantAttributes) {
+		t.Errorf("attributes = %v, want %v", got, wantAttributes)
+	}
+}
+
+func TestServiceValidateFromNewLogin(t *testing.T) {
+	tests := []struct {
+		name         string
+		fromNewLogin bool
+		renew        bool
+		wantValue    string // isFromNewLogin, "" for a failure
+		wantCode     string
+	}{
+		{"new login", true, false, "true", ""},
+		{"SSO session", false, false, "false", ""},
+		{"new login with renew", true, true, "true", ""},
+		{"SSO session with renew", false, true, "", CASInvalidTicketSpec},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ct := setupCAS(t)
+			query := url.Values{"ticket": {ct.ticket(t, "ST-login", proxyService, tt.fromNewLogin)}, "service": {proxyService}}
+			if tt.renew {
+				query.Set("renew", "true")
+			}
+
+			resp := parseXML(t, ct.get(t, "/sso/serviceValidate", query))
+			if tt.wantCode != "" {
+				if resp.Failure == nil || resp.Failure.Code != tt.wantCode {
+					t.Fatalf("serviceValidate = %+v, want failure %s", resp, tt.wantCode)
+				}
+				return
+			}
+			if resp.Success == nil {
+				t.Fatalf("serviceValidate = %+v, want authenticationSuccess", resp.Failure)
+			}
+			if got := resp.attributes()["isFromNewLogin"]; !reflect.DeepEqual(got, []string{tt.wantValue}) {
+				t.Errorf("isFromNewLogin = %v, want %s", got, tt.wantValue)
+			}
+		})
+	}
+}
+
+func TestServiceValidateFailure(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		query    func(ct *casTest, t *testing.T) url.Values
+		wantCode string
+	}{
+		{"missing service", "/sso/serviceValidate", func(ct *casTest, t *testing.T) url.Values {
+			return url.Values{"ticket": {ct.ticket(t, "ST-1", testService, true)}}
+		}, CASInvalidRequest},
+		{"unknown ticket", "/sso/serviceValidate", func(ct *casTest, t *testing.T) url.Values {
+			return url.Values{"ticket": {"ST-unknown"}, "service": {testService}}
+		}, CASInvalidTicket},
+		{"other service", "/sso/serviceValidate", func(ct *casTest, t *testing.T) url.Values {
+			return url.Values{"ticket": {ct.ticket(t, "ST-1", testService, true)}, "service": {proxyService}}
+		}, CASInvalidService},
+		{"proxy ticket", "/sso/serviceValidate", func(ct *casTest, t *testing.T) url.Values {
+			return url.Values{"ticket": {ct.ticket(t, "PT-1", testService, false, proxyService)}, "service": {testService}}
+		}, CASInvalidTicket},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ct := setupCAS(t)
+			body := ct.get(t, tt.path, tt.query(ct, t))
+
+			resp := parseXML(t, body)
+			if resp.Success != nil || resp.Failure == nil || resp.Failure.Code != tt.wantCode || resp.Failure.Description == "" {
+				t.Fatalf("serviceValidate = %s, want authenticationFailure %s", body, tt.wantCode)
+			}
+			if !strings.HasPrefix(body, `<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas"><cas:authenticationFailure code="`+tt.wantCode+`">`) {
+				t.Errorf("serviceValidate body = %s, want a cas:authenticationFailure element", body)
+			}
+		})
+	}
+}
+
+func TestProxy(t *testing.T) {
+	ct := setupCAS(t)
+	ctx := context.Background()
+	pgt := &database.TicketData{UserID: ct.user.ID, Username: ct.user.Username, Service: proxyService, Proxies: []string{proxyService}}
+	if err := database.SetProxyGrantingTicket(ctx, "PGT-1", pgt, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := parseXML(t, ct.get(t, "/sso/proxy", url.Values{"pgt": {"PGT-1"}, "targetService": {testService}}))
+	if resp.ProxySuccess == nil || !strings.HasPrefix(resp.ProxySuccess.ProxyTicket, service.ProxyTicketPrefix) {
+		t.Fatalf("proxy = %+v, want proxySuccess with a proxy ticket", resp)
+	}
+
+	// The proxy ticket validates at proxyValidate only, with the proxy chain
+	query := url.Values{"ticket": {resp.ProxySuccess.ProxyTicket}, "service": {testService}}
+	resp = parseXML(t, ct.get(t, "/sso/proxyValidate", query))
+	if resp.Success == nil || !reflect.DeepEqual(resp.Success.Proxies, []string{proxyService}) {
+		t.Fatalf("proxyValidate = %+v, want the proxy chain [%s]", resp, proxyService)
+	}
+	if got := resp.attributes()["isFromNewLogin"]; !reflect.DeepEqual(got, []string{"false"}) {
+		t.Errorf("isFromNewLogin of a proxy ticket = %v, want false", got)
+	}
+
+	tests := []struct {
+		name     string
+		query    url.Values
+		wantCode string
+	}{
+		{"missing targetService", url.Values{"pgt": {"PGT-1"}}, CASInvalidRequest},
+		{"unknown PGT", url.Values{"pgt": {"PGT-unknown"}, "targetService": {testService}}, CASInvalidTicket},
+		{"unregistered target", url.Values{"pgt": {"PGT-1"}, "targetService": {"https://evil.example.com"}}, CASUnauthorizedService},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := parseXML(t, ct.get(t, "/sso/proxy", tt.query))
+			if resp.ProxySuccess != nil || resp.ProxyFailure == nil || resp.ProxyFailure.Code != tt.wantCode {
+				t.Errorf("proxy = %+v, want proxyFailure %s", resp, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestCASJSON(t *testing.T) {
+	ct := setupCAS(t)
+	ctx := context.Background()
+	if err := database.SetProxyGrantingTicket(ctx, "PGT-1", &database.TicketData{UserID: ct.user.ID, Username: ct.user.Username,
+		Service: proxyService, Proxies: []string{proxyService}}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		path  string
+		query url.Values
+		want  string
+	}{
+		{"success", "/sso/serviceValidate", url.Values{"ticket": {ct.ticket(t, "ST-json", testService, true)}, "service": {testService}},
+			`{"serviceResponse":{"authenticationSuccess":{"user":"alice","attributes":{"groups":["hr","it"],"isFromNewLogin":true,"mail":"alice@example.com"}}}}`},
+		{"failure", "/sso/serviceValidate", url.Values{"ticket": {"ST-unknown"}, "service": {testService}},
+			`{"serviceResponse":{"authenticationFailure":{"code":"INVALID_TICKET","description":"Ticket 'ST-unknown' not recognized"}}}`},
+		{"proxy chain", "/sso/proxyValidate", url.Values{"ticket": {ct.ticket(t, "PT-json", proxyService, false, testService)}, "service": {proxyService}},
+			`{"serviceResponse":{"authenticationSuccess":{"user":"alice","attributes":{"email":"alice@example.com","isFromNewLogin":false,"nickname":"","user_id":1},"proxies":["` + testService + `"]}}}`},
+		{"proxy failure", "/sso/proxy", url.Values{"pgt": {"PGT-unknown"}, "targetService": {testService}},
+			`{"serviceResponse":{"proxyFailure":{"code":"INVALID_TICKET","description":"Ticket 'PGT-unknown' not recognized"}}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.query.Set("format", "JSON")
+			if body := ct.get(t, tt.path, tt.query); body != tt.want {
+				t.Errorf("GET %s body =\n%s\nwant\n%s", tt.path, body, tt.want)
+			}
+		})
+	}
+
+	t.Run("proxy success", func(t *testing.T) {
+		body := ct.get(t, "/sso/proxy", url.Values{"pgt": {"PGT-1"}, "targetService": {testService}, "format": {"json"}})
+		var resp struct {
+			ServiceResponse struct {
+				ProxySuccess struct {
+					ProxyTicket string `json:"proxyTicket"`
+				} `json:"proxySuccess"`
+			} `json:"serviceResponse"`
+		}
+		if err := json.Unmarshal([]byte(body), &resp); err != nil || !strings.HasPrefix(resp.ServiceResponse.ProxySuccess.ProxyTicket, service.ProxyTicketPrefix) {
+			t.Errorf("proxy body = %s, want proxySuccess with a proxy ticket", body)
+		}
+	})
+}
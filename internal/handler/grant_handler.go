@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/joshleeeeee/go-lite-auth/internal/service"
+)
+
+// GrantHandler handles the grants users have given OAuth clients
+type GrantHandler struct {
+	oauthService *service.OAuthService
+}
+
+// NewGrantHandler creates a new GrantHandler instance
+func NewGrantHandler() *GrantHandler {
+	return &GrantHandler{
+		oauthService: service.NewOAuthService(),
+	}
+}
+
+// ListGrants returns the clients the current user has granted access to
+// GET /api/user/grants
+func (h *GrantHandler) ListGrants(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		unauthorized(c, "Unauthorized")
+		return
+	}
+
+	grants, err := h.oauthService.ListGrants(userID.(uint))
+	if err != nil {
+		fail(c, 500, "Internal server error")
+		return
+	}
+
+	success(c, grants)
+}
+
+// RevokeGrant withdraws the current user's grant to a client and revokes the client's tokens
+// DELETE /api/user/grants/:client_id
+func (h *GrantHandler) RevokeGrant(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		unauthorized(c, "Unauthorized")
+		return
+	}
+
+	err := h.oauthService.RevokeGrant(c.Request.Context(), userID.(uint), c.Param("client_id"))
+	if err != nil {
+		if err == service.ErrGrantNotFound {
+			fail(c, 404, err.Error())
+			return
+		}
+		fail(c, 500, "Internal server error")
+		return
+	}
+
+	success(c, nil)
+}
@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joshleeeeee/go-lite-auth/internal/service"
+)
+
+// MFAHandler handles two-factor authentication
+type MFAHandler struct {
+	mfaService *service.MFAService
+}
+
+// NewMFAHandler creates a new MFAHandler instance
+func NewMFAHandler() *MFAHandler {
+	return &MFAHandler{
+		mfaService: service.NewMFAService(),
+	}
+}
+
+// Verify completes a login with the mfa_token it returned and a TOTP or recovery code.
+// An SSO login also receives the SSO session cookie.
+// POST /api/auth/mfa/verify
+func (h *MFAHandler) Verify(c *gin.Context) {
+	var req service.MFAVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		fail(c, 400, "Invalid request: "+err.Error())
+		return
+	}
+
+	result, err := h.mfaService.VerifyLogin(c.Request.Context(), &req)
+	if err != nil {
+		fail(c, 401, err.Error())
+		return
+	}
+
+	loginSuccess(c, result)
+}
+
+// loginSuccess responds with a completed login; an SSO login also receives the SSO session cookie.
+// A login still waiting for its second factor only carries the mfa_token.
+func loginSuccess(c *gin.Context, result *service.LoginResult) {
+	if result.SSO != nil {
+		if result.SSO.MFARequired {
+			c.JSON(http.StatusOK, Response{
+				Code:    0,
+				Message: "MFA required",
+				Data:    result.SSO,
+			})
+			return
+		}
+		setTGTCookie(c, result.SSO.TGT)
+		c.JSON(http.StatusOK, Response{
+			Code:    0,
+			Message: "Login successful",
+			Data:    result.SSO,
+		})
+		return
+	}
+
+	success(c, result.Auth)
+}
+
+// Status returns the second factors of the current user
+// GET /api/user/mfa
+func (h *MFAHandler) Status(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		unauthorized(c, "Unauthorized")
+		return
+	}
+
+	status, err := h.mfaService.Status(userID.(uint))
+	if err != nil {
+		fail(c, 500, "Internal server error")
+		return
+	}
+
+	success(c, status)
+}
+
+// EnrollTOTP starts TOTP enrollment and returns the secret, otpauth URI and QR code
+// POST /api/user/mfa/totp
+func (h *MFAHandler) EnrollTOTP(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		unauthorized(c, "Unauthorized")
+		return
+	}
+
+	enrollment, err := h.mfaService.EnrollTOTP(userID.(uint))
+	if err != nil {
+		mfaFail(c, err)
+		return
+	}
+
+	success(c, enrollment)
+}
+
+// ConfirmTOTP enables TOTP with a first code and returns the recovery codes
+// POST /api/user/mfa/totp/confirm
+func (h *MFAHandler) ConfirmTOTP(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		unauthorized(c, "Unauthorized")
+		return
+	}
+
+	var req service.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		fail(c, 400, "Invalid request: "+err.Error())
+		return
+	}
+
+	codes, err := h.mfaService.ConfirmTOTP(c.Request.Context(), userID.(uint), req.Code)
+	if err != nil {
+		mfaFail(c, err)
+		return
+	}
+
+	success(c, gin.H{"recovery_codes": codes})
+}
+
+// DisableTOTP turns two-factor authentication off with a TOTP or recovery code
+// DELETE /api/user/mfa/totp
+func (h *MFAHandler) DisableTOTP(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		unauthorized(c, "Unauthorized")
+		return
+	}
+
+	var req service.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		fail(c, 400, "Invalid request: "+err.Error())
+		return
+	}
+
+	if err := h.mfaService.DisableTOTP(c.Request.Context(), userID.(uint), req.Code); err != nil {
+		mfaFail(c, err)
+		return
+	}
+
+	success(c, nil)
+}
+
+// mfaFail maps MFA enrollment errors to responses
+func mfaFail(c *gin.Context, err error) {
+	switch err {
+	case service.ErrUserNotFound:
+		fail(c, 404, err.Error())
+	case service.ErrTooManyMFAAttempts:
+		fail(c, 429, err.Error())
+	case service.ErrInvalidMFACode, service.ErrMFAAlreadyEnabled, service.ErrMFANotEnabled, service.ErrTOTPNotEnrolled:
+		fail(c, 400, err.Error())
+	default:
+		fail(c, 500, "Internal server error")
+	}
+}
@@ -0,0 +1,293 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joshleeeeee/go-lite-auth/internal/service"
+)
+
+// OAuthHandler handles OAuth 2.0 authorization server requests
+type OAuthHandler struct {
+	oauthService *service.OAuthService
+	ssoService   *service.SSOService
+}
+
+// NewOAuthHandler creates a new OAuthHandler instance
+func NewOAuthHandler() *OAuthHandler {
+	return &OAuthHandler{
+		oauthService: service.NewOAuthService(),
+		ssoService:   service.NewSSOService(),
+	}
+}
+
+// Authorize handles the authorization endpoint (authorization code flow with PKCE)
+// GET /oauth/authorize?response_type=code&client_id=xxx&redirect_uri=xxx&scope=xxx&state=xxx&code_challenge=xxx&code_challenge_method=S256[&nonce=xxx]
+func (h *OAuthHandler) Authorize(c *gin.Context) {
+	var req service.AuthorizeRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		oauthFail(c, http.StatusBadRequest, &service.OAuthError{Code: service.OAuthInvalidRequest, Description: err.Error()})
+		return
+	}
+
+	// Never redirect to an unverified redirect URI
+	client, err := h.oauthService.ResolveAuthorizeClient(&req)
+	if err != nil {
+		oauthFail(c, http.StatusBadRequest, err)
+		return
+	}
+
+	// The end-user is identified by the SSO session (TGT cookie)
+	session, user, err := h.ssoService.GetTGTSession(c.Request.Context(), getTGTCookie(c))
+	if err != nil {
+		if req.Prompt == "none" {
+			c.Redirect(http.StatusFound, service.AuthorizeErrorRedirect(req.RedirectURI, req.State,
+				&service.OAuthError{Code: service.OAuthLoginRequired}))
+			return
+		}
+		c.JSON(http.StatusUnauthorized, Response{
+			Code:    401,
+			Message: "Please login",
+			Data: gin.H{
+				"client":    client.Name,
+				"login_url": "/sso/login",
+			},
+		})
+		return
+	}
+
+	result, err := h.oauthService.Authorize(c.Request.Context(), client, &req, session, user)
+	if err != nil {
+		var oauthErr *service.OAuthError
+		if !errors.As(err, &oauthErr) {
+			oauthErr = &service.OAuthError{Code: service.OAuthServerError}
+		}
+		c.Redirect(http.StatusFound, service.AuthorizeErrorRedirect(req.RedirectURI, req.State, oauthErr))
+		return
+	}
+
+	// The user has to approve the requested scopes first, see Consent
+	if result.Consent != nil {
+		c.JSON(http.StatusOK, Response{
+			Code:    0,
+			Message: "Consent required",
+			Data:    result.Consent,
+		})
+		return
+	}
+
+	c.Redirect(http.StatusFound, result.RedirectURL)
+}
+
+// Consent answers the consent prompt of an authorization request
+// POST /oauth/consent (consent_challenge=xxx&action=approve|deny)
+func (h *OAuthHandler) Consent(c *gin.Context) {
+	var req struct {
+		ConsentChallenge string `form:"consent_challenge" json:"consent_challenge" binding:"required"`
+		Action           string `form:"action" json:"action" binding:"required,oneof=approve deny"`
+	}
+	if err := c.ShouldBind(&req); err != nil {
+		fail(c, 400, "Invalid request: "+err.Error())
+		return
+	}
+
+	_, user, err := h.ssoService.GetTGTSession(c.Request.Context(), getTGTCookie(c))
+	if err != nil {
+		loginRequired(c)
+		return
+	}
+
+	redirectURL, err := h.oauthService.Consent(c.Request.Context(), req.ConsentChallenge, req.Action == "approve", user)
+	if err != nil {
+		if err == service.ErrInvalidConsentChallenge {
+			fail(c, 400, err.Error())
+			return
+		}
+		fail(c, 500, "Internal server error")
+		return
+	}
+
+	// The user agent should follow redirect_url, as after an SSO login
+	success(c, gin.H{"redirect_url": redirectURL})
+}
+
+// Token handles the token endpoint
+// POST /oauth/token (application/x-www-form-urlencoded)
+func (h *OAuthHandler) Token(c *gin.Context) {
+	var req service.TokenRequest
+	if err := c.ShouldBind(&req); err != nil {
+		oauthFail(c, http.StatusBadRequest, &service.OAuthError{Code: service.OAuthInvalidRequest, Description: err.Error()})
+		return
+	}
+
+	clientCredentials(c, &req.ClientID, &req.ClientSecret)
+
+	resp, err := h.oauthService.Token(c.Request.Context(), &req)
+	if err != nil {
+		oauthFail(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+	c.JSON(http.StatusOK, resp)
+}
+
+// Introspect handles the token introspection endpoint (RFC 7662)
+// POST /oauth/introspect (application/x-www-form-urlencoded, client authentication required)
+func (h *OAuthHandler) Introspect(c *gin.Context) {
+	var req service.IntrospectionRequest
+	if err := c.ShouldBind(&req); err != nil {
+		oauthFail(c, http.StatusBadRequest, &service.OAuthError{Code: service.OAuthInvalidRequest, Description: err.Error()})
+		return
+	}
+
+	clientCredentials(c, &req.ClientID, &req.ClientSecret)
+
+	resp, err := h.oauthService.Introspect(c.Request.Context(), &req)
+	if err != nil {
+		oauthFail(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, resp)
+}
+
+// Revoke handles the token revocation endpoint (RFC 7009)
+// POST /oauth/revoke (application/x-www-form-urlencoded, client authentication required)
+func (h *OAuthHandler) Revoke(c *gin.Context) {
+	var req service.RevocationRequest
+	if err := c.ShouldBind(&req); err != nil {
+		oauthFail(c, http.StatusBadRequest, &service.OAuthError{Code: service.OAuthInvalidRequest, Description: err.Error()})
+		return
+	}
+
+	clientCredentials(c, &req.ClientID, &req.ClientSecret)
+
+	if err := h.oauthService.Revoke(c.Request.Context(), &req); err != nil {
+		oauthFail(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// DeviceAuthorization handles the device authorization endpoint (RFC 8628)
+// POST /oauth/device_authorization (application/x-www-form-urlencoded)
+func (h *OAuthHandler) DeviceAuthorization(c *gin.Context) {
+	var req service.DeviceAuthorizationRequest
+	if err := c.ShouldBind(&req); err != nil {
+		oauthFail(c, http.StatusBadRequest, &service.OAuthError{Code: service.OAuthInvalidRequest, Description: err.Error()})
+		return
+	}
+
+	clientCredentials(c, &req.ClientID, &req.ClientSecret)
+
+	resp, err := h.oauthService.DeviceAuthorization(c.Request.Context(), &req)
+	if err != nil {
+		oauthFail(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, resp)
+}
+
+// DeviceVerification shows the logged-in user which client a user code belongs to
+// GET /oauth/device?user_code=xxx
+func (h *OAuthHandler) DeviceVerification(c *gin.Context) {
+	if _, _, err := h.ssoService.GetTGTSession(c.Request.Context(), getTGTCookie(c)); err != nil {
+		loginRequired(c)
+		return
+	}
+
+	userCode := c.Query("user_code")
+	if userCode == "" {
+		success(c, gin.H{"user_code_required": true})
+		return
+	}
+
+	verification, err := h.oauthService.LookupDevice(c.Request.Context(), userCode)
+	if err != nil {
+		if err == service.ErrInvalidUserCode {
+			fail(c, 400, err.Error())
+			return
+		}
+		fail(c, 500, "Internal server error")
+		return
+	}
+
+	success(c, verification)
+}
+
+// DeviceVerificationSubmit approves or denies a device authorization for the logged-in user
+// POST /oauth/device (user_code=xxx&action=approve|deny)
+func (h *OAuthHandler) DeviceVerificationSubmit(c *gin.Context) {
+	var req struct {
+		UserCode string `form:"user_code" json:"user_code" binding:"required"`
+		Action   string `form:"action" json:"action" binding:"required,oneof=approve deny"`
+	}
+	if err := c.ShouldBind(&req); err != nil {
+		fail(c, 400, "Invalid request: "+err.Error())
+		return
+	}
+
+	session, user, err := h.ssoService.GetTGTSession(c.Request.Context(), getTGTCookie(c))
+	if err != nil {
+		loginRequired(c)
+		return
+	}
+
+	approve := req.Action == "approve"
+	if err := h.oauthService.VerifyDevice(c.Request.Context(), req.UserCode, approve, session, user); err != nil {
+		if err == service.ErrInvalidUserCode {
+			fail(c, 400, err.Error())
+			return
+		}
+		fail(c, 500, "Internal server error")
+		return
+	}
+
+	if approve {
+		success(c, gin.H{"message": "Device authorized, you may return to your device"})
+		return
+	}
+	success(c, gin.H{"message": "Device authorization denied"})
+}
+
+// loginRequired asks the user to sign in through SSO before answering a consent or device prompt
+func loginRequired(c *gin.Context) {
+	c.JSON(http.StatusUnauthorized, Response{
+		Code:    401,
+		Message: "Please login",
+		Data: gin.H{
+			"login_url": "/sso/login",
+		},
+	})
+}
+
+// clientCredentials prefers HTTP Basic client authentication (client_secret_basic) over form fields
+func clientCredentials(c *gin.Context, clientID, clientSecret *string) {
+	if id, secret, ok := c.Request.BasicAuth(); ok {
+		*clientID, *clientSecret = id, secret
+	}
+}
+
+// oauthFail writes an RFC 6749 error response
+func oauthFail(c *gin.Context, statusCode int, err error) {
+	var oauthErr *service.OAuthError
+	if !errors.As(err, &oauthErr) {
+		oauthErr = &service.OAuthError{Code: service.OAuthServerError}
+		statusCode = http.StatusInternalServerError
+	}
+
+	if oauthErr.Code == service.OAuthInvalidClient {
+		statusCode = http.StatusUnauthorized
+		c.Header("WWW-Authenticate", `Basic realm="lite-auth"`)
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(statusCode, oauthErr)
+}
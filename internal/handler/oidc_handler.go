@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joshleeeeee/go-lite-auth/internal/repository"
+	"github.com/joshleeeeee/go-lite-auth/internal/service"
+	"github.com/joshleeeeee/go-lite-auth/pkg/jwt"
+)
+
+// OIDCHandler handles OpenID Connect provider requests
+type OIDCHandler struct {
+	oidcService *service.OIDCService
+}
+
+// NewOIDCHandler creates a new OIDCHandler instance
+func NewOIDCHandler() *OIDCHandler {
+	return &OIDCHandler{
+		oidcService: service.NewOIDCService(),
+	}
+}
+
+// Discovery serves the OpenID Provider metadata
+// GET /.well-known/openid-configuration
+func (h *OIDCHandler) Discovery(c *gin.Context) {
+	c.JSON(http.StatusOK, h.oidcService.Discovery())
+}
+
+// JWKS serves the public keys used to verify ID tokens
+// GET /jwks.json
+func (h *OIDCHandler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.JSON(http.StatusOK, jwt.JWKS())
+}
+
+// UserInfo returns the claims about the authenticated user allowed by the access token's scopes
+// GET/POST /oauth/userinfo (requires an access token with the openid scope)
+func (h *OIDCHandler) UserInfo(c *gin.Context) {
+	claims := c.MustGet("claims").(*jwt.Claims)
+
+	info, err := h.oidcService.UserInfo(claims)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInsufficientScope):
+			c.Header("WWW-Authenticate", `Bearer error="insufficient_scope", scope="openid"`)
+			c.JSON(http.StatusForbidden, service.OAuthError{Code: service.OAuthInsufficientScope, Description: err.Error()})
+		case errors.Is(err, repository.ErrUserNotFound), errors.Is(err, service.ErrUserDisabled):
+			c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+			c.JSON(http.StatusUnauthorized, service.OAuthError{Code: service.OAuthInvalidToken, Description: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, service.OAuthError{Code: service.OAuthServerError})
+		}
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, info)
+}
@@ -0,0 +1,196 @@
+package handler
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joshleeeeee/go-lite-auth/internal/service"
+)
+
+// PasskeyHandler handles WebAuthn passkeys. The finish endpoints take the PublicKeyCredential
+// returned by the browser, serialized as JSON, as the request body.
+type PasskeyHandler struct {
+	webauthnService *service.WebAuthnService
+}
+
+// NewPasskeyHandler creates a new PasskeyHandler instance
+func NewPasskeyHandler() *PasskeyHandler {
+	return &PasskeyHandler{
+		webauthnService: service.NewWebAuthnService(),
+	}
+}
+
+// BeginRegistration returns the options of navigator.credentials.create() for a new passkey,
+// confirmed with the password or a TOTP or recovery code
+// POST /api/user/passkeys/register/begin
+func (h *PasskeyHandler) BeginRegistration(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		unauthorized(c, "Unauthorized")
+		return
+	}
+
+	var req service.PasskeyChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		fail(c, 400, "Invalid request: "+err.Error())
+		return
+	}
+
+	creation, err := h.webauthnService.BeginRegistration(c.Request.Context(), userID.(uint), &req)
+	if err != nil {
+		passkeyFail(c, err)
+		return
+	}
+
+	success(c, creation)
+}
+
+// FinishRegistration stores the passkey created by the browser, named by the name query parameter
+// POST /api/user/passkeys/register/finish?name=
+func (h *PasskeyHandler) FinishRegistration(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		unauthorized(c, "Unauthorized")
+		return
+	}
+
+	registration, err := h.webauthnService.FinishRegistration(c.Request.Context(), userID.(uint), c.Query("name"), c.Request.Body)
+	if err != nil {
+		passkeyFail(c, err)
+		return
+	}
+
+	success(c, registration)
+}
+
+// ListPasskeys returns the passkeys of the current user
+// GET /api/user/passkeys
+func (h *PasskeyHandler) ListPasskeys(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		unauthorized(c, "Unauthorized")
+		return
+	}
+
+	passkeys, err := h.webauthnService.ListPasskeys(userID.(uint))
+	if err != nil {
+		fail(c, 500, "Internal server error")
+		return
+	}
+
+	success(c, passkeys)
+}
+
+// DeletePasskey removes a passkey of the current user, confirmed with the password or a TOTP or recovery code
+// DELETE /api/user/passkeys/:id
+func (h *PasskeyHandler) DeletePasskey(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		unauthorized(c, "Unauthorized")
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		fail(c, 400, "Invalid passkey ID")
+		return
+	}
+
+	var req service.PasskeyChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		fail(c, 400, "Invalid request: "+err.Error())
+		return
+	}
+
+	if err := h.webauthnService.DeletePasskey(c.Request.Context(), userID.(uint), uint(id), &req); err != nil {
+		passkeyFail(c, err)
+		return
+	}
+
+	success(c, nil)
+}
+
+// BeginLogin returns the options of navigator.credentials.get() for a passwordless login.
+// With a service (body or query parameter), the login issues a Service Ticket.
+// POST /api/auth/passkey/begin
+func (h *PasskeyHandler) BeginLogin(c *gin.Context) {
+	var req service.PasskeyLoginRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBind(&req); err != nil {
+			fail(c, 400, "Invalid request: "+err.Error())
+			return
+		}
+	}
+	if req.Service == "" {
+		req.Service = c.Query("service")
+	}
+
+	assertion, err := h.webauthnService.BeginLogin(c.Request.Context(), &req)
+	if err != nil {
+		if err == service.ErrInvalidService {
+			fail(c, 400, "Service is not registered")
+			return
+		}
+		fail(c, 500, "Internal server error")
+		return
+	}
+
+	success(c, assertion)
+}
+
+// FinishLogin completes a passwordless login. An SSO login also receives the SSO session cookie.
+// POST /api/auth/passkey/finish
+func (h *PasskeyHandler) FinishLogin(c *gin.Context) {
+	result, err := h.webauthnService.FinishLogin(c.Request.Context(), c.Request.Body)
+	if err != nil {
+		fail(c, 401, err.Error())
+		return
+	}
+
+	loginSuccess(c, result)
+}
+
+// BeginMFA returns the options of navigator.credentials.get() to complete an mfa_token with a passkey
+// POST /api/auth/mfa/passkey/begin
+func (h *PasskeyHandler) BeginMFA(c *gin.Context) {
+	var req service.PasskeyMFARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		fail(c, 400, "Invalid request: "+err.Error())
+		return
+	}
+
+	assertion, err := h.webauthnService.BeginMFA(c.Request.Context(), &req)
+	if err != nil {
+		fail(c, 401, err.Error())
+		return
+	}
+
+	success(c, assertion)
+}
+
+// FinishMFA completes the login of an mfa_token with the passkey assertion
+// POST /api/auth/mfa/passkey/finish
+func (h *PasskeyHandler) FinishMFA(c *gin.Context) {
+	result, err := h.webauthnService.FinishMFA(c.Request.Context(), c.Request.Body)
+	if err != nil {
+		fail(c, 401, err.Error())
+		return
+	}
+
+	loginSuccess(c, result)
+}
+
+// passkeyFail maps passkey management errors to responses
+func passkeyFail(c *gin.Context, err error) {
+	switch err {
+	case service.ErrUserNotFound, service.ErrPasskeyNotFound:
+		fail(c, 404, err.Error())
+	case service.ErrTooManyMFAAttempts:
+		fail(c, 429, err.Error())
+	case service.ErrInvalidWebAuthnChallenge, service.ErrInvalidWebAuthnResponse, service.ErrPasskeyRegistered, service.ErrInvalidPasskeyName,
+		service.ErrReauthRequired, service.ErrWrongPassword, service.ErrInvalidMFACode:
+		fail(c, 400, err.Error())
+	default:
+		fail(c, 500, "Internal server error")
+	}
+}
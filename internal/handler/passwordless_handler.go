@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/joshleeeeee/go-lite-auth/internal/service"
+)
+
+// PasswordlessHandler handles logins with a magic link or an email OTP
+type PasswordlessHandler struct {
+	passwordlessService *service.PasswordlessService
+}
+
+// NewPasswordlessHandler creates a new PasswordlessHandler instance
+func NewPasswordlessHandler() *PasswordlessHandler {
+	return &PasswordlessHandler{
+		passwordlessService: service.NewPasswordlessService(),
+	}
+}
+
+// SendMagicLink emails a sign-in link; the response does not reveal whether the email exists
+// POST /api/auth/magic-link
+func (h *PasswordlessHandler) SendMagicLink(c *gin.Context) {
+	var req service.PasswordlessRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		fail(c, 400, "Invalid request: "+err.Error())
+		return
+	}
+
+	if err := h.passwordlessService.SendMagicLink(c.Request.Context(), &req, c.ClientIP()); err != nil {
+		passwordlessFail(c, err)
+		return
+	}
+
+	success(c, nil)
+}
+
+// VerifyMagicLink completes a login with the token of a magic link.
+// An SSO login also receives the SSO session cookie.
+// POST /api/auth/magic-link/verify
+func (h *PasswordlessHandler) VerifyMagicLink(c *gin.Context) {
+	var req service.MagicLinkVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		fail(c, 400, "Invalid request: "+err.Error())
+		return
+	}
+
+	result, err := h.passwordlessService.VerifyMagicLink(c.Request.Context(), &req, c.ClientIP())
+	if err != nil {
+		fail(c, 401, err.Error())
+		return
+	}
+
+	loginSuccess(c, result)
+}
+
+// SendEmailOTP emails a sign-in code; the response does not reveal whether the email exists
+// POST /api/auth/email-otp
+func (h *PasswordlessHandler) SendEmailOTP(c *gin.Context) {
+	var req service.PasswordlessRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		fail(c, 400, "Invalid request: "+err.Error())
+		return
+	}
+
+	if err := h.passwordlessService.SendEmailOTP(c.Request.Context(), &req, c.ClientIP()); err != nil {
+		passwordlessFail(c, err)
+		return
+	}
+
+	success(c, nil)
+}
+
+// VerifyEmailOTP completes a login with an emailed code.
+// An SSO login also receives the SSO session cookie.
+// POST /api/auth/email-otp/verify
+func (h *PasswordlessHandler) VerifyEmailOTP(c *gin.Context) {
+	var req service.EmailOTPVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		fail(c, 400, "Invalid request: "+err.Error())
+		return
+	}
+
+	result, err := h.passwordlessService.VerifyEmailOTP(c.Request.Context(), &req, c.ClientIP())
+	if err != nil {
+		fail(c, 401, err.Error())
+		return
+	}
+
+	loginSuccess(c, result)
+}
+
+// passwordlessFail maps errors of sign-in email requests to responses
+func passwordlessFail(c *gin.Context, err error) {
+	switch err {
+	case service.ErrInvalidService:
+		fail(c, 400, "Service is not registered")
+	case service.ErrTooManyLoginEmails:
+		fail(c, 429, err.Error())
+	default:
+		fail(c, 500, "Internal server error")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/joshleeeeee/go-lite-auth/internal/config"
 	"github.com/joshleeeeee/go-lite-auth/internal/service"
 )
 
@@ -21,6 +22,8 @@ func NewSSOHandler() *SSOHandler {
 
 // Login handles SSO login requests
 // GET /sso/login?service=xxx - Check login state, redirect if already logged in
+// GET /sso/login?service=xxx&renew=true - Ignore the existing session and ask for credentials
+// GET /sso/login?service=xxx&gateway=true - Never ask for credentials, redirect back with or without a ticket
 // POST /sso/login - Process login form, generate ST and redirect
 func (h *SSOHandler) Login(c *gin.Context) {
 	serviceURL := c.Query("service")
@@ -32,8 +35,41 @@ func (h *SSOHandler) Login(c *gin.Context) {
 		return
 	}
 
-	// For GET request, show login page info (or redirect if already logged in)
-	// In a real implementation, you would check for TGT cookie here
+	if err := h.ssoService.CheckService(serviceURL); err != nil {
+		statusCode := http.StatusInternalServerError
+		if err == service.ErrInvalidService {
+			statusCode = http.StatusBadRequest
+		}
+		c.JSON(statusCode, Response{
+			Code:    statusCode,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	// renew bypasses single sign-on, and takes precedence over gateway
+	renew := queryFlag(c, "renew")
+	gateway := queryFlag(c, "gateway") && !renew
+
+	// Reuse the existing SSO session if the browser presents a valid TGT
+	if tgt := getTGTCookie(c); tgt != "" && !renew {
+		resp, err := h.ssoService.LoginWithTGT(c.Request.Context(), tgt, serviceURL)
+		if err == nil {
+			c.Redirect(http.StatusFound, resp.RedirectURL)
+			return
+		}
+		if err == service.ErrTGTNotFound || err == service.ErrUserDisabled {
+			clearTGTCookie(c)
+		}
+	}
+
+	// Gateway requests go back to the service without a ticket when there is no session
+	if gateway {
+		c.Redirect(http.StatusFound, serviceURL)
+		return
+	}
+
+	// No SSO session yet, the user has to submit credentials
 	c.JSON(http.StatusOK, Response{
 		Code:    0,
 		Message: "Please login",
@@ -72,6 +108,18 @@ func (h *SSOHandler) LoginSubmit(c *gin.Context) {
 		return
 	}
 
+	// The SSO session only starts once the second factor is verified at /api/auth/mfa/verify
+	if resp.MFARequired {
+		c.JSON(http.StatusOK, Response{
+			Code:    0,
+			Message: "MFA required",
+			Data:    resp,
+		})
+		return
+	}
+
+	setTGTCookie(c, resp.TGT)
+
 	// Return ticket and redirect URL
 	// Client applications should redirect to resp.RedirectURL
 	c.JSON(http.StatusOK, Response{
@@ -103,7 +151,11 @@ func (h *SSOHandler) ValidateTicket(c *gin.Context) {
 		return
 	}
 
-	userInfo, err := h.ssoService.ValidateServiceTicket(c.Request.Context(), ticket, serviceURL)
+	userInfo, err := h.ssoService.ValidateTicket(c.Request.Context(), &service.TicketValidation{
+		Ticket:  ticket,
+		Service: serviceURL,
+		Renew:   queryFlag(c, "renew"),
+	})
 	if err != nil {
 		statusCode := http.StatusUnauthorized
 		message := "Invalid or expired ticket"
@@ -114,6 +166,11 @@ func (h *SSOHandler) ValidateTicket(c *gin.Context) {
 		case service.ErrServiceMismatch:
 			message = "Service URL mismatch"
 			statusCode = http.StatusBadRequest
+		case service.ErrInvalidService:
+			message = "Service is not registered"
+			statusCode = http.StatusBadRequest
+		case service.ErrTicketNotRenewed:
+			message = "Ticket was not issued from a new login"
 		}
 
 		c.JSON(statusCode, Response{
@@ -130,21 +187,58 @@ func (h *SSOHandler) ValidateTicket(c *gin.Context) {
 	})
 }
 
-// Logout handles SSO logout
+// Logout handles SSO logout (Single Logout)
 // GET /sso/logout?service=xxx
 func (h *SSOHandler) Logout(c *gin.Context) {
 	serviceURL := c.Query("service")
 
-	// In a full implementation, you would:
-	// 1. Clear TGT cookie
-	// 2. Notify all registered services to clear their sessions (SLO)
-	// 3. Redirect to service URL if provided
+	// Destroy the TGT and notify every service that was issued a ticket under it
+	if err := h.ssoService.Logout(c.Request.Context(), getTGTCookie(c)); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: "Logout failed",
+		})
+		return
+	}
+	clearTGTCookie(c)
+
+	// Only redirect to registered services to avoid an open redirect
+	if serviceURL != "" && h.ssoService.CheckService(serviceURL) == nil {
+		c.Redirect(http.StatusFound, serviceURL)
+		return
+	}
 
 	c.JSON(http.StatusOK, Response{
 		Code:    0,
 		Message: "Logged out successfully",
-		Data: gin.H{
-			"redirect_url": serviceURL,
-		},
 	})
 }
+
+// queryFlag reports whether a CAS boolean parameter such as renew or gateway is set
+func queryFlag(c *gin.Context, name string) bool {
+	value, ok := c.GetQuery(name)
+	return ok && value != "false" && value != "0"
+}
+
+// getTGTCookie returns the Ticket-Granting Ticket presented by the browser
+func getTGTCookie(c *gin.Context) string {
+	tgt, err := c.Cookie(config.GlobalConfig.SSO.CookieName)
+	if err != nil {
+		return ""
+	}
+	return tgt
+}
+
+// setTGTCookie stores the Ticket-Granting Ticket in a secure, HTTP-only cookie
+func setTGTCookie(c *gin.Context, tgt string) {
+	cfg := config.GlobalConfig.SSO
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(cfg.CookieName, tgt, cfg.TGTExpire, "/", cfg.CookieDomain, cfg.CookieSecure, true)
+}
+
+// clearTGTCookie removes the Ticket-Granting Ticket cookie from the browser
+func clearTGTCookie(c *gin.Context) {
+	cfg := config.GlobalConfig.SSO
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(cfg.CookieName, "", -1, "/", cfg.CookieDomain, cfg.CookieSecure, true)
+}
@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/joshleeeeee/go-lite-auth/internal/service"
+)
+
+// UserHandler handles self-service changes to the current user's account
+type UserHandler struct {
+	userService *service.UserService
+}
+
+// NewUserHandler creates a new UserHandler instance
+func NewUserHandler() *UserHandler {
+	return &UserHandler{
+		userService: service.NewUserService(),
+	}
+}
+
+// UpdateUserInfo updates the current user's nickname, avatar or email
+// PATCH /api/user/info
+func (h *UserHandler) UpdateUserInfo(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		unauthorized(c, "Unauthorized")
+		return
+	}
+
+	var req service.UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		fail(c, 400, "Invalid request: "+err.Error())
+		return
+	}
+
+	user, err := h.userService.UpdateProfile(c.Request.Context(), userID.(uint), &req)
+	if err != nil {
+		userFail(c, err)
+		return
+	}
+
+	success(c, user)
+}
+
+// ChangePassword changes the current user's password and ends their other sessions
+// POST /api/user/password
+func (h *UserHandler) ChangePassword(c *gin.Context) {
+	claims := GetClaims(c)
+	if claims == nil || claims.UserID == 0 {
+		unauthorized(c, "Unauthorized")
+		return
+	}
+
+	var req service.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		fail(c, 400, "Invalid request: "+err.Error())
+		return
+	}
+
+	// The browser's own SSO session survives, like the token used for this request
+	if err := h.userService.ChangePassword(c.Request.Context(), claims, getTGTCookie(c), &req); err != nil {
+		userFail(c, err)
+		return
+	}
+
+	success(c, nil)
+}
+
+// ForgotPassword emails a password reset link. The response is the same whether or not the
+// email belongs to an account.
+// POST /api/auth/password/forgot
+func (h *UserHandler) ForgotPassword(c *gin.Context) {
+	var req service.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		fail(c, 400, "Invalid request: "+err.Error())
+		return
+	}
+
+	if err := h.userService.ForgotPassword(c.Request.Context(), &req); err != nil {
+		fail(c, 500, "Internal server error")
+		return
+	}
+
+	success(c, gin.H{"message": "If the email belongs to an account, a password reset link has been sent"})
+}
+
+// ResetPassword sets a new password with an emailed reset token
+// POST /api/auth/password/reset
+func (h *UserHandler) ResetPassword(c *gin.Context) {
+	var req service.ResetPasswordWithTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		fail(c, 400, "Invalid request: "+err.Error())
+		return
+	}
+
+	if err := h.userService.ResetPassword(c.Request.Context(), &req); err != nil {
+		userFail(c, err)
+		return
+	}
+
+	success(c, nil)
+}
+
+// VerifyEmail verifies the email address a verification link was sent to
+// GET /api/auth/email/verify?token=xxx
+func (h *UserHandler) VerifyEmail(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		fail(c, 400, "token is required")
+		return
+	}
+
+	user, err := h.userService.VerifyEmail(token)
+	if err != nil {
+		userFail(c, err)
+		return
+	}
+
+	success(c, gin.H{"email": user.Email, "email_verified_at": user.EmailVerifiedAt})
+}
+
+// ResendVerification emails a new verification link. The response is the same whether or not
+// the email belongs to an unverified account.
+// POST /api/auth/email/resend
+func (h *UserHandler) ResendVerification(c *gin.Context) {
+	var req service.ResendVerificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		fail(c, 400, "Invalid request: "+err.Error())
+		return
+	}
+
+	if err := h.userService.ResendVerification(c.Request.Context(), &req); err != nil {
+		fail(c, 500, "Internal server error")
+		return
+	}
+
+	success(c, gin.H{"message": "If the email belongs to an unverified account, a verification link has been sent"})
+}
+
+// userFail maps profile service errors to responses
+func userFail(c *gin.Context, err error) {
+	switch err {
+	case service.ErrUserNotFound:
+		fail(c, 404, err.Error())
+	case service.ErrUserDisabled:
+		fail(c, 403, err.Error())
+	case service.ErrTooManyPasswordAttempts:
+		fail(c, 429, err.Error())
+	case service.ErrEmailTaken, service.ErrInvalidAvatar, service.ErrWrongPassword, service.ErrPasswordUnchanged,
+		service.ErrInvalidResetToken, service.ErrInvalidVerificationToken:
+		fail(c, 400, err.Error())
+	default:
+		fail(c, 500, "Internal server error")
+	}
+}
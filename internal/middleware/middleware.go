@@ -4,7 +4,7 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/joshleeeeee/go-lite-auth/internal/database"
+	"github.com/joshleeeeee/go-lite-auth/internal/service"
 	"github.com/joshleeeeee/go-lite-auth/pkg/jwt"
 )
 
@@ -42,9 +42,9 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// Check if token is blacklisted
-		isBlacklisted, err := database.IsBlacklisted(c.Request.Context(), claims.TokenID)
-		if err != nil || isBlacklisted {
+		// Check if token, or the refresh token it was issued with, is revoked
+		isRevoked, err := service.IsTokenRevoked(c.Request.Context(), claims)
+		if err != nil || isRevoked {
 			c.JSON(401, gin.H{
 				"code":    401,
 				"message": "Token has been revoked",
@@ -53,15 +53,109 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// Set user info in context
-		c.Set("userID", claims.UserID)
-		c.Set("username", claims.Username)
+		// Set user info in context; client credentials tokens have a client but no user
+		if !claims.IsClientToken() {
+			c.Set("userID", claims.UserID)
+			c.Set("username", claims.Username)
+		}
+		if claims.ClientID != "" {
+			c.Set("clientID", claims.ClientID)
+		}
 		c.Set("claims", claims)
 
 		c.Next()
 	}
 }
 
+// RequireScope admits first-party tokens, and OAuth client tokens only when they carry the scope.
+// It must run after AuthMiddleware.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := requireClaims(c)
+		if !ok {
+			return
+		}
+
+		// Tokens from /api/auth/login are not issued to a client and are not scoped
+		if claims.ClientID != "" {
+			granted := false
+			for _, s := range strings.Fields(claims.Scope) {
+				if s == scope {
+					granted = true
+					break
+				}
+			}
+			if !granted {
+				c.JSON(403, gin.H{
+					"code":    403,
+					"message": "Insufficient scope",
+				})
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// RequireRole admits tokens whose user has at least one of the roles.
+// It must run after AuthMiddleware.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := requireClaims(c)
+		if !ok {
+			return
+		}
+
+		for _, role := range claims.Roles {
+			for _, required := range roles {
+				if role == required {
+					c.Next()
+					return
+				}
+			}
+		}
+
+		c.JSON(403, gin.H{
+			"code":    403,
+			"message": "Permission denied",
+		})
+		c.Abort()
+	}
+}
+
+// RequirePermission admits tokens whose roles grant the permission, e.g. "users:write".
+// It must run after AuthMiddleware.
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := requireClaims(c)
+		if !ok {
+			return
+		}
+
+		granted, err := service.HasPermission(claims.Roles, permission)
+		if err != nil {
+			c.JSON(500, gin.H{
+				"code":    500,
+				"message": "Internal server error",
+			})
+			c.Abort()
+			return
+		}
+		if !granted {
+			c.JSON(403, gin.H{
+				"code":    403,
+				"message": "Permission denied",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
 // CORSMiddleware handles CORS
 func CORSMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -84,6 +178,20 @@ func RecoveryMiddleware() gin.HandlerFunc {
 	return gin.Recovery()
 }
 
+// requireClaims returns the claims set by AuthMiddleware, or aborts with 401 when there are none
+func requireClaims(c *gin.Context) (*jwt.Claims, bool) {
+	value, _ := c.Get("claims")
+	claims, ok := value.(*jwt.Claims)
+	if !ok {
+		c.JSON(401, gin.H{
+			"code":    401,
+			"message": "Authorization token required",
+		})
+		c.Abort()
+	}
+	return claims, ok
+}
+
 func extractToken(c *gin.Context) string {
 	// First try Authorization header
 	authHeader := c.GetHeader("Authorization")
@@ -8,36 +8,171 @@ import (
 
 // User represents a user in the system
 type User struct {
-	ID        uint           `gorm:"primarykey" json:"id"`
-	Username  string         `gorm:"uniqueIndex;size:50;not null" json:"username"`
-	Email     string         `gorm:"uniqueIndex;size:100;not null" json:"email"`
-	Password  string         `gorm:"size:255;not null" json:"-"` // never expose password
-	Nickname  string         `gorm:"size:50" json:"nickname"`
-	Avatar    string         `gorm:"size:255" json:"avatar"`
-	Status    int            `gorm:"default:1" json:"status"` // 1: active, 0: disabled
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	ID              uint           `gorm:"primarykey" json:"id"`
+	Username        string         `gorm:"uniqueIndex;size:50;not null" json:"username"`
+	Email           string         `gorm:"uniqueIndex;size:100;not null" json:"email"`
+	EmailVerifiedAt *time.Time     `json:"email_verified_at"`          // nil until the email address is verified
+	Password        string         `gorm:"size:255;not null" json:"-"` // never expose password
+	Nickname        string         `gorm:"size:50" json:"nickname"`
+	Avatar          string         `gorm:"size:255" json:"avatar"`
+	Status          int            `gorm:"default:1" json:"status"` // 1: active, 0: disabled
+	Roles           []Role         `gorm:"many2many:user_roles;" json:"roles,omitempty"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
 func (User) TableName() string {
 	return "users"
 }
 
+// Role is a named set of permissions that can be assigned to users
+type Role struct {
+	ID          uint         `gorm:"primarykey" json:"id"`
+	Name        string       `gorm:"uniqueIndex;size:50;not null" json:"name"`
+	Description string       `gorm:"size:255" json:"description"`
+	Permissions []Permission `gorm:"many2many:role_permissions;" json:"permissions,omitempty"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+}
+
+func (Role) TableName() string {
+	return "roles"
+}
+
+// Permission is a "resource:action" capability such as users:write.
+// "resource:*" grants every action on the resource and "*" grants everything.
+type Permission struct {
+	ID          uint      `gorm:"primarykey" json:"id"`
+	Name        string    `gorm:"uniqueIndex;size:100;not null" json:"name"`
+	Description string    `gorm:"size:255" json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func (Permission) TableName() string {
+	return "permissions"
+}
+
 // Client represents an OAuth client application
 type Client struct {
-	ID           uint           `gorm:"primarykey" json:"id"`
-	ClientID     string         `gorm:"uniqueIndex;size:100;not null" json:"client_id"`
-	ClientSecret string         `gorm:"size:255;not null" json:"-"`
-	Name         string         `gorm:"size:100;not null" json:"name"`
-	RedirectURI  string         `gorm:"size:500;not null" json:"redirect_uri"`
-	Description  string         `gorm:"size:500" json:"description"`
-	Status       int            `gorm:"default:1" json:"status"`
-	CreatedAt    time.Time      `json:"created_at"`
-	UpdatedAt    time.Time      `json:"updated_at"`
-	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
+	ID                uint               `gorm:"primarykey" json:"id"`
+	ClientID          string             `gorm:"uniqueIndex;size:100;not null" json:"client_id"`
+	ClientSecret      string             `gorm:"size:255;not null" json:"-"` // pkg/hasher hash; plaintext values are hashed at startup
+	Name              string             `gorm:"size:100;not null" json:"name"`
+	RedirectURI       string             `gorm:"size:500;not null" json:"redirect_uri"`
+	Description       string             `gorm:"size:500" json:"description"`
+	Status            int                `gorm:"default:1" json:"status"`
+	Public            bool               `gorm:"default:false" json:"public"`        // public OAuth clients have no secret and must use PKCE S256
+	SSOEnabled        *bool              `gorm:"default:true" json:"sso_enabled"`    // may receive SSO Service Tickets; a pointer so that false is not replaced by the default on create
+	TicketTTL         int                `gorm:"default:0" json:"ticket_ttl"`        // Service Ticket TTL in seconds, 0 uses the default
+	AllowedAttributes string             `gorm:"size:500" json:"allowed_attributes"` // comma-separated, "*" releases all, empty releases the defaults
+	AttributeRenames  string             `gorm:"size:500" json:"attribute_renames"`  // comma-separated "name=released_name" pairs
+	ServiceURIs       []ClientServiceURI `gorm:"foreignKey:ClientID;references:ClientID" json:"service_uris,omitempty"`
+	Scopes            []ClientScope      `gorm:"foreignKey:ClientID;references:ClientID" json:"scopes,omitempty"`
+	CreatedAt         time.Time          `json:"created_at"`
+	UpdatedAt         time.Time          `json:"updated_at"`
+	DeletedAt         gorm.DeletedAt     `gorm:"index" json:"-"`
 }
 
 func (Client) TableName() string {
 	return "clients"
 }
+
+// Service URI match types
+const (
+	MatchExact  = "exact"
+	MatchPrefix = "prefix"
+	MatchRegex  = "regex"
+)
+
+// ClientServiceURI is an additional service URL pattern a client accepts SSO tickets at
+type ClientServiceURI struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	ClientID  string    `gorm:"index;size:100;not null" json:"client_id"`
+	Pattern   string    `gorm:"size:500;not null" json:"pattern"`
+	MatchType string    `gorm:"size:20;default:exact" json:"match_type"` // exact, prefix or regex
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (ClientServiceURI) TableName() string {
+	return "client_service_uris"
+}
+
+// ClientScope is an OAuth scope a client may request, with the text shown on the consent screen
+type ClientScope struct {
+	ID          uint      `gorm:"primarykey" json:"id"`
+	ClientID    string    `gorm:"uniqueIndex:idx_client_scope;size:100;not null" json:"client_id"`
+	Name        string    `gorm:"uniqueIndex:idx_client_scope;size:100;not null" json:"name"`
+	Description string    `gorm:"size:255" json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func (ClientScope) TableName() string {
+	return "client_scopes"
+}
+
+// UserGrant remembers the scopes a user has consented to for a client
+type UserGrant struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	UserID    uint      `gorm:"uniqueIndex:idx_user_client;not null" json:"user_id"`
+	ClientID  string    `gorm:"uniqueIndex:idx_user_client;size:100;not null" json:"client_id"`
+	Scope     string    `gorm:"size:1000" json:"scope"` // space-separated granted scopes
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (UserGrant) TableName() string {
+	return "user_grants"
+}
+
+// UserTOTP is the TOTP authenticator of a user; enrollment is pending until ConfirmedAt is set
+type UserTOTP struct {
+	ID          uint       `gorm:"primarykey" json:"id"`
+	UserID      uint       `gorm:"uniqueIndex;not null" json:"user_id"`
+	Secret      string     `gorm:"size:64;not null" json:"-"` // base32, never expose
+	ConfirmedAt *time.Time `json:"confirmed_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+func (UserTOTP) TableName() string {
+	return "user_totps"
+}
+
+// RecoveryCode is a one-time code that replaces a TOTP code when the authenticator is lost
+type RecoveryCode struct {
+	ID        uint       `gorm:"primarykey" json:"id"`
+	UserID    uint       `gorm:"index;not null" json:"user_id"`
+	CodeHash  string     `gorm:"size:64;not null" json:"-"` // SHA-256 of the code
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func (RecoveryCode) TableName() string {
+	return "recovery_codes"
+}
+
+// WebAuthnCredential is a passkey or security key registered by a user
+type WebAuthnCredential struct {
+	ID              uint       `gorm:"primarykey" json:"id"`
+	UserID          uint       `gorm:"index;not null" json:"user_id"`
+	CredentialID    string     `gorm:"uniqueIndex;size:255;not null" json:"credential_id"` // base64url, unpadded
+	PublicKey       []byte     `gorm:"not null" json:"-"`                                  // COSE key
+	AttestationType string     `gorm:"size:32" json:"attestation_type"`
+	Transports      string     `gorm:"size:100" json:"transports"` // comma-separated, e.g. "internal,hybrid"
+	AAGUID          string     `gorm:"size:36" json:"aaguid"`      // authenticator model
+	SignCount       uint32     `json:"sign_count"`
+	BackupEligible  bool       `json:"backup_eligible"`
+	BackupState     bool       `json:"backup_state"` // synced to other devices
+	Name            string     `gorm:"size:50" json:"name"`
+	LastUsedAt      *time.Time `json:"last_used_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+func (WebAuthnCredential) TableName() string {
+	return "webauthn_credentials"
+}
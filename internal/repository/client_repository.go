@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/joshleeeeee/go-lite-auth/internal/database"
+	"github.com/joshleeeeee/go-lite-auth/internal/model"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrClientNotFound = errors.New("client not found")
+)
+
+type ClientRepository struct{}
+
+func NewClientRepository() *ClientRepository {
+	return &ClientRepository{}
+}
+
+// GetByClientID finds a client by its public client ID
+func (r *ClientRepository) GetByClientID(clientID string) (*model.Client, error) {
+	var client model.Client
+	if err := database.DB.Preload("ServiceURIs").Preload("Scopes").Where("client_id = ?", clientID).First(&client).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrClientNotFound
+		}
+		return nil, err
+	}
+	return &client, nil
+}
+
+// ListSSOEnabled returns all active clients that may receive SSO tickets, with their service URIs
+func (r *ClientRepository) ListSSOEnabled() ([]model.Client, error) {
+	var clients []model.Client
+	err := database.DB.Preload("ServiceURIs").
+		Where("status = ? AND sso_enabled = ?", 1, true).
+		Order("id").
+		Find(&clients).Error
+	return clients, err
+}
+
+// ListConfidential returns the clients that have a secret
+func (r *ClientRepository) ListConfidential() ([]model.Client, error) {
+	var clients []model.Client
+	err := database.DB.Where("client_secret <> ''").Order("id").Find(&clients).Error
+	return clients, err
+}
+
+// UpdateSecret replaces the secret hash of a client, leaving the other columns untouched
+func (r *ClientRepository) UpdateSecret(id uint, hash string) error {
+	return database.DB.Model(&model.Client{}).Where("id = ?", id).Update("client_secret", hash).Error
+}
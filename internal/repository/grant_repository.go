@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/joshleeeeee/go-lite-auth/internal/database"
+	"github.com/joshleeeeee/go-lite-auth/internal/model"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrGrantNotFound = errors.New("grant not found")
+)
+
+type GrantRepository struct{}
+
+func NewGrantRepository() *GrantRepository {
+	return &GrantRepository{}
+}
+
+// Get finds the grant a user has given a client
+func (r *GrantRepository) Get(userID uint, clientID string) (*model.UserGrant, error) {
+	var grant model.UserGrant
+	if err := database.DB.Where("user_id = ? AND client_id = ?", userID, clientID).First(&grant).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrGrantNotFound
+		}
+		return nil, err
+	}
+	return &grant, nil
+}
+
+// Save creates or updates a grant
+func (r *GrantRepository) Save(grant *model.UserGrant) error {
+	return database.DB.Save(grant).Error
+}
+
+// ListByUser returns all grants a user has given, most recent first
+func (r *GrantRepository) ListByUser(userID uint) ([]model.UserGrant, error) {
+	var grants []model.UserGrant
+	err := database.DB.Where("user_id = ?", userID).Order("updated_at DESC").Find(&grants).Error
+	return grants, err
+}
+
+// Delete removes the grant a user has given a client
+func (r *GrantRepository) Delete(userID uint, clientID string) error {
+	result := database.DB.Where("user_id = ? AND client_id = ?", userID, clientID).Delete(&model.UserGrant{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrGrantNotFound
+	}
+	return nil
+}
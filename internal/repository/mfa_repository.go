@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/joshleeeeee/go-lite-auth/internal/database"
+	"github.com/joshleeeeee/go-lite-auth/internal/model"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTOTPNotFound         = errors.New("TOTP authenticator not found")
+	ErrRecoveryCodeNotFound = errors.New("recovery code not found")
+)
+
+type MFARepository struct{}
+
+func NewMFARepository() *MFARepository {
+	return &MFARepository{}
+}
+
+// GetTOTP finds the TOTP authenticator of a user, confirmed or not
+func (r *MFARepository) GetTOTP(userID uint) (*model.UserTOTP, error) {
+	var totp model.UserTOTP
+	if err := database.DB.Where("user_id = ?", userID).First(&totp).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTOTPNotFound
+		}
+		return nil, err
+	}
+	return &totp, nil
+}
+
+// HasConfirmedTOTP reports whether a user has completed TOTP enrollment
+func (r *MFARepository) HasConfirmedTOTP(userID uint) (bool, error) {
+	var count int64
+	err := database.DB.Model(&model.UserTOTP{}).
+		Where("user_id = ? AND confirmed_at IS NOT NULL", userID).Count(&count).Error
+	return count > 0, err
+}
+
+// SaveTOTP creates or updates a TOTP authenticator
+func (r *MFARepository) SaveTOTP(totp *model.UserTOTP) error {
+	return database.DB.Save(totp).Error
+}
+
+// ConfirmTOTP completes enrollment and replaces the user's recovery codes in one transaction
+func (r *MFARepository) ConfirmTOTP(totp *model.UserTOTP, codeHashes []string) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(totp).Error; err != nil {
+			return err
+		}
+		return replaceRecoveryCodes(tx, totp.UserID, codeHashes)
+	})
+}
+
+// DeleteTOTP removes the TOTP authenticator of a user and keeps the recovery codes
+func (r *MFARepository) DeleteTOTP(userID uint) error {
+	return database.DB.Where("user_id = ?", userID).Delete(&model.UserTOTP{}).Error
+}
+
+// DeleteMFA removes the TOTP authenticator and recovery codes of a user
+func (r *MFARepository) DeleteMFA(userID uint) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&model.UserTOTP{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&model.RecoveryCode{}).Error
+	})
+}
+
+// UseRecoveryCode marks an unused recovery code as used. Only one caller can use a code.
+func (r *MFARepository) UseRecoveryCode(userID uint, codeHash string) error {
+	result := database.DB.Model(&model.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrRecoveryCodeNotFound
+	}
+	return nil
+}
+
+// ReplaceRecoveryCodes issues a new set of recovery codes to a user
+func (r *MFARepository) ReplaceRecoveryCodes(userID uint, codeHashes []string) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		return replaceRecoveryCodes(tx, userID, codeHashes)
+	})
+}
+
+// CountUnusedRecoveryCodes returns how many recovery codes a user has left
+func (r *MFARepository) CountUnusedRecoveryCodes(userID uint) (int64, error) {
+	var count int64
+	err := database.DB.Model(&model.RecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).Count(&count).Error
+	return count, err
+}
+
+// replaceRecoveryCodes deletes the recovery codes of a user and stores new ones
+func replaceRecoveryCodes(tx *gorm.DB, userID uint, codeHashes []string) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&model.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	codes := make([]model.RecoveryCode, len(codeHashes))
+	for i, hash := range codeHashes {
+		codes[i] = model.RecoveryCode{UserID: userID, CodeHash: hash}
+	}
+	return tx.Create(&codes).Error
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"github.com/joshleeeeee/go-lite-auth/internal/database"
+)
+
+type RoleRepository struct{}
+
+func NewRoleRepository() *RoleRepository {
+	return &RoleRepository{}
+}
+
+// GetRoleNames returns the names of the roles assigned to a user, sorted
+func (r *RoleRepository) GetRoleNames(userID uint) ([]string, error) {
+	var names []string
+	err := database.DB.Table("roles").
+		Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ?", userID).
+		Order("roles.name").
+		Pluck("roles.name", &names).Error
+	return names, err
+}
+
+// GetPermissionNames returns the names of the permissions granted by a user's roles, sorted
+func (r *RoleRepository) GetPermissionNames(userID uint) ([]string, error) {
+	var names []string
+	err := database.DB.Table("permissions").
+		Joins("JOIN role_permissions ON role_permissions.permission_id = permissions.id").
+		Joins("JOIN user_roles ON user_roles.role_id = role_permissions.role_id").
+		Where("user_roles.user_id = ?", userID).
+		Distinct().
+		Order("permissions.name").
+		Pluck("permissions.name", &names).Error
+	return names, err
+}
+
+// AnyRoleHasPermission reports whether one of the named roles holds one of the named permissions
+func (r *RoleRepository) AnyRoleHasPermission(roles, permissions []string) (bool, error) {
+	if len(roles) == 0 || len(permissions) == 0 {
+		return false, nil
+	}
+
+	var count int64
+	err := database.DB.Table("role_permissions").
+		Joins("JOIN roles ON roles.id = role_permissions.role_id").
+		Joins("JOIN permissions ON permissions.id = role_permissions.permission_id").
+		Where("roles.name IN ? AND permissions.name IN ?", roles, permissions).
+		Count(&count).Error
+	return count > 0, err
+}
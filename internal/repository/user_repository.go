@@ -2,6 +2,8 @@ package repository
 
 import (
 	"errors"
+	"strings"
+	"time"
 
 	"github.com/joshleeeeee/go-lite-auth/internal/database"
 	"github.com/joshleeeeee/go-lite-auth/internal/model"
@@ -86,7 +88,80 @@ func (r *UserRepository) Update(user *model.User) error {
 	return database.DB.Save(user).Error
 }
 
+// UpdatePassword replaces the password hash of a user, leaving the other columns untouched
+func (r *UserRepository) UpdatePassword(id uint, hash string) error {
+	return database.DB.Model(&model.User{}).Where("id = ?", id).Update("password", hash).Error
+}
+
 // Delete soft-deletes a user
 func (r *UserRepository) Delete(id uint) error {
 	return database.DB.Delete(&model.User{}, id).Error
 }
+
+// UserFilter narrows down a user listing; zero values do not filter
+type UserFilter struct {
+	Status      *int
+	CreatedFrom *time.Time // inclusive
+	CreatedTo   *time.Time // exclusive
+	EmailDomain string
+	Search      string // matched against username, email and nickname
+	Deleted     bool   // list soft-deleted users instead of live ones
+	Offset      int
+	Limit       int
+}
+
+// List returns a page of users matching the filter, newest first, with the total number of matches
+func (r *UserRepository) List(filter *UserFilter) ([]model.User, int64, error) {
+	query := database.DB.Model(&model.User{})
+	if filter.Deleted {
+		query = query.Unscoped().Where("deleted_at IS NOT NULL")
+	}
+	if filter.Status != nil {
+		query = query.Where("status = ?", *filter.Status)
+	}
+	if filter.CreatedFrom != nil {
+		query = query.Where("created_at >= ?", *filter.CreatedFrom)
+	}
+	if filter.CreatedTo != nil {
+		query = query.Where("created_at < ?", *filter.CreatedTo)
+	}
+	if filter.EmailDomain != "" {
+		query = query.Where("LOWER(email) LIKE ? ESCAPE '!'", "%@"+escapeLike(strings.ToLower(filter.EmailDomain)))
+	}
+	if filter.Search != "" {
+		pattern := "%" + escapeLike(strings.ToLower(filter.Search)) + "%"
+		query = query.Where("LOWER(username) LIKE ? ESCAPE '!' OR LOWER(email) LIKE ? ESCAPE '!' OR LOWER(nickname) LIKE ? ESCAPE '!'",
+			pattern, pattern, pattern)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var users []model.User
+	err := query.Order("id DESC").Offset(filter.Offset).Limit(filter.Limit).Find(&users).Error
+	return users, total, err
+}
+
+// GetByIDUnscoped finds a user by ID, including soft-deleted users
+func (r *UserRepository) GetByIDUnscoped(id uint) (*model.User, error) {
+	var user model.User
+	if err := database.DB.Unscoped().First(&user, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// Restore undoes the soft delete of a user
+func (r *UserRepository) Restore(id uint) error {
+	return database.DB.Unscoped().Model(&model.User{}).Where("id = ?", id).Update("deleted_at", nil).Error
+}
+
+// escapeLike escapes the LIKE wildcards of user input, using '!' as the escape character
+func escapeLike(value string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(value)
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/joshleeeeee/go-lite-auth/internal/database"
+	"github.com/joshleeeeee/go-lite-auth/internal/model"
+	"gorm.io/gorm"
+)
+
+var ErrWebAuthnCredentialNotFound = errors.New("WebAuthn credential not found")
+
+type WebAuthnRepository struct{}
+
+func NewWebAuthnRepository() *WebAuthnRepository {
+	return &WebAuthnRepository{}
+}
+
+// Create registers a new credential
+func (r *WebAuthnRepository) Create(credential *model.WebAuthnCredential) error {
+	return database.DB.Create(credential).Error
+}
+
+// ListByUser returns the credentials of a user, oldest first
+func (r *WebAuthnRepository) ListByUser(userID uint) ([]model.WebAuthnCredential, error) {
+	var credentials []model.WebAuthnCredential
+	err := database.DB.Where("user_id = ?", userID).Order("id").Find(&credentials).Error
+	return credentials, err
+}
+
+// CountByUser returns how many credentials a user has registered
+func (r *WebAuthnRepository) CountByUser(userID uint) (int64, error) {
+	var count int64
+	err := database.DB.Model(&model.WebAuthnCredential{}).Where("user_id = ?", userID).Count(&count).Error
+	return count, err
+}
+
+// GetByCredentialID finds a credential by its base64url credential ID
+func (r *WebAuthnRepository) GetByCredentialID(credentialID string) (*model.WebAuthnCredential, error) {
+	var credential model.WebAuthnCredential
+	if err := database.DB.Where("credential_id = ?", credentialID).First(&credential).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWebAuthnCredentialNotFound
+		}
+		return nil, err
+	}
+	return &credential, nil
+}
+
+// RecordUse stores the sign counter and backup state of a successful assertion
+func (r *WebAuthnRepository) RecordUse(credential *model.WebAuthnCredential) error {
+	now := time.Now()
+	credential.LastUsedAt = &now
+	return database.DB.Model(credential).Updates(map[string]interface{}{
+		"sign_count":   credential.SignCount,
+		"backup_state": credential.BackupState,
+		"last_used_at": now,
+	}).Error
+}
+
+// Delete removes a credential of a user
+func (r *WebAuthnRepository) Delete(userID, id uint) error {
+	result := database.DB.Where("id = ? AND user_id = ?", id, userID).Delete(&model.WebAuthnCredential{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrWebAuthnCredentialNotFound
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/joshleeeeee/go-lite-auth/internal/handler"
 	"github.com/joshleeeeee/go-lite-auth/internal/middleware"
+	"github.com/joshleeeeee/go-lite-auth/internal/service"
 )
 
 // Setup initializes and returns the Gin router
@@ -24,6 +25,12 @@ func Setup(mode string) *gin.Engine {
 
 	// Initialize handlers
 	authHandler := handler.NewAuthHandler()
+	grantHandler := handler.NewGrantHandler()
+	userHandler := handler.NewUserHandler()
+	mfaHandler := handler.NewMFAHandler()
+	passkeyHandler := handler.NewPasskeyHandler()
+	passwordlessHandler := handler.NewPasswordlessHandler()
+	adminHandler := handler.NewAdminHandler()
 
 	// API routes
 	api := r.Group("/api")
@@ -35,6 +42,19 @@ func Setup(mode string) *gin.Engine {
 			auth.POST("/login", authHandler.Login)
 			auth.POST("/refresh", authHandler.RefreshToken)
 			auth.GET("/validate", authHandler.ValidateToken)
+			auth.POST("/password/forgot", userHandler.ForgotPassword)
+			auth.POST("/password/reset", userHandler.ResetPassword)
+			auth.GET("/email/verify", userHandler.VerifyEmail)
+			auth.POST("/email/resend", userHandler.ResendVerification)
+			auth.POST("/mfa/verify", mfaHandler.Verify)
+			auth.POST("/mfa/passkey/begin", passkeyHandler.BeginMFA)
+			auth.POST("/mfa/passkey/finish", passkeyHandler.FinishMFA)
+			auth.POST("/passkey/begin", passkeyHandler.BeginLogin)
+			auth.POST("/passkey/finish", passkeyHandler.FinishLogin)
+			auth.POST("/magic-link", passwordlessHandler.SendMagicLink)
+			auth.POST("/magic-link/verify", passwordlessHandler.VerifyMagicLink)
+			auth.POST("/email-otp", passwordlessHandler.SendEmailOTP)
+			auth.POST("/email-otp/verify", passwordlessHandler.VerifyEmailOTP)
 		}
 
 		// Protected routes (require authentication)
@@ -43,6 +63,36 @@ func Setup(mode string) *gin.Engine {
 		{
 			protected.POST("/auth/logout", authHandler.Logout)
 			protected.GET("/user/info", authHandler.GetUserInfo)
+			protected.PATCH("/user/info", middleware.RequireScope(service.ScopeAccount), userHandler.UpdateUserInfo)
+			protected.POST("/user/password", middleware.RequireScope(service.ScopeAccount), userHandler.ChangePassword)
+			protected.GET("/user/mfa", middleware.RequireScope(service.ScopeAccount), mfaHandler.Status)
+			protected.POST("/user/mfa/totp", middleware.RequireScope(service.ScopeAccount), mfaHandler.EnrollTOTP)
+			protected.POST("/user/mfa/totp/confirm", middleware.RequireScope(service.ScopeAccount), mfaHandler.ConfirmTOTP)
+			protected.DELETE("/user/mfa/totp", middleware.RequireScope(service.ScopeAccount), mfaHandler.DisableTOTP)
+			protected.GET("/user/passkeys", middleware.RequireScope(service.ScopeAccount), passkeyHandler.ListPasskeys)
+			protected.POST("/user/passkeys/register/begin", middleware.RequireScope(service.ScopeAccount), passkeyHandler.BeginRegistration)
+			protected.POST("/user/passkeys/register/finish", middleware.RequireScope(service.ScopeAccount), passkeyHandler.FinishRegistration)
+			protected.DELETE("/user/passkeys/:id", middleware.RequireScope(service.ScopeAccount), passkeyHandler.DeletePasskey)
+			protected.GET("/user/grants", middleware.RequireScope(service.ScopeGrants), grantHandler.ListGrants)
+			protected.DELETE("/user/grants/:client_id", middleware.RequireScope(service.ScopeGrants), grantHandler.RevokeGrant)
+		}
+
+		// Admin routes (require the users:read / users:write permissions)
+		admin := api.Group("/admin")
+		admin.Use(middleware.AuthMiddleware())
+		{
+			readUsers := middleware.RequirePermission("users:read")
+			writeUsers := middleware.RequirePermission("users:write")
+			admin.GET("/users", readUsers, adminHandler.ListUsers)
+			admin.GET("/users/:id", readUsers, adminHandler.GetUser)
+			admin.POST("/users", writeUsers, adminHandler.CreateUser)
+			admin.POST("/users/import", writeUsers, adminHandler.ImportUsers)
+			admin.DELETE("/users/:id", writeUsers, adminHandler.DeleteUser)
+			admin.POST("/users/:id/disable", writeUsers, adminHandler.DisableUser)
+			admin.POST("/users/:id/enable", writeUsers, adminHandler.EnableUser)
+			admin.POST("/users/:id/logout", writeUsers, adminHandler.ForceLogout)
+			admin.POST("/users/:id/reset-password", writeUsers, adminHandler.ResetPassword)
+			admin.POST("/users/:id/restore", writeUsers, adminHandler.RestoreUser)
 		}
 	}
 
@@ -53,8 +103,32 @@ func Setup(mode string) *gin.Engine {
 		sso.GET("/login", ssoHandler.Login)
 		sso.POST("/login", ssoHandler.LoginSubmit)
 		sso.GET("/validate", ssoHandler.ValidateTicket)
+		sso.GET("/serviceValidate", ssoHandler.ServiceValidate)
+		sso.GET("/p3/serviceValidate", ssoHandler.ServiceValidate)
+		sso.GET("/proxyValidate", ssoHandler.ProxyValidate)
+		sso.GET("/p3/proxyValidate", ssoHandler.ProxyValidate)
+		sso.GET("/proxy", ssoHandler.Proxy)
 		sso.GET("/logout", ssoHandler.Logout)
 	}
 
+	// OAuth 2.0 / OpenID Connect routes
+	oauthHandler := handler.NewOAuthHandler()
+	oidcHandler := handler.NewOIDCHandler()
+	oauth := r.Group("/oauth")
+	{
+		oauth.GET("/authorize", oauthHandler.Authorize)
+		oauth.POST("/consent", oauthHandler.Consent)
+		oauth.POST("/token", oauthHandler.Token)
+		oauth.POST("/introspect", oauthHandler.Introspect)
+		oauth.POST("/revoke", oauthHandler.Revoke)
+		oauth.POST("/device_authorization", oauthHandler.DeviceAuthorization)
+		oauth.GET("/device", oauthHandler.DeviceVerification)
+		oauth.POST("/device", oauthHandler.DeviceVerificationSubmit)
+		oauth.GET("/userinfo", middleware.AuthMiddleware(), oidcHandler.UserInfo)
+		oauth.POST("/userinfo", middleware.AuthMiddleware(), oidcHandler.UserInfo)
+	}
+	r.GET("/.well-known/openid-configuration", oidcHandler.Discovery)
+	r.GET("/jwks.json", oidcHandler.JWKS)
+
 	return r
 }
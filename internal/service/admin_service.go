@@ -0,0 +1,409 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/joshleeeeee/go-lite-auth/internal/model"
+	"github.com/joshleeeeee/go-lite-auth/internal/repository"
+	"github.com/joshleeeeee/go-lite-auth/pkg/hasher"
+)
+
+// Admin errors
+var (
+	ErrUserNotFound     = errors.New("user not found")
+	ErrInvalidFilter    = errors.New("invalid filter, dates must be YYYY-MM-DD or RFC 3339")
+	ErrCannotModifySelf = errors.New("administrators cannot disable or delete their own account")
+	ErrUserNotDeleted   = errors.New("user is not deleted")
+)
+
+// Admin listing configuration
+const (
+	DefaultPageSize       = 20
+	MaxPageSize           = 100
+	GeneratedPasswordSize = 12 // random bytes of a password generated on reset
+)
+
+// AdminService handles user management by operators
+type AdminService struct {
+	userRepo    *repository.UserRepository
+	authService *AuthService
+	ssoService  *SSOService
+}
+
+// NewAdminService creates a new AdminService instance
+func NewAdminService() *AdminService {
+	return &AdminService{
+		userRepo:    repository.NewUserRepository(),
+		authService: NewAuthService(),
+		ssoService:  NewSSOService(),
+	}
+}
+
+// UserListRequest represents the query of a user listing
+type UserListRequest struct {
+	Page        int    `form:"page"`
+	PageSize    int    `form:"page_size"`
+	Status      *int   `form:"status"`
+	CreatedFrom string `form:"created_from"` // YYYY-MM-DD or RFC 3339, inclusive
+	CreatedTo   string `form:"created_to"`   // YYYY-MM-DD (the whole day) or RFC 3339, exclusive
+	EmailDomain string `form:"email_domain"`
+	Query       string `form:"q"`
+	Deleted     bool   `form:"deleted"`
+}
+
+// UserListResponse is a page of users
+type UserListResponse struct {
+	Items    []model.User `json:"items"`
+	Total    int64        `json:"total"`
+	Page     int          `json:"page"`
+	PageSize int          `json:"page_size"`
+}
+
+// CreateUserRequest represents a user created by an operator
+type CreateUserRequest struct {
+	RegisterRequest
+	Disabled bool `json:"disabled"`
+}
+
+// ResetPasswordRequest represents a password reset by an operator; a random password is generated when empty
+type ResetPasswordRequest struct {
+	Password string `json:"password" binding:"omitempty,min=6,max=50"`
+}
+
+// ImportUsersRequest represents users moved from another system with their password hashes
+type ImportUsersRequest struct {
+	Users []ImportUser `json:"users" binding:"required,min=1,max=1000,dive"`
+}
+
+// ImportUser is an imported user. The password hash may be of any supported algorithm,
+// including PBKDF2-SHA256; it is upgraded to the configured algorithm at the first login.
+type ImportUser struct {
+	Username      string `json:"username" binding:"required,min=3,max=50"`
+	Email         string `json:"email" binding:"required,email"`
+	Nickname      string `json:"nickname"`
+	PasswordHash  string `json:"password_hash" binding:"required,max=255"`
+	EmailVerified bool   `json:"email_verified"`
+	Disabled      bool   `json:"disabled"`
+}
+
+// ImportUsersResponse reports the users imported and the ones rejected
+type ImportUsersResponse struct {
+	Imported int            `json:"imported"`
+	Failed   []ImportFailed `json:"failed"`
+}
+
+// ImportFailed is a user that was not imported, by its position in the request
+type ImportFailed struct {
+	Index    int    `json:"index"`
+	Username string `json:"username"`
+	Error    string `json:"error"`
+}
+
+// ListUsers returns a page of users matching the filters and free-text search
+func (s *AdminService) ListUsers(req *UserListRequest) (*UserListResponse, error) {
+	if req.Page < 1 {
+		req.Page = 1
+	}
+	if req.PageSize < 1 {
+		req.PageSize = DefaultPageSize
+	}
+	if req.PageSize > MaxPageSize {
+		req.PageSize = MaxPageSize
+	}
+
+	filter := &repository.UserFilter{
+		Status:      req.Status,
+		EmailDomain: req.EmailDomain,
+		Search:      req.Query,
+		Deleted:     req.Deleted,
+		Offset:      (req.Page - 1) * req.PageSize,
+		Limit:       req.PageSize,
+	}
+	var err error
+	if filter.CreatedFrom, err = parseTimeFilter(req.CreatedFrom, false); err != nil {
+		return nil, err
+	}
+	if filter.CreatedTo, err = parseTimeFilter(req.CreatedTo, true); err != nil {
+		return nil, err
+	}
+
+	users, total, err := s.userRepo.List(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UserListResponse{
+		Items:    users,
+		Total:    total,
+		Page:     req.Page,
+		PageSize: req.PageSize,
+	}, nil
+}
+
+// GetUser returns a user, including a soft-deleted one
+func (s *AdminService) GetUser(id uint) (*model.User, error) {
+	return s.getUser(id, true)
+}
+
+// CreateUser creates a user on behalf of an operator
+func (s *AdminService) CreateUser(ctx context.Context, adminID uint, req *CreateUserRequest) (*model.User, error) {
+	user, err := s.authService.Register(ctx, &req.RegisterRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Disabled {
+		user.Status = 0
+		if err := s.userRepo.Update(user); err != nil {
+			return nil, fmt.Errorf("failed to update user: %w", err)
+		}
+	}
+
+	log.Printf("Admin: user %d created by %d", user.ID, adminID)
+	return user, nil
+}
+
+// ImportUsers creates users with existing password hashes. Users whose hash is not supported or
+// whose username or email is taken are reported and skipped; the others are imported.
+func (s *AdminService) ImportUsers(adminID uint, req *ImportUsersRequest) (*ImportUsersResponse, error) {
+	resp := &ImportUsersResponse{Failed: []ImportFailed{}}
+	now := time.Now()
+
+	for i, u := range req.Users {
+		reject := func(reason string) {
+			resp.Failed = append(resp.Failed, ImportFailed{Index: i, Username: u.Username, Error: reason})
+		}
+
+		if err := hasher.Validate(u.PasswordHash); err != nil {
+			reject(err.Error())
+			continue
+		}
+		exists, err := s.userRepo.ExistsByUsername(u.Username)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			reject(fmt.Sprintf("username '%s' already exists", u.Username))
+			continue
+		}
+		if exists, err = s.userRepo.ExistsByEmail(u.Email); err != nil {
+			return nil, err
+		}
+		if exists {
+			reject(fmt.Sprintf("email '%s' already exists", u.Email))
+			continue
+		}
+
+		user := &model.User{
+			Username: u.Username,
+			Email:    u.Email,
+			Password: u.PasswordHash,
+			Nickname: u.Nickname,
+			Status:   1,
+		}
+		if u.EmailVerified {
+			user.EmailVerifiedAt = &now
+		}
+		if err := s.userRepo.Create(user); err != nil {
+			return nil, fmt.Errorf("failed to create user: %w", err)
+		}
+		// A zero status would be replaced by the column default on create
+		if u.Disabled {
+			user.Status = 0
+			if err := s.userRepo.Update(user); err != nil {
+				return nil, fmt.Errorf("failed to update user: %w", err)
+			}
+		}
+		resp.Imported++
+	}
+
+	log.Printf("Admin: %d users imported by %d, %d rejected", resp.Imported, adminID, len(resp.Failed))
+	return resp, nil
+}
+
+// DisableUser disables a user and revokes their tokens and SSO sessions
+func (s *AdminService) DisableUser(ctx context.Context, adminID, id uint) (*model.User, error) {
+	if adminID == id {
+		return nil, ErrCannotModifySelf
+	}
+	user, err := s.setStatus(id, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.logoutEverywhere(ctx, id); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Admin: user %d disabled by %d", id, adminID)
+	return user, nil
+}
+
+// EnableUser enables a disabled user
+func (s *AdminService) EnableUser(adminID, id uint) (*model.User, error) {
+	user, err := s.setStatus(id, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Admin: user %d enabled by %d", id, adminID)
+	return user, nil
+}
+
+// ForceLogout revokes every token and SSO session of a user
+func (s *AdminService) ForceLogout(ctx context.Context, adminID, id uint) error {
+	if _, err := s.getUser(id, false); err != nil {
+		return err
+	}
+	if err := s.logoutEverywhere(ctx, id); err != nil {
+		return err
+	}
+
+	log.Printf("Admin: user %d logged out by %d", id, adminID)
+	return nil
+}
+
+// ResetPassword sets a new password for a user and logs them out everywhere. When no password
+// is given a random one is generated; the returned password is only available in this response.
+func (s *AdminService) ResetPassword(ctx context.Context, adminID, id uint, req *ResetPasswordRequest) (string, error) {
+	user, err := s.getUser(id, false)
+	if err != nil {
+		return "", err
+	}
+
+	password := req.Password
+	if password == "" {
+		if password, err = generatePassword(); err != nil {
+			return "", fmt.Errorf("failed to generate password: %w", err)
+		}
+	}
+
+	hashedPassword, err := hasher.Hash(password)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	user.Password = hashedPassword
+	if err := s.userRepo.Update(user); err != nil {
+		return "", fmt.Errorf("failed to update user: %w", err)
+	}
+	if err := s.logoutEverywhere(ctx, id); err != nil {
+		return "", err
+	}
+
+	log.Printf("Admin: password of user %d reset by %d", id, adminID)
+	emitSecurityEvent(ctx, &SecurityEvent{
+		Type:   EventPasswordChanged,
+		UserID: id,
+		Detail: fmt.Sprintf("password reset by administrator %d", adminID),
+	})
+	return password, nil
+}
+
+// DeleteUser soft-deletes a user and revokes their tokens and SSO sessions
+func (s *AdminService) DeleteUser(ctx context.Context, adminID, id uint) error {
+	if adminID == id {
+		return ErrCannotModifySelf
+	}
+	if _, err := s.getUser(id, false); err != nil {
+		return err
+	}
+	if err := s.userRepo.Delete(id); err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	if err := s.logoutEverywhere(ctx, id); err != nil {
+		return err
+	}
+
+	log.Printf("Admin: user %d deleted by %d", id, adminID)
+	return nil
+}
+
+// RestoreUser undoes the soft delete of a user
+func (s *AdminService) RestoreUser(adminID, id uint) (*model.User, error) {
+	user, err := s.getUser(id, true)
+	if err != nil {
+		return nil, err
+	}
+	if !user.DeletedAt.Valid {
+		return nil, ErrUserNotDeleted
+	}
+	if err := s.userRepo.Restore(id); err != nil {
+		return nil, fmt.Errorf("failed to restore user: %w", err)
+	}
+
+	log.Printf("Admin: user %d restored by %d", id, adminID)
+	return s.getUser(id, false)
+}
+
+// setStatus changes the status of a live user
+func (s *AdminService) setStatus(id uint, status int) (*model.User, error) {
+	user, err := s.getUser(id, false)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Status = status
+	if err := s.userRepo.Update(user); err != nil {
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+	return user, nil
+}
+
+// logoutEverywhere revokes all tokens of a user and ends their SSO sessions
+func (s *AdminService) logoutEverywhere(ctx context.Context, id uint) error {
+	if err := s.authService.RevokeUserTokens(ctx, id); err != nil {
+		return err
+	}
+	return s.ssoService.LogoutUser(ctx, id, "")
+}
+
+// getUser finds a user, optionally including soft-deleted users
+func (s *AdminService) getUser(id uint, unscoped bool) (*model.User, error) {
+	var user *model.User
+	var err error
+	if unscoped {
+		user, err = s.userRepo.GetByIDUnscoped(id)
+	} else {
+		user, err = s.userRepo.GetByID(id)
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// parseTimeFilter parses a date (YYYY-MM-DD) or RFC 3339 timestamp. A date used as an
+// exclusive upper bound covers the whole day.
+func parseTimeFilter(value string, upper bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, ErrInvalidFilter
+	}
+	if upper {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
+// generatePassword generates a random URL-safe password
+func generatePassword() (string, error) {
+	bytes := make([]byte, GeneratedPasswordSize)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
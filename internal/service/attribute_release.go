@@ -0,0 +1,175 @@
+package service
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/joshleeeeee/go-lite-auth/internal/model"
+)
+
+// AllAttributes in an allow-list releases every known attribute
+const AllAttributes = "*"
+
+// AttributeFromNewLogin is the CAS attribute telling whether the ticket was issued from primary
+// credentials; it is always released, so no attribute may be renamed to it
+const AttributeFromNewLogin = "isFromNewLogin"
+
+// AttributeResolver computes the value of a released attribute for a user.
+// A nil value means the attribute is not released for that user.
+type AttributeResolver func(user *model.User) (interface{}, error)
+
+var (
+	attributeMu        sync.RWMutex
+	attributeResolvers = map[string]AttributeResolver{
+		"user_id":      func(u *model.User) (interface{}, error) { return u.ID, nil },
+		"username":     func(u *model.User) (interface{}, error) { return u.Username, nil },
+		"email":        func(u *model.User) (interface{}, error) { return u.Email, nil },
+		"nickname":     func(u *model.User) (interface{}, error) { return u.Nickname, nil },
+		"avatar":       func(u *model.User) (interface{}, error) { return u.Avatar, nil },
+		"status":       func(u *model.User) (interface{}, error) { return u.Status, nil },
+		"display_name": func(u *model.User) (interface{}, error) { return displayName(u), nil },
+		"created_at":   func(u *model.User) (interface{}, error) { return u.CreatedAt.UTC().Format(time.RFC3339), nil },
+		"updated_at":   func(u *model.User) (interface{}, error) { return u.UpdatedAt.UTC().Format(time.RFC3339), nil },
+	}
+)
+
+// RegisterAttribute adds or replaces a computed attribute that services can be allowed to receive
+func RegisterAttribute(name string, resolver AttributeResolver) {
+	attributeMu.Lock()
+	defer attributeMu.Unlock()
+	attributeResolvers[name] = resolver
+}
+
+// KnownAttributes returns the names of all attributes that can be released, sorted
+func KnownAttributes() []string {
+	attributeMu.RLock()
+	defer attributeMu.RUnlock()
+
+	names := make([]string, 0, len(attributeResolvers))
+	for name := range attributeResolvers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// releaseAttributes applies the service's release policy: only allow-listed attributes are
+// resolved, and each is published under its renamed key when the policy renames it
+func releaseAttributes(user *model.User, registered *RegisteredService) map[string]interface{} {
+	names := registered.AllowedAttributes
+	for _, allowed := range names {
+		if allowed == AllAttributes {
+			names = KnownAttributes()
+			break
+		}
+	}
+
+	attributeMu.RLock()
+	defer attributeMu.RUnlock()
+
+	attributes := make(map[string]interface{})
+	for _, name := range names {
+		resolve, ok := attributeResolvers[name]
+		if !ok {
+			continue
+		}
+
+		value, err := resolve(user)
+		if err != nil {
+			log.Printf("SSO: failed to resolve attribute %s for user %d: %v", name, user.ID, err)
+			continue
+		}
+		if value == nil {
+			continue
+		}
+
+		if renamed, ok := registered.AttributeRenames[name]; ok {
+			name = renamed
+		}
+		attributes[name] = value
+	}
+	return attributes
+}
+
+// parseRenames parses "from=to" pairs of a comma-separated rename policy. Released names become
+// <cas:name> elements, so they must be XML names without a colon
+func parseRenames(clientID, value string) map[string]string {
+	renames := make(map[string]string)
+	for _, pair := range splitList(value) {
+		from, to, ok := strings.Cut(pair, "=")
+		from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+		if !ok || from == "" || to == "" {
+			log.Printf("SSO: ignoring invalid attribute rename %q of client %s", pair, clientID)
+			continue
+		}
+		if !isNCName(to) {
+			log.Printf("SSO: ignoring attribute rename %s=%s of client %s: %q is not a valid XML name", from, to, clientID, to)
+			continue
+		}
+		if to == AttributeFromNewLogin {
+			log.Printf("SSO: ignoring attribute rename %s=%s of client %s: %s is reserved", from, to, clientID, to)
+			continue
+		}
+		renames[from] = to
+	}
+	return renames
+}
+
+// isNCName reports whether name is an XML name without a colon (an NCName)
+func isNCName(name string) bool {
+	for i, r := range name {
+		switch {
+		case unicode.IsLetter(r) || r == '_':
+		case i > 0 && (unicode.IsDigit(r) || r == '-' || r == '.' || r == '\u00B7' || unicode.In(r, unicode.Mn, unicode.Mc)):
+		default:
+			return false
+		}
+	}
+	return name != ""
+}
+
+// checkRenames drops renames whose released name collides with another released attribute,
+// renamed or not, so that one value cannot overwrite another
+func checkRenames(clientID string, renames map[string]string, allowed []string) map[string]string {
+	released := make(map[string]bool)
+	for _, name := range allowed {
+		if name == AllAttributes {
+			for _, known := range KnownAttributes() {
+				released[known] = true
+			}
+			continue
+		}
+		released[name] = true
+	}
+
+	checked := make(map[string]string, len(renames))
+	for from, to := range renames {
+		checked[from] = to
+	}
+	// Dropping a rename releases the attribute under its own name again, which may collide in turn
+	for {
+		keys := make(map[string]int)
+		for name := range released {
+			if to, ok := checked[name]; ok {
+				name = to
+			}
+			keys[name]++
+		}
+
+		dropped := false
+		for from, to := range checked {
+			if keys[to] > 1 {
+				log.Printf("SSO: ignoring attribute rename %s=%s of client %s: %s is already released", from, to, clientID, to)
+				delete(checked, from)
+				dropped = true
+			}
+		}
+		if !dropped {
+			return checked
+		}
+	}
+}
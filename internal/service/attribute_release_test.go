@@ -0,0 +1,57 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/joshleeeeee/go-lite-auth/internal/database"
+	"github.com/joshleeeeee/go-lite-auth/internal/model"
+)
+
+func TestReleaseAttributes(t *testing.T) {
+	setupTestEnv(t)
+	user := createTestUser(t, "alice", "password123")
+	role := &model.Role{Name: "hr"}
+	if err := database.DB.Create(role).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := database.DB.Model(user).Association("Roles").Append(role); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		allowed string
+		renames string
+		want    map[string]interface{}
+	}{
+		{"defaults", "", "", map[string]interface{}{"user_id": user.ID, "email": "alice@example.com", "nickname": ""}},
+		{"allow-list without email", "username,groups", "", map[string]interface{}{"username": "alice", "groups": []string{"hr"}}},
+		{"rename", "email,roles", "email=mail,roles=memberOf", map[string]interface{}{"mail": "alice@example.com", "memberOf": []string{"hr"}}},
+		{"rename onto a released attribute", "email,username", "email=username", map[string]interface{}{"email": "alice@example.com", "username": "alice"}},
+		{"rename onto a renamed attribute", "email,username", "email=username,username=login", map[string]interface{}{"username": "alice@example.com", "login": "alice"}},
+		{"two renames onto one name", "email,nickname", "email=mail,nickname=mail", map[string]interface{}{"email": "alice@example.com", "nickname": ""}},
+		{"rename onto an attribute released by *", "*", "email=groups", nil},
+		{"rename to invalid XML names", "email,nickname,username", "email=mail address,nickname=a<b,username=cas:login",
+			map[string]interface{}{"email": "alice@example.com", "nickname": "", "username": "alice"}},
+		{"rename to isFromNewLogin", "email", "email=isFromNewLogin", map[string]interface{}{"email": "alice@example.com"}},
+		{"rename to a non-ASCII name", "email,nickname", "email=courriel,nickname=пользователь.имя-2",
+			map[string]interface{}{"courriel": "alice@example.com", "пользователь.имя-2": ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &model.Client{ClientID: "app", AllowedAttributes: tt.allowed, AttributeRenames: tt.renames}
+			got := releaseAttributes(user, newRegisteredService(client))
+			if tt.want == nil {
+				if got["email"] != "alice@example.com" || !reflect.DeepEqual(got["groups"], []string{"hr"}) {
+					t.Errorf("releaseAttributes() = %v, want email and groups under their own names", got)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("releaseAttributes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -4,14 +4,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
 	"time"
 
 	"github.com/joshleeeeee/go-lite-auth/internal/config"
 	"github.com/joshleeeeee/go-lite-auth/internal/database"
 	"github.com/joshleeeeee/go-lite-auth/internal/model"
 	"github.com/joshleeeeee/go-lite-auth/internal/repository"
+	"github.com/joshleeeeee/go-lite-auth/pkg/hasher"
 	"github.com/joshleeeeee/go-lite-auth/pkg/jwt"
-	"golang.org/x/crypto/bcrypt"
 )
 
 var (
@@ -26,12 +27,18 @@ const (
 )
 
 type AuthService struct {
-	userRepo *repository.UserRepository
+	userRepo     *repository.UserRepository
+	roleRepo     *repository.RoleRepository
+	mfaRepo      *repository.MFARepository
+	webauthnRepo *repository.WebAuthnRepository
 }
 
 func NewAuthService() *AuthService {
 	return &AuthService{
-		userRepo: repository.NewUserRepository(),
+		userRepo:     repository.NewUserRepository(),
+		roleRepo:     repository.NewRoleRepository(),
+		mfaRepo:      repository.NewMFARepository(),
+		webauthnRepo: repository.NewWebAuthnRepository(),
 	}
 }
 
@@ -49,10 +56,13 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
-// AuthResponse represents the authentication response
+// AuthResponse represents the authentication response. When a second factor is required it
+// only carries the mfa_token.
 type AuthResponse struct {
-	User      *model.User    `json:"user"`
-	TokenPair *jwt.TokenPair `json:"token"`
+	User        *model.User    `json:"user,omitempty"`
+	TokenPair   *jwt.TokenPair `json:"token,omitempty"`
+	MFARequired bool           `json:"mfa_required,omitempty"`
+	MFAToken    string         `json:"mfa_token,omitempty"`
 }
 
 // Register creates a new user account
@@ -76,7 +86,7 @@ func (s *AuthService) Register(ctx context.Context, req *RegisterRequest) (*mode
 	}
 
 	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	hashedPassword, err := hasher.Hash(req.Password)
 	if err != nil {
 		return nil, fmt.Errorf("failed to hash password: %w", err)
 	}
@@ -85,7 +95,7 @@ func (s *AuthService) Register(ctx context.Context, req *RegisterRequest) (*mode
 	user := &model.User{
 		Username: req.Username,
 		Email:    req.Email,
-		Password: string(hashedPassword),
+		Password: hashedPassword,
 		Nickname: req.Nickname,
 		Status:   1,
 	}
@@ -94,6 +104,11 @@ func (s *AuthService) Register(ctx context.Context, req *RegisterRequest) (*mode
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
 
+	// Ask the user to confirm their email address; the account is created either way
+	if err := requestEmailVerification(ctx, user); err != nil {
+		log.Printf("Auth: user %d registered without a verification email: %v", user.ID, err)
+	}
+
 	return user, nil
 }
 
@@ -120,7 +135,7 @@ func (s *AuthService) Login(ctx context.Context, req *LoginRequest, clientIP str
 	}
 
 	// Check password
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+	if !s.checkPassword(user, req.Password) {
 		database.IncrLoginFail(ctx, failKey, LoginLockDuration)
 		return nil, ErrInvalidCredentials
 	}
@@ -129,12 +144,60 @@ func (s *AuthService) Login(ctx context.Context, req *LoginRequest, clientIP str
 	if user.Status != 1 {
 		return nil, ErrUserDisabled
 	}
+	if err := checkEmailVerified(user); err != nil {
+		return nil, err
+	}
+
+	// Users with a second factor get an mfa_token to exchange at /api/auth/mfa/verify
+	mfaToken, err := s.startMFA(ctx, &database.MFAChallengeData{
+		UserID:  user.ID,
+		FailKey: failKey,
+		AMR:     []string{AMRPassword},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if mfaToken != "" {
+		return &AuthResponse{MFARequired: true, MFAToken: mfaToken}, nil
+	}
 
 	// Clear login failures on success
 	database.ClearLoginFail(ctx, failKey)
 
+	return s.completeLogin(ctx, user)
+}
+
+// checkPassword reports whether a password matches the user's hash. After a match, a hash of
+// another algorithm or of outdated parameters is replaced by one of the configured algorithm.
+func (s *AuthService) checkPassword(user *model.User, password string) bool {
+	match, rehash, err := hasher.Verify(password, user.Password)
+	if err != nil {
+		log.Printf("Auth: password hash of user %d cannot be verified: %v", user.ID, err)
+		return false
+	}
+	if !match || !rehash {
+		return match
+	}
+
+	// The login goes on with the old hash when the upgrade fails; the next one tries again
+	hashedPassword, err := hasher.Hash(password)
+	if err != nil {
+		log.Printf("Auth: failed to rehash password of user %d: %v", user.ID, err)
+		return true
+	}
+	if err := s.userRepo.UpdatePassword(user.ID, hashedPassword); err != nil {
+		log.Printf("Auth: failed to store rehashed password of user %d: %v", user.ID, err)
+		return true
+	}
+	log.Printf("Auth: password hash of user %d upgraded from %s to the configured %s", user.ID, hasher.Identify(user.Password), hasher.Current().Algorithm())
+	user.Password = hashedPassword
+	return true
+}
+
+// completeLogin issues the tokens and session of an authenticated user
+func (s *AuthService) completeLogin(ctx context.Context, user *model.User) (*AuthResponse, error) {
 	// Generate tokens
-	tokenPair, err := jwt.GenerateTokenPair(user.ID, user.Username)
+	tokenPair, err := s.IssueTokenPair(ctx, user.ID, user.Username, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate token: %w", err)
 	}
@@ -186,14 +249,22 @@ func (s *AuthService) RefreshToken(ctx context.Context, refreshToken string) (*j
 		return nil, jwt.ErrInvalidToken
 	}
 
-	// Check if token is blacklisted
-	isBlacklisted, err := database.IsBlacklisted(ctx, claims.TokenID)
+	// Rotate within the refresh token family, detecting reuse
+	if claims.FamilyID != "" {
+		return s.rotateRefreshToken(ctx, claims)
+	}
+
+	// Check if token is revoked
+	isRevoked, err := IsTokenRevoked(ctx, claims)
 	if err != nil {
 		return nil, err
 	}
-	if isBlacklisted {
+	if isRevoked {
 		return nil, jwt.ErrInvalidToken
 	}
+	if err := s.checkRefreshUser(claims.UserID); err != nil {
+		return nil, err
+	}
 
 	// Blacklist old refresh token
 	remainingTime := jwt.GetTokenRemainingTime(claims)
@@ -201,8 +272,11 @@ func (s *AuthService) RefreshToken(ctx context.Context, refreshToken string) (*j
 		database.AddToBlacklist(ctx, claims.TokenID, remainingTime)
 	}
 
-	// Generate new token pair
-	return jwt.GenerateTokenPair(claims.UserID, claims.Username)
+	// Tokens issued before families existed start a new family, keeping the client and scope of the grant
+	return s.IssueTokenPair(ctx, claims.UserID, claims.Username, &jwt.TokenOptions{
+		ClientID: claims.ClientID,
+		Scope:    claims.Scope,
+	})
 }
 
 // ValidateToken validates an access token
@@ -212,12 +286,12 @@ func (s *AuthService) ValidateToken(ctx context.Context, tokenString string) (*j
 		return nil, err
 	}
 
-	// Check if token is blacklisted
-	isBlacklisted, err := database.IsBlacklisted(ctx, claims.TokenID)
+	// Check if token is revoked
+	isRevoked, err := IsTokenRevoked(ctx, claims)
 	if err != nil {
 		return nil, err
 	}
-	if isBlacklisted {
+	if isRevoked {
 		return nil, jwt.ErrInvalidToken
 	}
 
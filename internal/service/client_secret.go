@@ -0,0 +1,85 @@
+package service
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"log"
+
+	"github.com/joshleeeeee/go-lite-auth/internal/model"
+	"github.com/joshleeeeee/go-lite-auth/internal/repository"
+	"github.com/joshleeeeee/go-lite-auth/pkg/hasher"
+)
+
+// Client secrets are stored like passwords, as pkg/hasher hashes. Secrets written in plaintext,
+// by clients registered before hashing or inserted by hand, are hashed by MigrateClientSecrets
+// at startup and otherwise on their first successful use.
+
+// checkClientSecret verifies a client secret against the stored hash. After a match, a plaintext
+// secret, or a hash of another algorithm or of outdated parameters, is replaced by a new hash.
+func (s *OAuthService) checkClientSecret(client *model.Client, secret string) bool {
+	if secret == "" || client.ClientSecret == "" {
+		return false
+	}
+
+	var match, rehash bool
+	if hasher.Identify(client.ClientSecret) == "" {
+		match, rehash = verifyPlaintextSecret(client.ClientSecret, secret), true
+	} else {
+		var err error
+		match, rehash, err = hasher.Verify(secret, client.ClientSecret)
+		if err != nil {
+			log.Printf("OAuth: secret hash of client %s cannot be verified: %v", client.ClientID, err)
+			return false
+		}
+	}
+	if !match || !rehash {
+		return match
+	}
+
+	// Authentication goes on with the old value when the upgrade fails; the next one tries again
+	hash, err := hasher.Hash(secret)
+	if err != nil {
+		log.Printf("OAuth: failed to hash secret of client %s: %v", client.ClientID, err)
+		return true
+	}
+	if err := s.clientRepo.UpdateSecret(client.ID, hash); err != nil {
+		log.Printf("OAuth: failed to store hashed secret of client %s: %v", client.ClientID, err)
+		return true
+	}
+	client.ClientSecret = hash
+	return true
+}
+
+// verifyPlaintextSecret compares secret digests in constant time, so neither the content
+// nor the length of the stored secret leaks through timing
+func verifyPlaintextSecret(stored, secret string) bool {
+	expected := sha256.Sum256([]byte(stored))
+	actual := sha256.Sum256([]byte(secret))
+	return subtle.ConstantTimeCompare(expected[:], actual[:]) == 1
+}
+
+// MigrateClientSecrets hashes the client secrets that are still stored in plaintext and
+// returns how many it hashed
+func MigrateClientSecrets() (int, error) {
+	clientRepo := repository.NewClientRepository()
+	clients, err := clientRepo.ListConfidential()
+	if err != nil {
+		return 0, err
+	}
+
+	hashed := 0
+	for _, client := range clients {
+		if hasher.Identify(client.ClientSecret) != "" {
+			continue
+		}
+		hash, err := hasher.Hash(client.ClientSecret)
+		if err != nil {
+			return hashed, err
+		}
+		if err := clientRepo.UpdateSecret(client.ID, hash); err != nil {
+			return hashed, err
+		}
+		hashed++
+	}
+	return hashed, nil
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/joshleeeeee/go-lite-auth/internal/database"
+	"github.com/joshleeeeee/go-lite-auth/internal/model"
+	"github.com/joshleeeeee/go-lite-auth/pkg/hasher"
+)
+
+func TestAuthenticateClientSecret(t *testing.T) {
+	tests := []struct {
+		name       string
+		plaintext  bool
+		secret     string
+		wantOK     bool
+		wantHashed bool // stored secret afterwards
+	}{
+		{"hashed secret", false, "app-secret", true, true},
+		{"hashed secret mismatch", false, "wrong", false, true},
+		{"missing secret", false, "", false, true},
+		{"plaintext secret is hashed on use", true, "app-secret", true, true},
+		{"plaintext secret mismatch", true, "wrong", false, false},
+		{"plaintext secret prefix", true, "app-", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestEnv(t)
+			client := createTestClient(t, "app", testRedirectURI)
+			if tt.plaintext {
+				if err := database.DB.Model(client).Update("client_secret", "app-secret").Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			_, err := NewOAuthService().AuthenticateClient("app", tt.secret)
+			if (err == nil) != tt.wantOK {
+				t.Errorf("AuthenticateClient() error = %v, want ok %v", err, tt.wantOK)
+			}
+
+			var stored model.Client
+			if err := database.DB.First(&stored, client.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if hashed := hasher.Identify(stored.ClientSecret) != ""; hashed != tt.wantHashed {
+				t.Errorf("stored secret %q hashed = %v, want %v", stored.ClientSecret, hashed, tt.wantHashed)
+			}
+			if tt.wantHashed {
+				if match, _, err := hasher.Verify("app-secret", stored.ClientSecret); err != nil || !match {
+					t.Errorf("stored hash does not verify the secret: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestMigrateClientSecrets(t *testing.T) {
+	setupTestEnv(t)
+	hashed := createTestClient(t, "hashed", testRedirectURI)
+	plaintext := createTestClient(t, "plaintext", testRedirectURI)
+	public := &model.Client{ClientID: "public", Name: "public", RedirectURI: testRedirectURI, Status: 1, Public: true}
+	if err := database.DB.Create(public).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := database.DB.Model(plaintext).Update("client_secret", "plaintext-secret").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	count, err := MigrateClientSecrets()
+	if err != nil || count != 1 {
+		t.Fatalf("MigrateClientSecrets() = %d, %v, want 1", count, err)
+	}
+
+	for _, client := range []*model.Client{hashed, plaintext} {
+		if _, err := NewOAuthService().AuthenticateClient(client.ClientID, client.ClientID+"-secret"); err != nil {
+			t.Errorf("AuthenticateClient(%s) after migration error = %v", client.ClientID, err)
+		}
+	}
+	var stored model.Client
+	if err := database.DB.First(&stored, public.ID).Error; err != nil || stored.ClientSecret != "" {
+		t.Errorf("public client secret = %q, %v, want empty", stored.ClientSecret, err)
+	}
+
+	if count, err := MigrateClientSecrets(); err != nil || count != 0 {
+		t.Errorf("second MigrateClientSecrets() = %d, %v, want 0", count, err)
+	}
+}
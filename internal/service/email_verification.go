@@ -0,0 +1,216 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/joshleeeeee/go-lite-auth/internal/config"
+	"github.com/joshleeeeee/go-lite-auth/internal/database"
+	"github.com/joshleeeeee/go-lite-auth/internal/model"
+	"github.com/joshleeeeee/go-lite-auth/internal/repository"
+	"github.com/joshleeeeee/go-lite-auth/pkg/mailer"
+)
+
+// Email verification errors
+var (
+	ErrEmailNotVerified         = errors.New("email address is not verified")
+	ErrInvalidVerificationToken = errors.New("verification link is invalid or expired")
+)
+
+// PlaceholderSecret is the example value of secrets in the shipped configuration
+const PlaceholderSecret = "CHANGE_ME_IN_PRODUCTION"
+
+// errVerificationKeyNotLoaded is returned when InitEmailVerification has not been called
+var errVerificationKeyNotLoaded = errors.New("email verification key not loaded")
+
+// verificationKey signs verification links, see InitEmailVerification
+var verificationKey []byte
+
+// ResendVerificationRequest asks for a new verification link
+type ResendVerificationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// verificationPayload is the signed content of a verification link. The email is included so
+// that a link stops working once the user changes their address.
+type verificationPayload struct {
+	UserID    uint   `json:"uid"`
+	Email     string `json:"email"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// VerifyEmail marks the email of the user a verification link was issued to as verified
+func (s *UserService) VerifyEmail(token string) (*model.User, error) {
+	payload, err := parseVerificationToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByID(payload.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, ErrInvalidVerificationToken
+		}
+		return nil, err
+	}
+	if !strings.EqualFold(user.Email, payload.Email) {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	// Opening the link again is harmless
+	if user.EmailVerifiedAt != nil {
+		return user, nil
+	}
+
+	now := time.Now()
+	user.EmailVerifiedAt = &now
+	if err := s.userRepo.Update(user); err != nil {
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+
+	log.Printf("Auth: email of user %d verified", user.ID)
+	return user, nil
+}
+
+// ResendVerification emails a new verification link. Like ForgotPassword it never reports the
+// outcome, so that it cannot be used to find out which emails have an account.
+func (s *UserService) ResendVerification(ctx context.Context, req *ResendVerificationRequest) error {
+	user, err := s.userRepo.GetByEmail(req.Email)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil
+		}
+		return err
+	}
+	if user.Status != 1 || user.EmailVerifiedAt != nil {
+		return nil
+	}
+
+	return requestEmailVerification(ctx, user)
+}
+
+// requestEmailVerification sends a verification link in the background, at most once per resend interval
+func requestEmailVerification(ctx context.Context, user *model.User) error {
+	ok, err := database.MarkEmailVerificationSent(ctx, user.ID, config.GlobalConfig.Email.VerifyResendDuration())
+	if err != nil {
+		return fmt.Errorf("failed to check verification interval: %w", err)
+	}
+	if ok {
+		go sendEmailVerification(user)
+	}
+	return nil
+}
+
+// sendEmailVerification emails a signed verification link; failures are only logged
+func sendEmailVerification(user *model.User) {
+	cfg := config.GlobalConfig.Email
+	token, err := signVerificationToken(&verificationPayload{
+		UserID:    user.ID,
+		Email:     user.Email,
+		ExpiresAt: time.Now().Add(cfg.VerifyLinkDuration()).Unix(),
+	})
+	if err != nil {
+		log.Printf("Auth: failed to sign verification link for user %d: %v", user.ID, err)
+		return
+	}
+
+	link, err := url.Parse(cfg.VerifyURL)
+	if err != nil {
+		log.Printf("Auth: invalid email.verify_url: %v", err)
+		return
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	data := map[string]interface{}{
+		"Name":      displayName(user),
+		"URL":       link.String(),
+		"ExpiresIn": cfg.VerifyLinkExpire / 3600,
+	}
+	if err := mailer.Send(context.Background(), user.Email, mailer.TemplateEmailVerification, data); err != nil {
+		log.Printf("Auth: failed to send verification email to user %d: %v", user.ID, err)
+	}
+}
+
+// checkEmailVerified rejects users with an unverified email when verification is required
+func checkEmailVerified(user *model.User) error {
+	if config.GlobalConfig.Email.VerificationRequired && user.EmailVerifiedAt == nil {
+		return ErrEmailNotVerified
+	}
+	return nil
+}
+
+// signVerificationToken encodes a payload and signs it with HMAC-SHA256
+func signVerificationToken(payload *verificationPayload) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	if verificationKey == nil {
+		return "", errVerificationKeyNotLoaded
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(data)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(verificationMAC(encoded)), nil
+}
+
+// parseVerificationToken checks the signature and expiry of a verification token
+func parseVerificationToken(token string) (*verificationPayload, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok || verificationKey == nil {
+		return nil, ErrInvalidVerificationToken
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, verificationMAC(encoded)) {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidVerificationToken
+	}
+	var payload verificationPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, ErrInvalidVerificationToken
+	}
+	if time.Now().Unix() > payload.ExpiresAt {
+		return nil, ErrInvalidVerificationToken
+	}
+	return &payload, nil
+}
+
+// InitEmailVerification loads the key of verification links. Without email.verify_secret a random
+// key is used, so links sent before a restart or by another replica stop working.
+func InitEmailVerification(cfg *config.EmailConfig) error {
+	switch cfg.VerifySecret {
+	case PlaceholderSecret:
+		return errors.New("email.verify_secret is still the placeholder value, set a random secret")
+	case "":
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return fmt.Errorf("failed to generate verification key: %w", err)
+		}
+		log.Println("Auth: no email.verify_secret configured, verification links only work in this process")
+		verificationKey = key
+	default:
+		verificationKey = []byte(cfg.VerifySecret)
+	}
+	return nil
+}
+
+// verificationMAC signs with the verification key, under a label so the MAC cannot be mistaken for another use of the key
+func verificationMAC(message string) []byte {
+	h := hmac.New(sha256.New, verificationKey)
+	h.Write([]byte("email-verification:" + message))
+	return h.Sum(nil)
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/joshleeeeee/go-lite-auth/internal/config"
+)
+
+func TestInitEmailVerification(t *testing.T) {
+	tests := []struct {
+		name    string
+		secret  string
+		wantErr bool
+	}{
+		{"configured secret", "0123456789abcdef0123456789abcdef", false},
+		{"generated secret", "", false},
+		{"placeholder", PlaceholderSecret, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := InitEmailVerification(&config.EmailConfig{VerifySecret: tt.secret})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("InitEmailVerification() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerificationTokenKey(t *testing.T) {
+	setupTestEnv(t)
+	payload := &verificationPayload{UserID: 1, Email: "alice@example.com", ExpiresAt: time.Now().Add(time.Minute).Unix()}
+	token, err := signVerificationToken(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := parseVerificationToken(token); err != nil || *got != *payload {
+		t.Fatalf("parseVerificationToken() = %v, %v", got, err)
+	}
+
+	// Links are not signed with jwt.secret, and another key rejects them
+	if err := InitEmailVerification(&config.EmailConfig{VerifySecret: config.GlobalConfig.JWT.Secret}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseVerificationToken(token); !errors.Is(err, ErrInvalidVerificationToken) {
+		t.Errorf("parseVerificationToken() with another key error = %v, want ErrInvalidVerificationToken", err)
+	}
+}
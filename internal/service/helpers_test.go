@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/glebarez/sqlite"
+	"github.com/joshleeeeee/go-lite-auth/internal/config"
+	"github.com/joshleeeeee/go-lite-auth/internal/database"
+	"github.com/joshleeeeee/go-lite-auth/internal/model"
+	"github.com/joshleeeeee/go-lite-auth/pkg/jwt"
+	"github.com/joshleeeeee/go-lite-auth/pkg/mailer"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// Test client and WebAuthn relying party
+const (
+	testRedirectURI = "https://app.example.com/callback"
+	testRPID        = "localhost"
+	testOrigin      = "http://localhost:8080"
+)
+
+// setupTestEnv points the database and Redis at fresh in-memory instances and loads a test configuration
+func setupTestEnv(t *testing.T) *miniredis.Miniredis {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	database.RDB = redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { database.RDB.Close() })
+
+	config.GlobalConfig = &config.Config{
+		JWT:      config.JWTConfig{Secret: "test-secret", AccessTokenExpire: 600, RefreshTokenExpire: 3600, Issuer: "lite-auth"},
+		Session:  config.SessionConfig{Expire: 3600},
+		SSO:      config.SSOConfig{TGTExpire: 3600, LogoutTimeout: 1, ProxyTimeout: 1},
+		OAuth:    config.OAuthConfig{AuthCodeExpire: 60, DeviceCodeExpire: 600, DevicePollInterval: 5, ConsentExpire: 600},
+		OIDC:     config.OIDCConfig{Issuer: "http://localhost:8080", IDTokenExpire: 600},
+		Email:    config.EmailConfig{VerifyLinkExpire: 600, VerifySecret: "test-verify-secret"},
+		MFA:      config.MFAConfig{Issuer: "Lite-Auth", TokenExpire: 300, TOTPSkew: 1},
+		WebAuthn: config.WebAuthnConfig{RPID: testRPID, RPDisplayName: "Lite-Auth", RPOrigins: []string{testOrigin}, ChallengeExpire: 300},
+	}
+
+	// Each test gets its own shared-cache database, named after the test
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	database.DB = db
+	if err := database.AutoMigrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	if err := jwt.InitKeys(&config.GlobalConfig.JWT); err != nil {
+		t.Fatalf("failed to init signing keys: %v", err)
+	}
+	if err := InitEmailVerification(&config.GlobalConfig.Email); err != nil {
+		t.Fatalf("failed to init email verification: %v", err)
+	}
+	InvalidateServiceRegistry()
+	return mr
+}
+
+// createTestUser creates an active user with the email <username>@example.com
+func createTestUser(t *testing.T, username, password string) *model.User {
+	t.Helper()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &model.User{Username: username, Email: username + "@example.com", Password: string(hash), Status: 1}
+	if err := database.DB.Create(user).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	return user
+}
+
+// createTestClient registers an active, SSO-enabled client with the secret <clientID>-secret
+func createTestClient(t *testing.T, clientID, redirectURI string) *model.Client {
+	t.Helper()
+
+	secret, err := bcrypt.GenerateFromPassword([]byte(clientID+"-secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &model.Client{
+		ClientID:     clientID,
+		ClientSecret: string(secret),
+		Name:         clientID,
+		RedirectURI:  redirectURI,
+		Status:       1,
+	}
+	if err := database.DB.Create(client).Error; err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	InvalidateServiceRegistry()
+	return client
+}
+
+// captureSecurityEvents records the security events emitted during the test instead of passing
+// them to the registered listeners
+func captureSecurityEvents(t *testing.T) *[]*SecurityEvent {
+	t.Helper()
+
+	var events []*SecurityEvent
+	securityListenerMu.Lock()
+	saved := securityListeners
+	securityListeners = []SecurityEventListener{func(ctx context.Context, event *SecurityEvent) {
+		events = append(events, event)
+	}}
+	securityListenerMu.Unlock()
+
+	t.Cleanup(func() {
+		securityListenerMu.Lock()
+		securityListeners = saved
+		securityListenerMu.Unlock()
+	})
+	return &events
+}
+
+// testMailer captures sent emails
+type testMailer struct {
+	messages chan *mailer.Message
+}
+
+func (m *testMailer) Send(ctx context.Context, msg *mailer.Message) error {
+	m.messages <- msg
+	return nil
+}
+
+// next waits for the next email, which the services send in the background
+func (m *testMailer) next(t *testing.T) *mailer.Message {
+	t.Helper()
+
+	select {
+	case msg := <-m.messages:
+		return msg
+	case <-time.After(3 * time.Second):
+		t.Fatal("no email was sent")
+		return nil
+	}
+}
+
+// captureMail replaces the mailer with one that records messages, using the built-in templates
+func captureMail(t *testing.T) *testMailer {
+	t.Helper()
+
+	if err := mailer.LoadTemplates(""); err != nil {
+		t.Fatalf("failed to load email templates: %v", err)
+	}
+	m := &testMailer{messages: make(chan *mailer.Message, 10)}
+	mailer.SetMailer(m, "noreply@example.com")
+	t.Cleanup(func() { mailer.SetMailer(nil, "") })
+	return m
+}
@@ -0,0 +1,461 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/joshleeeeee/go-lite-auth/internal/config"
+	"github.com/joshleeeeee/go-lite-auth/internal/database"
+	"github.com/joshleeeeee/go-lite-auth/internal/model"
+	"github.com/joshleeeeee/go-lite-auth/internal/repository"
+	"github.com/joshleeeeee/go-lite-auth/pkg/totp"
+	"github.com/redis/go-redis/v9"
+)
+
+// MFA errors
+var (
+	ErrInvalidMFAToken    = errors.New("mfa_token is invalid or expired")
+	ErrInvalidMFACode     = errors.New("invalid authentication code")
+	ErrMFAAlreadyEnabled  = errors.New("two-factor authentication is already enabled")
+	ErrMFANotEnabled      = errors.New("two-factor authentication is not enabled")
+	ErrTOTPNotEnrolled    = errors.New("start TOTP enrollment first")
+	ErrTooManyMFAAttempts = errors.New("too many authentication code attempts, please try again later")
+	ErrReauthRequired     = errors.New("confirm with your password or an authentication code")
+)
+
+// Recovery code configuration
+const (
+	RecoveryCodeCount    = 10
+	RecoveryCodeLength   = 10                                // characters, shown as xxxxx-xxxxx
+	RecoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789" // no look-alike characters
+)
+
+// MFAService handles TOTP enrollment and the second step of logins
+type MFAService struct {
+	userRepo     *repository.UserRepository
+	mfaRepo      *repository.MFARepository
+	webauthnRepo *repository.WebAuthnRepository
+	authService  *AuthService
+	ssoService   *SSOService
+}
+
+// NewMFAService creates a new MFAService instance
+func NewMFAService() *MFAService {
+	return &MFAService{
+		userRepo:     repository.NewUserRepository(),
+		mfaRepo:      repository.NewMFARepository(),
+		webauthnRepo: repository.NewWebAuthnRepository(),
+		authService:  NewAuthService(),
+		ssoService:   NewSSOService(),
+	}
+}
+
+// MFAVerifyRequest completes a login with a TOTP or recovery code
+type MFAVerifyRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// MFACodeRequest confirms an action with a TOTP or recovery code
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// LoginResult is a completed login: tokens for an API login, or a ticket for an SSO login
+type LoginResult struct {
+	Auth *AuthResponse
+	SSO  *SSOLoginResponse
+}
+
+// MFAStatus describes the second factors of a user
+type MFAStatus struct {
+	TOTPEnabled       bool  `json:"totp_enabled"`
+	Passkeys          int64 `json:"passkeys"`
+	RecoveryCodesLeft int64 `json:"recovery_codes_left"`
+}
+
+// TOTPEnrollment is what the user needs to add the account to an authenticator app
+type TOTPEnrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+	QRCode     string `json:"qr_code"` // PNG data URI of the otpauth URI
+}
+
+// startMFA parks a login that passed the first factor if the user has a second factor (TOTP
+// or a passkey), and returns the mfa_token to complete it; it returns an empty token otherwise
+func (s *AuthService) startMFA(ctx context.Context, challenge *database.MFAChallengeData) (string, error) {
+	enabled, err := s.mfaRepo.HasConfirmedTOTP(challenge.UserID)
+	if err != nil {
+		return "", err
+	}
+	if !enabled {
+		passkeys, err := s.webauthnRepo.CountByUser(challenge.UserID)
+		if err != nil {
+			return "", err
+		}
+		if passkeys == 0 {
+			return "", nil
+		}
+	}
+
+	token, err := generateAuthCode()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate mfa_token: %w", err)
+	}
+	if err := database.SetMFAChallenge(ctx, token, challenge, config.GlobalConfig.MFA.TokenDuration()); err != nil {
+		return "", fmt.Errorf("failed to store MFA challenge: %w", err)
+	}
+	return token, nil
+}
+
+// VerifyLogin exchanges an mfa_token and a TOTP or recovery code for the tokens, or the SSO
+// session and ticket, of the login it was issued for. Wrong codes count as failed logins.
+func (s *MFAService) VerifyLogin(ctx context.Context, req *MFAVerifyRequest) (*LoginResult, error) {
+	challenge, user, err := s.loadChallenge(ctx, req.MFAToken)
+	if err != nil {
+		return nil, err
+	}
+
+	methods, err := s.checkCode(ctx, user.ID, req.Code)
+	if err != nil {
+		if err == ErrInvalidMFACode {
+			database.IncrLoginFail(ctx, challenge.FailKey, LoginLockDuration)
+		}
+		return nil, err
+	}
+
+	return s.completeChallenge(ctx, req.MFAToken, challenge, user, methods)
+}
+
+// loadChallenge finds the pending login of an mfa_token, unless its user is locked out or disabled
+func (s *MFAService) loadChallenge(ctx context.Context, token string) (*database.MFAChallengeData, *model.User, error) {
+	challenge, err := database.GetMFAChallenge(ctx, token)
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil, ErrInvalidMFAToken
+		}
+		return nil, nil, err
+	}
+
+	failCount, err := database.GetLoginFailCount(ctx, challenge.FailKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	if failCount >= MaxLoginAttempts {
+		return nil, nil, ErrTooManyAttempts
+	}
+
+	user, err := s.userRepo.GetByID(challenge.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, nil, ErrInvalidMFAToken
+		}
+		return nil, nil, err
+	}
+	if user.Status != 1 {
+		return nil, nil, ErrUserDisabled
+	}
+	return challenge, user, nil
+}
+
+// completeChallenge consumes an mfa_token whose second factor was checked, and completes the
+// login with the methods of both factors
+func (s *MFAService) completeChallenge(ctx context.Context, token string, challenge *database.MFAChallengeData, user *model.User, methods []string) (*LoginResult, error) {
+	// The token is single-use, even when two correct codes race
+	consumed, err := database.DeleteMFAChallenge(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if !consumed {
+		return nil, ErrInvalidMFAToken
+	}
+	database.ClearLoginFail(ctx, challenge.FailKey)
+
+	if challenge.Service != "" {
+		resp, err := s.ssoService.completeLogin(ctx, user, challenge.Service, append(challenge.AMR, methods...))
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{SSO: resp}, nil
+	}
+
+	resp, err := s.authService.completeLogin(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResult{Auth: resp}, nil
+}
+
+// Status returns whether TOTP is enabled, how many passkeys are registered and how many
+// recovery codes are left
+func (s *MFAService) Status(userID uint) (*MFAStatus, error) {
+	enabled, err := s.mfaRepo.HasConfirmedTOTP(userID)
+	if err != nil {
+		return nil, err
+	}
+	status := &MFAStatus{TOTPEnabled: enabled}
+	if status.Passkeys, err = s.webauthnRepo.CountByUser(userID); err != nil {
+		return nil, err
+	}
+	if enabled || status.Passkeys > 0 {
+		if status.RecoveryCodesLeft, err = s.mfaRepo.CountUnusedRecoveryCodes(userID); err != nil {
+			return nil, err
+		}
+	}
+	return status, nil
+}
+
+// EnrollTOTP starts TOTP enrollment with a new secret, replacing any unconfirmed one.
+// TOTP is only enabled once ConfirmTOTP receives a code generated from the secret.
+func (s *MFAService) EnrollTOTP(userID uint) (*TOTPEnrollment, error) {
+	user, err := s.getUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	authenticator, err := s.mfaRepo.GetTOTP(userID)
+	if err != nil {
+		if !errors.Is(err, repository.ErrTOTPNotFound) {
+			return nil, err
+		}
+		authenticator = &model.UserTOTP{UserID: userID}
+	}
+	if authenticator.ConfirmedAt != nil {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	if authenticator.Secret, err = totp.GenerateSecret(); err != nil {
+		return nil, fmt.Errorf("failed to generate TOTP secret: %w", err)
+	}
+	if err := s.mfaRepo.SaveTOTP(authenticator); err != nil {
+		return nil, fmt.Errorf("failed to save TOTP secret: %w", err)
+	}
+
+	uri := totp.URI(config.GlobalConfig.MFA.Issuer, user.Username, authenticator.Secret)
+	png, err := totp.QRCode(uri)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render QR code: %w", err)
+	}
+
+	return &TOTPEnrollment{
+		Secret:     authenticator.Secret,
+		OTPAuthURI: uri,
+		QRCode:     "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+	}, nil
+}
+
+// ConfirmTOTP enables TOTP with a code from the enrolled authenticator, and returns the
+// recovery codes. They are stored hashed and are only available in this response.
+func (s *MFAService) ConfirmTOTP(ctx context.Context, userID uint, code string) ([]string, error) {
+	authenticator, err := s.mfaRepo.GetTOTP(userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrTOTPNotFound) {
+			return nil, ErrTOTPNotEnrolled
+		}
+		return nil, err
+	}
+	if authenticator.ConfirmedAt != nil {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	if err := s.throttle(ctx, userID, func() error {
+		return s.checkTOTP(ctx, authenticator, code)
+	}); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate recovery codes: %w", err)
+	}
+	now := time.Now()
+	authenticator.ConfirmedAt = &now
+	if err := s.mfaRepo.ConfirmTOTP(authenticator, hashes); err != nil {
+		return nil, fmt.Errorf("failed to enable TOTP: %w", err)
+	}
+
+	log.Printf("Auth: TOTP enabled for user %d", userID)
+	emitSecurityEvent(ctx, &SecurityEvent{Type: EventMFAEnabled, UserID: userID, Detail: "TOTP enabled"})
+	return codes, nil
+}
+
+// DisableTOTP turns two-factor authentication off after checking a TOTP or recovery code
+func (s *MFAService) DisableTOTP(ctx context.Context, userID uint, code string) error {
+	enabled, err := s.mfaRepo.HasConfirmedTOTP(userID)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return ErrMFANotEnabled
+	}
+
+	if err := s.throttle(ctx, userID, func() error {
+		_, err := s.checkCode(ctx, userID, code)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	// Recovery codes stay valid while passkeys remain the second factor
+	passkeys, err := s.webauthnRepo.CountByUser(userID)
+	if err != nil {
+		return err
+	}
+	if passkeys > 0 {
+		err = s.mfaRepo.DeleteTOTP(userID)
+	} else {
+		err = s.mfaRepo.DeleteMFA(userID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to disable TOTP: %w", err)
+	}
+
+	log.Printf("Auth: TOTP disabled for user %d", userID)
+	emitSecurityEvent(ctx, &SecurityEvent{Type: EventMFADisabled, UserID: userID, Detail: "TOTP disabled"})
+	return nil
+}
+
+// reauthenticate confirms a change to the factors of a signed-in user with their password, or a
+// TOTP or recovery code, so that a stolen access token alone cannot change them
+func (s *MFAService) reauthenticate(ctx context.Context, user *model.User, password, code string) error {
+	return s.throttle(ctx, user.ID, func() error {
+		switch {
+		case code != "":
+			_, err := s.checkCode(ctx, user.ID, code)
+			return err
+		case password != "":
+			if !s.authService.checkPassword(user, password) {
+				return ErrWrongPassword
+			}
+			return nil
+		default:
+			return ErrReauthRequired
+		}
+	})
+}
+
+// throttle runs a code or password check for an authenticated user, limiting wrong ones like logins
+func (s *MFAService) throttle(ctx context.Context, userID uint, check func() error) error {
+	failKey := fmt.Sprintf("mfa:%d", userID)
+	failCount, err := database.GetLoginFailCount(ctx, failKey)
+	if err != nil {
+		return fmt.Errorf("failed to check login attempts: %w", err)
+	}
+	if failCount >= MaxLoginAttempts {
+		return ErrTooManyMFAAttempts
+	}
+
+	if err := check(); err != nil {
+		if err == ErrInvalidMFACode || err == ErrWrongPassword {
+			database.IncrLoginFail(ctx, failKey, LoginLockDuration)
+		}
+		return err
+	}
+	database.ClearLoginFail(ctx, failKey)
+	return nil
+}
+
+// checkCode accepts a TOTP code of a user with TOTP enabled or an unused recovery code, and
+// returns the authentication methods it proves
+func (s *MFAService) checkCode(ctx context.Context, userID uint, code string) ([]string, error) {
+	code = normalizeMFACode(code)
+	if len(code) == totp.Digits {
+		authenticator, err := s.mfaRepo.GetTOTP(userID)
+		if err != nil {
+			if errors.Is(err, repository.ErrTOTPNotFound) {
+				return nil, ErrInvalidMFACode
+			}
+			return nil, err
+		}
+		if authenticator.ConfirmedAt == nil {
+			return nil, ErrInvalidMFACode
+		}
+		if err := s.checkTOTP(ctx, authenticator, code); err != nil {
+			return nil, err
+		}
+		return []string{AMROTP, AMRMFA}, nil
+	}
+
+	if err := s.mfaRepo.UseRecoveryCode(userID, hashRecoveryCode(code)); err != nil {
+		if errors.Is(err, repository.ErrRecoveryCodeNotFound) {
+			return nil, ErrInvalidMFACode
+		}
+		return nil, err
+	}
+	left, _ := s.mfaRepo.CountUnusedRecoveryCodes(userID)
+	log.Printf("Auth: user %d used a recovery code, %d left", userID, left)
+	return []string{AMRMFA}, nil
+}
+
+// checkTOTP validates a TOTP code and rejects a code that was already used
+func (s *MFAService) checkTOTP(ctx context.Context, authenticator *model.UserTOTP, code string) error {
+	skew := config.GlobalConfig.MFA.TOTPSkew
+	counter, ok := totp.Validate(authenticator.Secret, normalizeMFACode(code), time.Now(), skew)
+	if !ok {
+		return ErrInvalidMFACode
+	}
+
+	// A code stays acceptable for the whole skew window, so remember it for that long
+	window := time.Duration(2*skew+1) * totp.Period * time.Second
+	first, err := database.MarkTOTPUsed(ctx, authenticator.UserID, counter, window)
+	if err != nil {
+		return err
+	}
+	if !first {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// getUser finds a live user
+func (s *MFAService) getUser(id uint) (*model.User, error) {
+	user, err := s.userRepo.GetByID(id)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// generateRecoveryCodes returns new recovery codes, formatted for display, and their hashes
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, RecoveryCodeCount)
+	hashes := make([]string, RecoveryCodeCount)
+	max := big.NewInt(int64(len(RecoveryCodeAlphabet)))
+	for i := range codes {
+		code := make([]byte, RecoveryCodeLength)
+		for j := range code {
+			n, err := rand.Int(rand.Reader, max)
+			if err != nil {
+				return nil, nil, err
+			}
+			code[j] = RecoveryCodeAlphabet[n.Int64()]
+		}
+		half := RecoveryCodeLength / 2
+		codes[i] = string(code[:half]) + "-" + string(code[half:])
+		hashes[i] = hashRecoveryCode(string(code))
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode hashes a normalized recovery code for storage
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeMFACode accepts codes in any case, with or without spaces and dashes
+func normalizeMFACode(code string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(code))
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/joshleeeeee/go-lite-auth/internal/database"
+	"github.com/joshleeeeee/go-lite-auth/internal/model"
+	"github.com/joshleeeeee/go-lite-auth/pkg/totp"
+)
+
+// enableTestTOTP enables TOTP for a user and returns its secret
+func enableTestTOTP(t *testing.T, userID uint) string {
+	t.Helper()
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if err := database.DB.Create(&model.UserTOTP{UserID: userID, Secret: secret, ConfirmedAt: &now}).Error; err != nil {
+		t.Fatalf("failed to enable TOTP: %v", err)
+	}
+	return secret
+}
+
+// totpCode returns the code of the time step at offset steps from now
+func totpCode(t *testing.T, secret string, offset int) string {
+	t.Helper()
+
+	code, err := totp.Code(secret, uint64(int64(totp.Counter(time.Now()))+int64(offset)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestTOTPReplay(t *testing.T) {
+	tests := []struct {
+		name    string
+		offsets []int // time step of the code entered at each attempt
+		wantOK  []bool
+	}{
+		{"code used twice", []int{0, 0}, []bool{true, false}},
+		{"codes of different steps", []int{0, 1}, []bool{true, true}},
+		{"code of a later step replayed", []int{1, 0, 1}, []bool{true, true, false}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestEnv(t)
+			ctx := context.Background()
+			user := createTestUser(t, "alice", "password123")
+			secret := enableTestTOTP(t, user.ID)
+			s := NewMFAService()
+
+			for i, offset := range tt.offsets {
+				_, err := s.checkCode(ctx, user.ID, totpCode(t, secret, offset))
+				if ok := err == nil; ok != tt.wantOK[i] {
+					t.Errorf("attempt %d: checkCode() error = %v, want ok %v", i, err, tt.wantOK[i])
+				}
+				if err != nil && !errors.Is(err, ErrInvalidMFACode) {
+					t.Errorf("attempt %d: checkCode() error = %v, want ErrInvalidMFACode", i, err)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyLoginRejectsReplayedCode(t *testing.T) {
+	setupTestEnv(t)
+	ctx := context.Background()
+	user := createTestUser(t, "alice", "password123")
+	secret := enableTestTOTP(t, user.ID)
+	s := NewMFAService()
+
+	failKey := fmt.Sprintf("127.0.0.1:%s", user.Username)
+	login := func() string {
+		token, err := s.authService.startMFA(ctx, &database.MFAChallengeData{UserID: user.ID, FailKey: failKey, AMR: []string{AMRPassword}})
+		if err != nil || token == "" {
+			t.Fatalf("startMFA() = %q, %v", token, err)
+		}
+		return token
+	}
+
+	code := totpCode(t, secret, 0)
+	if _, err := s.VerifyLogin(ctx, &MFAVerifyRequest{MFAToken: login(), Code: code}); err != nil {
+		t.Fatalf("VerifyLogin() error = %v", err)
+	}
+
+	// A code observed during one login cannot complete another
+	if _, err := s.VerifyLogin(ctx, &MFAVerifyRequest{MFAToken: login(), Code: code}); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("VerifyLogin() with a replayed code error = %v, want ErrInvalidMFACode", err)
+	}
+	if count, _ := database.GetLoginFailCount(ctx, failKey); count != 1 {
+		t.Errorf("login failures = %d, want 1", count)
+	}
+}
@@ -0,0 +1,248 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/joshleeeeee/go-lite-auth/internal/config"
+	"github.com/joshleeeeee/go-lite-auth/internal/database"
+	"github.com/joshleeeeee/go-lite-auth/internal/model"
+	"github.com/joshleeeeee/go-lite-auth/internal/repository"
+	"github.com/redis/go-redis/v9"
+)
+
+// Consent errors
+var (
+	ErrInvalidConsentChallenge = errors.New("consent request is invalid or expired")
+	ErrGrantNotFound           = errors.New("grant not found")
+)
+
+// ScopeGrants lets a client token manage the user's grants; first-party tokens always can
+const ScopeGrants = "grants"
+
+// standardScopes are the built-in scopes every client may request, with their consent text. Their
+// text is fixed here so a client cannot describe access to the user's account in its own words
+var standardScopes = map[string]string{
+	ScopeOpenID:  "Sign you in with your account",
+	ScopeProfile: "View your name, nickname and picture",
+	ScopeEmail:   "View your email address",
+	ScopeAccount: "Change your profile, email address, password and two-factor settings",
+	ScopeGrants:  "View and revoke the access you have given to applications",
+}
+
+// ScopeDefinition describes a scope on the consent screen
+type ScopeDefinition struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// ConsentPrompt asks the user to grant a client the scopes it requested
+type ConsentPrompt struct {
+	ConsentChallenge  string            `json:"consent_challenge"`
+	ConsentURL        string            `json:"consent_url"`
+	ClientID          string            `json:"client_id"`
+	ClientName        string            `json:"client_name"`
+	ClientDescription string            `json:"client_description,omitempty"`
+	Scopes            []ScopeDefinition `json:"scopes"`
+}
+
+// AuthorizeResult is the outcome of an authorization request: either a redirect back to
+// the client or a consent prompt for the user
+type AuthorizeResult struct {
+	RedirectURL string
+	Consent     *ConsentPrompt
+}
+
+// GrantInfo describes a grant a user has given a client
+type GrantInfo struct {
+	ClientID          string            `json:"client_id"`
+	ClientName        string            `json:"client_name"`
+	ClientDescription string            `json:"client_description,omitempty"`
+	Scopes            []ScopeDefinition `json:"scopes"`
+	CreatedAt         time.Time         `json:"created_at"`
+	UpdatedAt         time.Time         `json:"updated_at"`
+}
+
+// Consent answers a consent prompt and returns the client redirect URL: with an authorization
+// code when the user approves, with access_denied otherwise
+func (s *OAuthService) Consent(ctx context.Context, challenge string, approve bool, user *model.User) (string, error) {
+	data, err := database.GetAndDeleteConsent(ctx, challenge)
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return "", ErrInvalidConsentChallenge
+		}
+		return "", err
+	}
+	if data.Code.UserID != user.ID {
+		return "", ErrInvalidConsentChallenge
+	}
+
+	if !approve {
+		return AuthorizeErrorRedirect(data.Code.RedirectURI, data.State,
+			newOAuthError(OAuthAccessDenied, "the user denied the authorization request")), nil
+	}
+
+	if err := s.saveGrant(user.ID, data.Code.ClientID, data.Code.Scope); err != nil {
+		return "", err
+	}
+	return s.issueAuthCode(ctx, &data.Code, data.State)
+}
+
+// ListGrants returns the grants a user has given, with the scopes described as on the consent screen
+func (s *OAuthService) ListGrants(userID uint) ([]GrantInfo, error) {
+	grants, err := s.grantRepo.ListByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]GrantInfo, 0, len(grants))
+	for _, grant := range grants {
+		info := GrantInfo{
+			ClientID:  grant.ClientID,
+			CreatedAt: grant.CreatedAt,
+			UpdatedAt: grant.UpdatedAt,
+		}
+		client, err := s.clientRepo.GetByClientID(grant.ClientID)
+		if err != nil && !errors.Is(err, repository.ErrClientNotFound) {
+			return nil, err
+		}
+		if client != nil {
+			info.ClientName = client.Name
+			info.ClientDescription = client.Description
+		}
+		info.Scopes = describeScopes(client, grant.Scope)
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// RevokeGrant withdraws the grant a user has given a client, and revokes the tokens the client holds
+func (s *OAuthService) RevokeGrant(ctx context.Context, userID uint, clientID string) error {
+	if err := s.grantRepo.Delete(userID, clientID); err != nil {
+		if errors.Is(err, repository.ErrGrantNotFound) {
+			return ErrGrantNotFound
+		}
+		return err
+	}
+	return s.authService.RevokeClientTokens(ctx, userID, clientID)
+}
+
+// requestConsent parks an authorization request until the user answers the consent prompt
+func (s *OAuthService) requestConsent(ctx context.Context, client *model.Client, scopes []ScopeDefinition, codeData *database.AuthCodeData, state string) (*ConsentPrompt, error) {
+	challenge, err := generateAuthCode()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate consent challenge: %w", err)
+	}
+
+	data := &database.ConsentData{Code: *codeData, State: state}
+	if err := database.SetConsent(ctx, challenge, data, config.GlobalConfig.OAuth.ConsentDuration()); err != nil {
+		return nil, fmt.Errorf("failed to store consent request: %w", err)
+	}
+
+	return &ConsentPrompt{
+		ConsentChallenge:  challenge,
+		ConsentURL:        "/oauth/consent",
+		ClientID:          client.ClientID,
+		ClientName:        client.Name,
+		ClientDescription: client.Description,
+		Scopes:            scopes,
+	}, nil
+}
+
+// isGranted reports whether the user has already consented to every requested scope for the client
+func (s *OAuthService) isGranted(userID uint, clientID, scope string) (bool, error) {
+	grant, err := s.grantRepo.Get(userID, clientID)
+	if err != nil {
+		if errors.Is(err, repository.ErrGrantNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	for _, requested := range strings.Fields(scope) {
+		if !hasScope(grant.Scope, requested) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// saveGrant remembers the scopes a user consented to, in addition to those granted before
+func (s *OAuthService) saveGrant(userID uint, clientID, scope string) error {
+	grant, err := s.grantRepo.Get(userID, clientID)
+	if err != nil {
+		if !errors.Is(err, repository.ErrGrantNotFound) {
+			return err
+		}
+		grant = &model.UserGrant{UserID: userID, ClientID: clientID}
+	}
+
+	grant.Scope = strings.Join(mergeScopes(grant.Scope, scope), " ")
+	if err := s.grantRepo.Save(grant); err != nil {
+		return fmt.Errorf("failed to save grant: %w", err)
+	}
+	return nil
+}
+
+// resolveScopes checks the requested scopes against the built-in scopes and those
+// defined for the client, and returns them without duplicates
+func resolveScopes(client *model.Client, scope string) ([]ScopeDefinition, error) {
+	scopes := make([]ScopeDefinition, 0)
+	for _, name := range mergeScopes("", scope) {
+		definition, ok := lookupScope(client, name)
+		if !ok {
+			return nil, newOAuthError(OAuthInvalidScope, "scope "+name+" is not defined for this client")
+		}
+		scopes = append(scopes, definition)
+	}
+	return scopes, nil
+}
+
+// describeScopes describes granted scopes, including any no longer defined for the client
+func describeScopes(client *model.Client, scope string) []ScopeDefinition {
+	scopes := make([]ScopeDefinition, 0)
+	for _, name := range strings.Fields(scope) {
+		definition, _ := lookupScope(client, name)
+		definition.Name = name
+		scopes = append(scopes, definition)
+	}
+	return scopes
+}
+
+// lookupScope finds the definition of a scope for a client (which may be nil)
+func lookupScope(client *model.Client, name string) (ScopeDefinition, bool) {
+	if description, ok := standardScopes[name]; ok {
+		return ScopeDefinition{Name: name, Description: description}, true
+	}
+	if client != nil {
+		for _, scope := range client.Scopes {
+			if scope.Name == name {
+				return ScopeDefinition{Name: scope.Name, Description: scope.Description}, true
+			}
+		}
+	}
+	return ScopeDefinition{}, false
+}
+
+// scopeString joins scope definitions into a space-separated scope parameter
+func scopeString(scopes []ScopeDefinition) string {
+	names := make([]string, len(scopes))
+	for i, scope := range scopes {
+		names[i] = scope.Name
+	}
+	return strings.Join(names, " ")
+}
+
+// mergeScopes returns the scopes of both space-separated lists, in order and without duplicates
+func mergeScopes(a, b string) []string {
+	merged := make([]string, 0)
+	for _, scope := range strings.Fields(a + " " + b) {
+		if !hasScope(strings.Join(merged, " "), scope) {
+			merged = append(merged, scope)
+		}
+	}
+	return merged
+}
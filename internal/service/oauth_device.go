@@ -0,0 +1,318 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/joshleeeeee/go-lite-auth/internal/config"
+	"github.com/joshleeeeee/go-lite-auth/internal/database"
+	"github.com/joshleeeeee/go-lite-auth/internal/model"
+	"github.com/joshleeeeee/go-lite-auth/internal/repository"
+	"github.com/joshleeeeee/go-lite-auth/pkg/jwt"
+	"github.com/redis/go-redis/v9"
+)
+
+// GrantDeviceCode is the device authorization grant type (RFC 8628)
+const GrantDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+
+// Device access token error codes (RFC 8628 section 3.5)
+const (
+	OAuthAuthorizationPending = "authorization_pending"
+	OAuthSlowDown             = "slow_down"
+	OAuthExpiredToken         = "expired_token"
+)
+
+// Device code configuration
+const (
+	UserCodeLength      = 8                      // Number of characters in a user code, shown as XXXX-XXXX
+	UserCodeAlphabet    = "BCDFGHJKLMNPQRSTVWXZ" // No vowels (no words) and no look-alike characters
+	DefaultPollInterval = 5                      // Seconds between polls when none is configured
+	SlowDownIncrement   = 5                      // Seconds added to the interval on every slow_down
+)
+
+// Device authorization errors
+var (
+	ErrInvalidUserCode = errors.New("user code is invalid or expired")
+)
+
+// DeviceAuthorizationRequest represents an RFC 8628 device authorization request
+type DeviceAuthorizationRequest struct {
+	ClientID     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+	Scope        string `form:"scope"`
+}
+
+// DeviceAuthorizationResponse represents an RFC 8628 device authorization response
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// DeviceVerification describes a pending device authorization to the user approving it
+type DeviceVerification struct {
+	UserCode          string            `json:"user_code"`
+	ClientID          string            `json:"client_id"`
+	ClientName        string            `json:"client_name"`
+	ClientDescription string            `json:"client_description,omitempty"`
+	Scopes            []ScopeDefinition `json:"scopes"`
+}
+
+// DeviceAuthorization starts a device authorization for a client that cannot receive a browser redirect
+func (s *OAuthService) DeviceAuthorization(ctx context.Context, req *DeviceAuthorizationRequest) (*DeviceAuthorizationResponse, error) {
+	client, err := s.AuthenticateClient(req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes, err := resolveScopes(client, req.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	deviceCode, err := generateAuthCode()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate device code: %w", err)
+	}
+	userCode, err := generateUserCode()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate user code: %w", err)
+	}
+
+	cfg := config.GlobalConfig.OAuth
+	interval := cfg.DevicePollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+
+	data := &database.DeviceCodeData{
+		ClientID: client.ClientID,
+		Scope:    scopeString(scopes),
+		UserCode: userCode,
+		Interval: interval,
+		Status:   database.DeviceStatusPending,
+	}
+	if err := database.SetDeviceCode(ctx, deviceCode, data, cfg.DeviceCodeDuration()); err != nil {
+		return nil, fmt.Errorf("failed to store device code: %w", err)
+	}
+
+	verificationURI := issuerURL() + "/oauth/device"
+	return &DeviceAuthorizationResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                formatUserCode(userCode),
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?user_code=" + url.QueryEscape(formatUserCode(userCode)),
+		ExpiresIn:               int64(cfg.DeviceCodeExpire),
+		Interval:                interval,
+	}, nil
+}
+
+// LookupDevice returns the pending device authorization a user code belongs to
+func (s *OAuthService) LookupDevice(ctx context.Context, userCode string) (*DeviceVerification, error) {
+	_, data, err := s.pendingDevice(ctx, userCode)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := s.clientRepo.GetByClientID(data.ClientID)
+	if err != nil {
+		if errors.Is(err, repository.ErrClientNotFound) {
+			return nil, ErrInvalidUserCode
+		}
+		return nil, err
+	}
+
+	return &DeviceVerification{
+		UserCode:          formatUserCode(data.UserCode),
+		ClientID:          client.ClientID,
+		ClientName:        client.Name,
+		ClientDescription: client.Description,
+		Scopes:            describeScopes(client, data.Scope),
+	}, nil
+}
+
+// VerifyDevice records the user's decision on a pending device authorization. Approving it
+// also grants the client the requested scopes.
+func (s *OAuthService) VerifyDevice(ctx context.Context, userCode string, approve bool, session *database.TGTData, user *model.User) error {
+	deviceCode, data, err := s.pendingDevice(ctx, userCode)
+	if err != nil {
+		return err
+	}
+
+	if !approve {
+		data.Status = database.DeviceStatusDenied
+	} else {
+		data.Status = database.DeviceStatusApproved
+		data.UserID = user.ID
+		data.Username = user.Username
+		data.AMR = session.AMR
+		data.AuthTime = session.CreatedAt
+	}
+
+	// Another decision or the expiry may have come in since the code was read
+	decided, err := database.DecideDeviceCode(ctx, deviceCode, data)
+	if err != nil {
+		return fmt.Errorf("failed to update device code: %w", err)
+	}
+	if !decided {
+		return ErrInvalidUserCode
+	}
+
+	if approve {
+		return s.saveGrant(user.ID, data.ClientID, data.Scope)
+	}
+	return nil
+}
+
+// pendingDevice resolves a user code to a device authorization that is still awaiting a decision
+func (s *OAuthService) pendingDevice(ctx context.Context, userCode string) (string, *database.DeviceCodeData, error) {
+	userCode = normalizeUserCode(userCode)
+	if userCode == "" {
+		return "", nil, ErrInvalidUserCode
+	}
+
+	deviceCode, err := database.GetDeviceCodeByUserCode(ctx, userCode)
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return "", nil, ErrInvalidUserCode
+		}
+		return "", nil, err
+	}
+
+	data, err := database.GetDeviceCode(ctx, deviceCode)
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return "", nil, ErrInvalidUserCode
+		}
+		return "", nil, err
+	}
+	if data.Status != database.DeviceStatusPending {
+		return "", nil, ErrInvalidUserCode
+	}
+
+	return deviceCode, data, nil
+}
+
+// exchangeDeviceCode answers a device polling the token endpoint
+func (s *OAuthService) exchangeDeviceCode(ctx context.Context, client *model.Client, req *TokenRequest) (*TokenResponse, error) {
+	if req.DeviceCode == "" {
+		return nil, newOAuthError(OAuthInvalidRequest, "device_code is required")
+	}
+
+	data, err := database.GetDeviceCode(ctx, req.DeviceCode)
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, newOAuthError(OAuthExpiredToken, "device code is invalid or expired")
+		}
+		return nil, err
+	}
+	if data.ClientID != client.ClientID {
+		return nil, newOAuthError(OAuthInvalidGrant, "device code was issued to another client")
+	}
+
+	// Devices polling faster than the interval are told to back off, for longer each time
+	ok, err := database.MarkDevicePoll(ctx, req.DeviceCode, time.Duration(data.Interval)*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if err := database.SlowDownDeviceCode(ctx, req.DeviceCode, SlowDownIncrement); err != nil {
+			return nil, err
+		}
+		return nil, newOAuthError(OAuthSlowDown, "")
+	}
+
+	if data.Status == database.DeviceStatusPending {
+		return nil, newOAuthError(OAuthAuthorizationPending, "")
+	}
+
+	// Atomically get and delete the code (ensures one-time use)
+	data, err = database.GetAndDeleteDeviceCode(ctx, req.DeviceCode)
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, newOAuthError(OAuthExpiredToken, "device code is invalid or expired")
+		}
+		return nil, err
+	}
+	if data.Status != database.DeviceStatusApproved {
+		return nil, newOAuthError(OAuthAccessDenied, "the user denied the authorization request")
+	}
+
+	user, err := s.userRepo.GetByID(data.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, newOAuthError(OAuthInvalidGrant, "user no longer exists")
+		}
+		return nil, err
+	}
+	if user.Status != 1 {
+		return nil, newOAuthError(OAuthInvalidGrant, ErrUserDisabled.Error())
+	}
+
+	tokenPair, err := s.authService.IssueTokenPair(ctx, user.ID, user.Username, &jwt.TokenOptions{
+		ClientID: client.ClientID,
+		Scope:    data.Scope,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	resp := newTokenResponse(tokenPair, data.Scope)
+
+	if hasScope(data.Scope, ScopeOpenID) {
+		resp.IDToken, err = generateIDToken(user, client.ClientID, &database.AuthCodeData{
+			AMR:      data.AMR,
+			AuthTime: data.AuthTime,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate ID token: %w", err)
+		}
+	}
+
+	return resp, nil
+}
+
+// generateUserCode generates a random user code from UserCodeAlphabet
+func generateUserCode() (string, error) {
+	code := make([]byte, UserCodeLength)
+	max := big.NewInt(int64(len(UserCodeAlphabet)))
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = UserCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// formatUserCode splits a user code in two halves for readability
+func formatUserCode(code string) string {
+	half := len(code) / 2
+	return code[:half] + "-" + code[half:]
+}
+
+// normalizeUserCode accepts user input in any case, with or without separators
+func normalizeUserCode(input string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(input) {
+		if strings.ContainsRune(UserCodeAlphabet, r) {
+			b.WriteRune(r)
+		} else if r != '-' && r != ' ' {
+			return ""
+		}
+	}
+	if b.Len() != UserCodeLength {
+		return ""
+	}
+	return b.String()
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/joshleeeeee/go-lite-auth/internal/database"
+	"github.com/joshleeeeee/go-lite-auth/internal/model"
+)
+
+// oauthErrorCode returns the OAuth error code of an error, or "" for other errors
+func oauthErrorCode(err error) string {
+	var oauthErr *OAuthError
+	if errors.As(err, &oauthErr) {
+		return oauthErr.Code
+	}
+	return ""
+}
+
+// startTestDevice starts a device authorization of client-a and returns its device and user codes
+func startTestDevice(t *testing.T, s *OAuthService) (string, string) {
+	t.Helper()
+
+	resp, err := s.DeviceAuthorization(context.Background(), &DeviceAuthorizationRequest{
+		ClientID:     "client-a",
+		ClientSecret: "client-a-secret",
+	})
+	if err != nil {
+		t.Fatalf("DeviceAuthorization() error = %v", err)
+	}
+	return resp.DeviceCode, resp.UserCode
+}
+
+func pollTestDevice(s *OAuthService, deviceCode string) (*TokenResponse, error) {
+	return s.Token(context.Background(), &TokenRequest{
+		GrantType:    GrantDeviceCode,
+		DeviceCode:   deviceCode,
+		ClientID:     "client-a",
+		ClientSecret: "client-a-secret",
+	})
+}
+
+func testSession(user *model.User) *database.TGTData {
+	return &database.TGTData{UserID: user.ID, Username: user.Username, AMR: []string{AMRPassword}, CreatedAt: time.Now()}
+}
+
+func TestDeviceCodeGrant(t *testing.T) {
+	tests := []struct {
+		name     string
+		decide   func(t *testing.T, s *OAuthService, userCode string, user *model.User)
+		wait     time.Duration
+		wantCode string // OAuth error code, "" for tokens
+	}{
+		{"pending", nil, 0, OAuthAuthorizationPending},
+		{"approved", func(t *testing.T, s *OAuthService, userCode string, user *model.User) {
+			if err := s.VerifyDevice(context.Background(), userCode, true, testSession(user), user); err != nil {
+				t.Fatalf("VerifyDevice() error = %v", err)
+			}
+		}, 0, ""},
+		{"denied", func(t *testing.T, s *OAuthService, userCode string, user *model.User) {
+			if err := s.VerifyDevice(context.Background(), userCode, false, testSession(user), user); err != nil {
+				t.Fatalf("VerifyDevice() error = %v", err)
+			}
+		}, 0, OAuthAccessDenied},
+		{"expired", nil, 601 * time.Second, OAuthExpiredToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr := setupTestEnv(t)
+			user := createTestUser(t, "alice", "password123")
+			createTestClient(t, "client-a", testRedirectURI)
+			s := NewOAuthService()
+			deviceCode, userCode := startTestDevice(t, s)
+
+			if tt.decide != nil {
+				tt.decide(t, s, userCode, user)
+			}
+			mr.FastForward(tt.wait)
+
+			resp, err := pollTestDevice(s, deviceCode)
+			if code := oauthErrorCode(err); code != tt.wantCode || (code == "" && err != nil) {
+				t.Fatalf("Token() error = %v, want %q", err, tt.wantCode)
+			}
+			if tt.wantCode == "" && (resp == nil || resp.AccessToken == "") {
+				t.Fatalf("Token() = %+v, want an access token", resp)
+			}
+
+			// Decided codes are single-use
+			if tt.wantCode != OAuthAuthorizationPending && tt.wantCode != OAuthExpiredToken {
+				mr.FastForward(6 * time.Second)
+				if _, err := pollTestDevice(s, deviceCode); oauthErrorCode(err) != OAuthExpiredToken {
+					t.Errorf("second Token() error = %v, want expired_token", err)
+				}
+			}
+		})
+	}
+}
+
+func TestDeviceCodeSlowDown(t *testing.T) {
+	mr := setupTestEnv(t)
+	ctx := context.Background()
+	user := createTestUser(t, "alice", "password123")
+	createTestClient(t, "client-a", testRedirectURI)
+	s := NewOAuthService()
+	deviceCode, userCode := startTestDevice(t, s)
+
+	if _, err := pollTestDevice(s, deviceCode); oauthErrorCode(err) != OAuthAuthorizationPending {
+		t.Fatalf("first Token() error = %v, want authorization_pending", err)
+	}
+	// Every poll within the interval backs the device off further
+	for i, wantInterval := range []int{10, 15} {
+		if _, err := pollTestDevice(s, deviceCode); oauthErrorCode(err) != OAuthSlowDown {
+			t.Fatalf("fast poll %d: Token() error = %v, want slow_down", i, err)
+		}
+		data, err := database.GetDeviceCode(ctx, deviceCode)
+		if err != nil || data.Interval != wantInterval {
+			t.Fatalf("fast poll %d: interval = %v, %v, want %d", i, data, err, wantInterval)
+		}
+	}
+
+	// A slow_down after the approval keeps the approval
+	if err := s.VerifyDevice(ctx, userCode, true, testSession(user), user); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pollTestDevice(s, deviceCode); oauthErrorCode(err) != OAuthSlowDown {
+		t.Fatalf("Token() error = %v, want slow_down", err)
+	}
+	mr.FastForward(21 * time.Second)
+	if resp, err := pollTestDevice(s, deviceCode); err != nil || resp.AccessToken == "" {
+		t.Fatalf("Token() after the interval = %+v, %v, want an access token", resp, err)
+	}
+}
+
+func TestDecideDeviceCodeOnlyOnce(t *testing.T) {
+	setupTestEnv(t)
+	ctx := context.Background()
+	user := createTestUser(t, "alice", "password123")
+	createTestClient(t, "client-a", testRedirectURI)
+	s := NewOAuthService()
+	deviceCode, userCode := startTestDevice(t, s)
+
+	// Both decisions read the code while it was pending
+	approval := &database.DeviceCodeData{Status: database.DeviceStatusApproved, UserID: user.ID, Username: user.Username}
+	denial := &database.DeviceCodeData{Status: database.DeviceStatusDenied}
+	if ok, err := database.DecideDeviceCode(ctx, deviceCode, approval); err != nil || !ok {
+		t.Fatalf("DecideDeviceCode() approval = %v, %v, want true", ok, err)
+	}
+	if ok, err := database.DecideDeviceCode(ctx, deviceCode, denial); err != nil || ok {
+		t.Fatalf("DecideDeviceCode() denial after the approval = %v, %v, want false", ok, err)
+	}
+	if err := s.VerifyDevice(ctx, userCode, false, testSession(user), user); !errors.Is(err, ErrInvalidUserCode) {
+		t.Errorf("VerifyDevice() of a decided code error = %v, want ErrInvalidUserCode", err)
+	}
+
+	data, err := database.GetDeviceCode(ctx, deviceCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Status != database.DeviceStatusApproved || data.UserID != user.ID || data.ClientID != "client-a" || data.UserCode == "" {
+		t.Errorf("device code = %+v, want the approval merged into the request", data)
+	}
+}
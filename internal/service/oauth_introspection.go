@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"log"
+	"strconv"
+
+	"github.com/joshleeeeee/go-lite-auth/pkg/jwt"
+)
+
+// Token type hints (RFC 7009 section 2.1, RFC 7662 section 2.1)
+const (
+	TokenTypeHintAccessToken  = "access_token"
+	TokenTypeHintRefreshToken = "refresh_token"
+)
+
+// IntrospectionRequest represents an RFC 7662 token introspection request
+type IntrospectionRequest struct {
+	Token         string `form:"token"`
+	TokenTypeHint string `form:"token_type_hint"`
+	ClientID      string `form:"client_id"`
+	ClientSecret  string `form:"client_secret"`
+}
+
+// IntrospectionResponse represents an RFC 7662 token introspection response.
+// Only "active" is present for tokens that are not active.
+type IntrospectionResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	Nbf       int64  `json:"nbf,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+	Iss       string `json:"iss,omitempty"`
+	Jti       string `json:"jti,omitempty"`
+}
+
+// Introspect reports whether a token is active and describes it. Only authenticated confidential
+// clients may introspect; any problem with the token itself yields active=false rather than an error.
+func (s *OAuthService) Introspect(ctx context.Context, req *IntrospectionRequest) (*IntrospectionResponse, error) {
+	client, err := s.AuthenticateClient(req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+	if client.Public {
+		return nil, newOAuthError(OAuthInvalidClient, "public clients may not introspect tokens")
+	}
+	if req.Token == "" {
+		return nil, newOAuthError(OAuthInvalidRequest, "token is required")
+	}
+
+	// Expired, malformed and revoked (blacklisted) tokens are all simply inactive
+	claims, err := s.authService.ValidateToken(ctx, req.Token)
+	if err != nil {
+		if err != jwt.ErrInvalidToken && err != jwt.ErrExpiredToken {
+			log.Printf("OAuth: token introspection failed: %v", err)
+		}
+		return &IntrospectionResponse{Active: false}, nil
+	}
+	// Other tokens signed with the same keys, such as ID tokens, are not access or refresh tokens
+	if claims.Type != jwt.AccessToken && claims.Type != jwt.RefreshToken {
+		return &IntrospectionResponse{Active: false}, nil
+	}
+
+	resp := &IntrospectionResponse{
+		Active:   true,
+		Scope:    claims.Scope,
+		ClientID: claims.ClientID,
+		Username: claims.Username,
+		Sub:      strconv.FormatUint(uint64(claims.UserID), 10),
+		Iss:      claims.Issuer,
+		Jti:      claims.TokenID,
+	}
+	// Client credentials tokens are about the client itself
+	if claims.IsClientToken() {
+		resp.Sub = claims.ClientID
+	}
+	if claims.Type == jwt.AccessToken {
+		resp.TokenType = "Bearer"
+	} else {
+		resp.TokenType = TokenTypeHintRefreshToken
+	}
+	if claims.ExpiresAt != nil {
+		resp.Exp = claims.ExpiresAt.Unix()
+	}
+	if claims.IssuedAt != nil {
+		resp.Iat = claims.IssuedAt.Unix()
+	}
+	if claims.NotBefore != nil {
+		resp.Nbf = claims.NotBefore.Unix()
+	}
+	return resp, nil
+}
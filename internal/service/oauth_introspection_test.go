@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/joshleeeeee/go-lite-auth/internal/config"
+	"github.com/joshleeeeee/go-lite-auth/pkg/jwt"
+)
+
+func TestIntrospect(t *testing.T) {
+	for _, alg := range []string{jwt.AlgHS256, jwt.AlgRS256, jwt.AlgES256, jwt.AlgEdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			setupTestEnv(t)
+			config.GlobalConfig.JWT.Algorithm = alg
+			if err := jwt.InitKeys(&config.GlobalConfig.JWT); err != nil {
+				t.Fatal(err)
+			}
+			ctx := context.Background()
+			user := createTestUser(t, "alice", "password123")
+			createTestClient(t, "client-a", testRedirectURI)
+			s := NewOAuthService()
+
+			pair, err := s.authService.IssueTokenPair(ctx, user.ID, user.Username, &jwt.TokenOptions{ClientID: "client-a", Scope: "openid"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			idToken, err := jwt.GenerateIDToken(subject(user), "client-a", &jwt.IDTokenClaims{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tests := []struct {
+				name          string
+				token         string
+				wantActive    bool
+				wantTokenType string
+			}{
+				{"access token", pair.AccessToken, true, "Bearer"},
+				{"refresh token", pair.RefreshToken, true, TokenTypeHintRefreshToken},
+				{"id token", idToken, false, ""},
+				{"malformed", "not-a-token", false, ""},
+			}
+			for _, tt := range tests {
+				resp, err := s.Introspect(ctx, &IntrospectionRequest{Token: tt.token, ClientID: "client-a", ClientSecret: "client-a-secret"})
+				if err != nil {
+					t.Fatalf("%s: Introspect() error = %v", tt.name, err)
+				}
+				if resp.Active != tt.wantActive || resp.TokenType != tt.wantTokenType {
+					t.Errorf("%s: Introspect() = %+v, want active %v and token_type %q", tt.name, resp, tt.wantActive, tt.wantTokenType)
+				}
+				if !tt.wantActive && *resp != (IntrospectionResponse{}) {
+					t.Errorf("%s: inactive response = %+v, want only active=false", tt.name, resp)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+
+	"github.com/joshleeeeee/go-lite-auth/pkg/jwt"
+)
+
+// RevocationRequest represents an RFC 7009 token revocation request
+type RevocationRequest struct {
+	Token         string `form:"token"`
+	TokenTypeHint string `form:"token_type_hint"`
+	ClientID      string `form:"client_id"`
+	ClientSecret  string `form:"client_secret"`
+}
+
+// Revoke revokes an access or refresh token issued to the calling client. Invalid, expired
+// and already revoked tokens are not an error, so the response never reveals token state.
+func (s *OAuthService) Revoke(ctx context.Context, req *RevocationRequest) error {
+	client, err := s.AuthenticateClient(req.ClientID, req.ClientSecret)
+	if err != nil {
+		return err
+	}
+	if req.Token == "" {
+		return newOAuthError(OAuthInvalidRequest, "token is required")
+	}
+
+	// The hint only has to be understood; JWTs describe their own type
+	switch req.TokenTypeHint {
+	case "", TokenTypeHintAccessToken, TokenTypeHintRefreshToken:
+	default:
+		return newOAuthError(OAuthUnsupportedTokenType, "")
+	}
+
+	claims, err := jwt.ParseToken(req.Token)
+	if err != nil {
+		return nil
+	}
+	if claims.ClientID != client.ClientID {
+		return newOAuthError(OAuthUnauthorizedClient, "token was not issued to this client")
+	}
+
+	return s.authService.RevokeToken(ctx, claims)
+}
@@ -0,0 +1,486 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/joshleeeeee/go-lite-auth/internal/config"
+	"github.com/joshleeeeee/go-lite-auth/internal/database"
+	"github.com/joshleeeeee/go-lite-auth/internal/model"
+	"github.com/joshleeeeee/go-lite-auth/internal/repository"
+	"github.com/joshleeeeee/go-lite-auth/pkg/jwt"
+	"github.com/redis/go-redis/v9"
+)
+
+// OAuth 2.0 error codes (RFC 6749 section 4.1.2.1 and 5.2)
+const (
+	OAuthInvalidRequest          = "invalid_request"
+	OAuthInvalidClient           = "invalid_client"
+	OAuthInvalidGrant            = "invalid_grant"
+	OAuthUnauthorizedClient      = "unauthorized_client"
+	OAuthUnsupportedGrantType    = "unsupported_grant_type"
+	OAuthUnsupportedResponseType = "unsupported_response_type"
+	OAuthInvalidScope            = "invalid_scope"
+	OAuthAccessDenied            = "access_denied"
+	OAuthLoginRequired           = "login_required"
+	OAuthConsentRequired         = "consent_required"
+	OAuthServerError             = "server_error"
+	OAuthUnsupportedTokenType    = "unsupported_token_type" // RFC 7009 section 2.2.1
+
+	// Bearer token errors (RFC 6750 section 3.1)
+	OAuthInvalidToken      = "invalid_token"
+	OAuthInsufficientScope = "insufficient_scope"
+)
+
+// OAuth grant types
+const (
+	GrantAuthorizationCode = "authorization_code"
+	GrantRefreshToken      = "refresh_token"
+	GrantClientCredentials = "client_credentials"
+)
+
+// PKCE code challenge methods (RFC 7636)
+const (
+	PKCEMethodS256  = "S256"
+	PKCEMethodPlain = "plain"
+)
+
+// Authorization code configuration
+const (
+	AuthCodeLength = 32 // Number of random bytes in an authorization code
+)
+
+// codeVerifierPattern is the RFC 7636 code_verifier syntax
+var codeVerifierPattern = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+// OAuthError is an RFC 6749 error response
+type OAuthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *OAuthError) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
+
+func newOAuthError(code, description string) *OAuthError {
+	return &OAuthError{Code: code, Description: description}
+}
+
+// OAuthService handles OAuth 2.0 authorization server logic
+type OAuthService struct {
+	userRepo    *repository.UserRepository
+	clientRepo  *repository.ClientRepository
+	grantRepo   *repository.GrantRepository
+	authService *AuthService
+}
+
+// NewOAuthService creates a new OAuthService instance
+func NewOAuthService() *OAuthService {
+	return &OAuthService{
+		userRepo:    repository.NewUserRepository(),
+		clientRepo:  repository.NewClientRepository(),
+		grantRepo:   repository.NewGrantRepository(),
+		authService: NewAuthService(),
+	}
+}
+
+// AuthorizeRequest represents an OAuth 2.0 authorization request
+type AuthorizeRequest struct {
+	ResponseType        string `form:"response_type"`
+	ClientID            string `form:"client_id"`
+	RedirectURI         string `form:"redirect_uri"`
+	Scope               string `form:"scope"`
+	State               string `form:"state"`
+	CodeChallenge       string `form:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method"`
+	Prompt              string `form:"prompt"`
+	Nonce               string `form:"nonce"`
+
+	redirectURIProvided bool // redirect_uri was part of the request, not the client's default
+}
+
+// TokenRequest represents an OAuth 2.0 token request
+type TokenRequest struct {
+	GrantType    string `form:"grant_type"`
+	Code         string `form:"code"`
+	RedirectURI  string `form:"redirect_uri"`
+	CodeVerifier string `form:"code_verifier"`
+	RefreshToken string `form:"refresh_token"`
+	DeviceCode   string `form:"device_code"`
+	Scope        string `form:"scope"`
+	ClientID     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+}
+
+// TokenResponse represents an OAuth 2.0 access token response
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+}
+
+// ResolveAuthorizeClient validates the client and redirect URI of an authorization request.
+// Errors from this step must be shown to the user instead of being redirected to the client.
+func (s *OAuthService) ResolveAuthorizeClient(req *AuthorizeRequest) (*model.Client, error) {
+	if req.ClientID == "" {
+		return nil, newOAuthError(OAuthInvalidRequest, "client_id is required")
+	}
+
+	client, err := s.clientRepo.GetByClientID(req.ClientID)
+	if err != nil {
+		if errors.Is(err, repository.ErrClientNotFound) {
+			return nil, newOAuthError(OAuthInvalidClient, "unknown client")
+		}
+		return nil, err
+	}
+	if client.Status != 1 {
+		return nil, newOAuthError(OAuthInvalidClient, "client is disabled")
+	}
+
+	// Fall back to the client's primary redirect URI when none is given
+	req.redirectURIProvided = req.RedirectURI != ""
+	if req.RedirectURI == "" {
+		req.RedirectURI = client.RedirectURI
+	}
+	if !isRegisteredRedirectURI(client, req.RedirectURI) {
+		return nil, newOAuthError(OAuthInvalidRequest, "redirect_uri is not registered for this client")
+	}
+
+	return client, nil
+}
+
+// Authorize issues an authorization code for the user of the SSO session and returns the client redirect URL.
+// Until the user has consented to the requested scopes, a consent prompt is returned instead.
+func (s *OAuthService) Authorize(ctx context.Context, client *model.Client, req *AuthorizeRequest, session *database.TGTData, user *model.User) (*AuthorizeResult, error) {
+	if req.ResponseType != "code" {
+		return nil, newOAuthError(OAuthUnsupportedResponseType, "only response_type=code is supported")
+	}
+
+	// PKCE: public clients must prove possession of the code verifier with S256
+	method := req.CodeChallengeMethod
+	if req.CodeChallenge != "" && method == "" {
+		method = PKCEMethodPlain
+	}
+	switch {
+	case req.CodeChallenge == "" && client.Public:
+		return nil, newOAuthError(OAuthInvalidRequest, "code_challenge is required for public clients")
+	case client.Public && method != PKCEMethodS256:
+		return nil, newOAuthError(OAuthInvalidRequest, "public clients must use code_challenge_method=S256")
+	case req.CodeChallenge != "" && method != PKCEMethodS256 && method != PKCEMethodPlain:
+		return nil, newOAuthError(OAuthInvalidRequest, "unsupported code_challenge_method")
+	}
+
+	scopes, err := resolveScopes(client, req.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	codeData := &database.AuthCodeData{
+		ClientID:            client.ClientID,
+		UserID:              user.ID,
+		Username:            user.Username,
+		RedirectURI:         req.RedirectURI,
+		RedirectURIProvided: req.redirectURIProvided,
+		Scope:               scopeString(scopes),
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: method,
+		Nonce:               req.Nonce,
+		AMR:                 session.AMR,
+		AuthTime:            session.CreatedAt,
+	}
+
+	// Ask for consent the first time, whenever new scopes are requested, or when the client insists
+	granted, err := s.isGranted(user.ID, client.ClientID, codeData.Scope)
+	if err != nil {
+		return nil, err
+	}
+	if !granted || req.Prompt == "consent" {
+		if req.Prompt == "none" {
+			return nil, newOAuthError(OAuthConsentRequired, "")
+		}
+		prompt, err := s.requestConsent(ctx, client, scopes, codeData, req.State)
+		if err != nil {
+			return nil, err
+		}
+		return &AuthorizeResult{Consent: prompt}, nil
+	}
+
+	redirectURL, err := s.issueAuthCode(ctx, codeData, req.State)
+	if err != nil {
+		return nil, err
+	}
+	return &AuthorizeResult{RedirectURL: redirectURL}, nil
+}
+
+// issueAuthCode stores a new authorization code and returns the client redirect URL carrying it
+func (s *OAuthService) issueAuthCode(ctx context.Context, codeData *database.AuthCodeData, state string) (string, error) {
+	code, err := generateAuthCode()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate authorization code: %w", err)
+	}
+
+	if err := database.SetAuthCode(ctx, code, codeData, config.GlobalConfig.OAuth.AuthCodeDuration()); err != nil {
+		return "", fmt.Errorf("failed to store authorization code: %w", err)
+	}
+
+	return buildAuthorizeRedirect(codeData.RedirectURI, url.Values{
+		"code":  {code},
+		"state": {state},
+	}), nil
+}
+
+// AuthorizeErrorRedirect builds the client redirect URL carrying an authorization error
+func AuthorizeErrorRedirect(redirectURI, state string, oauthErr *OAuthError) string {
+	return buildAuthorizeRedirect(redirectURI, url.Values{
+		"error":             {oauthErr.Code},
+		"error_description": {oauthErr.Description},
+		"state":             {state},
+	})
+}
+
+// Token handles the token endpoint for the supported grant types
+func (s *OAuthService) Token(ctx context.Context, req *TokenRequest) (*TokenResponse, error) {
+	client, err := s.AuthenticateClient(req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	switch req.GrantType {
+	case GrantAuthorizationCode:
+		return s.exchangeAuthorizationCode(ctx, client, req)
+	case GrantRefreshToken:
+		return s.refresh(ctx, client, req)
+	case GrantClientCredentials:
+		return s.clientCredentials(client, req)
+	case GrantDeviceCode:
+		return s.exchangeDeviceCode(ctx, client, req)
+	case "":
+		return nil, newOAuthError(OAuthInvalidRequest, "grant_type is required")
+	default:
+		return nil, newOAuthError(OAuthUnsupportedGrantType, "")
+	}
+}
+
+// AuthenticateClient authenticates the calling client. Confidential clients must present their
+// secret; public clients are identified by client_id alone.
+func (s *OAuthService) AuthenticateClient(clientID, clientSecret string) (*model.Client, error) {
+	if clientID == "" {
+		return nil, newOAuthError(OAuthInvalidClient, "client authentication required")
+	}
+
+	client, err := s.clientRepo.GetByClientID(clientID)
+	if err != nil {
+		if errors.Is(err, repository.ErrClientNotFound) {
+			return nil, newOAuthError(OAuthInvalidClient, "client authentication failed")
+		}
+		return nil, err
+	}
+	if client.Status != 1 {
+		return nil, newOAuthError(OAuthInvalidClient, "client authentication failed")
+	}
+
+	if !client.Public && !s.checkClientSecret(client, clientSecret) {
+		return nil, newOAuthError(OAuthInvalidClient, "client authentication failed")
+	}
+
+	return client, nil
+}
+
+// exchangeAuthorizationCode redeems a one-time authorization code for tokens
+func (s *OAuthService) exchangeAuthorizationCode(ctx context.Context, client *model.Client, req *TokenRequest) (*TokenResponse, error) {
+	if req.Code == "" {
+		return nil, newOAuthError(OAuthInvalidRequest, "code is required")
+	}
+
+	// Atomically get and delete the code (ensures one-time use)
+	codeData, err := database.GetAndDeleteAuthCode(ctx, req.Code)
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, newOAuthError(OAuthInvalidGrant, "authorization code is invalid or expired")
+		}
+		return nil, err
+	}
+
+	if codeData.ClientID != client.ClientID {
+		return nil, newOAuthError(OAuthInvalidGrant, "authorization code was issued to another client")
+	}
+	// RFC 6749 section 4.1.3: redirect_uri is required when the authorization request included it
+	if codeData.RedirectURIProvided && req.RedirectURI == "" {
+		return nil, newOAuthError(OAuthInvalidGrant, "redirect_uri is required")
+	}
+	if req.RedirectURI != "" && req.RedirectURI != codeData.RedirectURI {
+		return nil, newOAuthError(OAuthInvalidGrant, "redirect_uri does not match the authorization request")
+	}
+	if err := verifyCodeVerifier(codeData, req.CodeVerifier); err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByID(codeData.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, newOAuthError(OAuthInvalidGrant, "user no longer exists")
+		}
+		return nil, err
+	}
+	if user.Status != 1 {
+		return nil, newOAuthError(OAuthInvalidGrant, ErrUserDisabled.Error())
+	}
+
+	tokenPair, err := s.authService.IssueTokenPair(ctx, user.ID, user.Username, &jwt.TokenOptions{
+		ClientID: client.ClientID,
+		Scope:    codeData.Scope,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	resp := newTokenResponse(tokenPair, codeData.Scope)
+
+	// OpenID Connect: authenticate the user to the client with an ID token
+	if hasScope(codeData.Scope, ScopeOpenID) {
+		resp.IDToken, err = generateIDToken(user, client.ClientID, codeData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate ID token: %w", err)
+		}
+	}
+
+	return resp, nil
+}
+
+// refresh rotates a refresh token that was issued to the calling client
+func (s *OAuthService) refresh(ctx context.Context, client *model.Client, req *TokenRequest) (*TokenResponse, error) {
+	if req.RefreshToken == "" {
+		return nil, newOAuthError(OAuthInvalidRequest, "refresh_token is required")
+	}
+
+	claims, err := jwt.ParseToken(req.RefreshToken)
+	if err != nil || claims.Type != jwt.RefreshToken || claims.ClientID != client.ClientID {
+		return nil, newOAuthError(OAuthInvalidGrant, "refresh token is invalid or expired")
+	}
+
+	tokenPair, err := s.authService.RefreshToken(ctx, req.RefreshToken)
+	if err != nil {
+		return nil, newOAuthError(OAuthInvalidGrant, "refresh token is invalid or expired")
+	}
+
+	return newTokenResponse(tokenPair, claims.Scope), nil
+}
+
+// clientCredentials issues an access token to a confidential client acting on its own behalf
+func (s *OAuthService) clientCredentials(client *model.Client, req *TokenRequest) (*TokenResponse, error) {
+	if client.Public {
+		return nil, newOAuthError(OAuthUnauthorizedClient, "public clients may not use the client_credentials grant")
+	}
+
+	// There is no end-user, so the built-in scopes, which all act on one, cannot be granted
+	for _, scope := range strings.Fields(req.Scope) {
+		if _, ok := standardScopes[scope]; ok {
+			return nil, newOAuthError(OAuthInvalidScope, "scope "+scope+" requires an end-user")
+		}
+	}
+	scopes, err := resolveScopes(client, req.Scope)
+	if err != nil {
+		return nil, err
+	}
+	scope := scopeString(scopes)
+
+	tokenPair, err := jwt.GenerateClientToken(client.ClientID, scope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	return newTokenResponse(tokenPair, scope), nil
+}
+
+// newTokenResponse converts a token pair into an RFC 6749 token response
+func newTokenResponse(tokenPair *jwt.TokenPair, scope string) *TokenResponse {
+	return &TokenResponse{
+		AccessToken:  tokenPair.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    tokenPair.ExpiresIn,
+		RefreshToken: tokenPair.RefreshToken,
+		Scope:        scope,
+	}
+}
+
+// verifyCodeVerifier checks the PKCE code_verifier against the stored code challenge
+func verifyCodeVerifier(codeData *database.AuthCodeData, verifier string) error {
+	if codeData.CodeChallenge == "" {
+		if verifier != "" {
+			return newOAuthError(OAuthInvalidGrant, "code_verifier was not expected")
+		}
+		return nil
+	}
+
+	if !codeVerifierPattern.MatchString(verifier) {
+		return newOAuthError(OAuthInvalidGrant, "code_verifier is missing or malformed")
+	}
+
+	expected := verifier
+	if codeData.CodeChallengeMethod == PKCEMethodS256 {
+		sum := sha256.Sum256([]byte(verifier))
+		expected = base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(codeData.CodeChallenge)) != 1 {
+		return newOAuthError(OAuthInvalidGrant, "code_verifier does not match the code challenge")
+	}
+	return nil
+}
+
+// isRegisteredRedirectURI reports whether the redirect URI exactly matches one registered for the client
+func isRegisteredRedirectURI(client *model.Client, redirectURI string) bool {
+	if redirectURI == "" {
+		return false
+	}
+	if client.RedirectURI == redirectURI {
+		return true
+	}
+	for _, uri := range client.ServiceURIs {
+		if (uri.MatchType == model.MatchExact || uri.MatchType == "") && uri.Pattern == redirectURI {
+			return true
+		}
+	}
+	return false
+}
+
+// generateAuthCode generates a random URL-safe authorization code
+func generateAuthCode() (string, error) {
+	bytes := make([]byte, AuthCodeLength)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+// buildAuthorizeRedirect appends non-empty parameters to the client redirect URI
+func buildAuthorizeRedirect(redirectURI string, params url.Values) string {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return redirectURI
+	}
+
+	query := u.Query()
+	for key, values := range params {
+		if len(values) > 0 && values[0] != "" {
+			query.Set(key, values[0])
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
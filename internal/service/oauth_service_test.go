@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joshleeeeee/go-lite-auth/internal/database"
+	"github.com/joshleeeeee/go-lite-auth/internal/model"
+)
+
+// RFC 7636 appendix B
+const (
+	testCodeVerifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	testCodeChallenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+)
+
+func TestVerifyCodeVerifier(t *testing.T) {
+	tests := []struct {
+		name      string
+		challenge string
+		method    string
+		verifier  string
+		wantErr   bool
+	}{
+		{"S256", testCodeChallenge, PKCEMethodS256, testCodeVerifier, false},
+		{"S256 wrong verifier", testCodeChallenge, PKCEMethodS256, strings.Repeat("a", 43), true},
+		{"S256 missing verifier", testCodeChallenge, PKCEMethodS256, "", true},
+		{"S256 verifier sent as the challenge", testCodeChallenge, PKCEMethodS256, testCodeChallenge, true},
+		{"plain", testCodeVerifier, PKCEMethodPlain, testCodeVerifier, false},
+		{"plain mismatch", testCodeVerifier, PKCEMethodPlain, strings.Repeat("b", 43), true},
+		{"verifier too short", strings.Repeat("c", 42), PKCEMethodPlain, strings.Repeat("c", 42), true},
+		{"verifier too long", strings.Repeat("d", 129), PKCEMethodPlain, strings.Repeat("d", 129), true},
+		{"verifier with invalid characters", strings.Repeat("e", 42) + "+", PKCEMethodPlain, strings.Repeat("e", 42) + "+", true},
+		{"no PKCE", "", "", "", false},
+		{"unexpected verifier", "", "", testCodeVerifier, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			codeData := &database.AuthCodeData{CodeChallenge: tt.challenge, CodeChallengeMethod: tt.method}
+			err := verifyCodeVerifier(codeData, tt.verifier)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("verifyCodeVerifier() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var oauthErr *OAuthError
+			if tt.wantErr && (!errors.As(err, &oauthErr) || oauthErr.Code != OAuthInvalidGrant) {
+				t.Errorf("verifyCodeVerifier() error = %v, want invalid_grant", err)
+			}
+		})
+	}
+}
+
+func TestExchangeAuthorizationCodeRedirectURI(t *testing.T) {
+	tests := []struct {
+		name        string
+		provided    bool
+		redirectURI string
+		wantErr     bool
+	}{
+		{"repeated", true, testRedirectURI, false},
+		{"missing", true, "", true},
+		{"mismatched", true, "https://app.example.com/other", true},
+		{"defaulted and omitted", false, "", false},
+		{"defaulted and repeated", false, testRedirectURI, false},
+		{"defaulted and mismatched", false, "https://app.example.com/other", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestEnv(t)
+			ctx := context.Background()
+			user := createTestUser(t, "alice", "password123")
+			client := createTestClient(t, "app", testRedirectURI)
+
+			codeData := &database.AuthCodeData{
+				ClientID:            client.ClientID,
+				UserID:              user.ID,
+				Username:            user.Username,
+				RedirectURI:         testRedirectURI,
+				RedirectURIProvided: tt.provided,
+				AuthTime:            time.Now(),
+			}
+			if err := database.SetAuthCode(ctx, "code", codeData, time.Minute); err != nil {
+				t.Fatal(err)
+			}
+
+			s := NewOAuthService()
+			resp, err := s.exchangeAuthorizationCode(ctx, client, &TokenRequest{GrantType: "authorization_code", Code: "code", RedirectURI: tt.redirectURI})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("exchangeAuthorizationCode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var oauthErr *OAuthError
+			if tt.wantErr && (!errors.As(err, &oauthErr) || oauthErr.Code != OAuthInvalidGrant) {
+				t.Errorf("exchangeAuthorizationCode() error = %v, want invalid_grant", err)
+			}
+			if !tt.wantErr && resp.AccessToken == "" {
+				t.Error("no access token issued")
+			}
+		})
+	}
+}
+
+func TestResolveAuthorizeClientRecordsRedirectURI(t *testing.T) {
+	setupTestEnv(t)
+	createTestClient(t, "app", testRedirectURI)
+	s := NewOAuthService()
+
+	for _, redirectURI := range []string{"", testRedirectURI} {
+		req := &AuthorizeRequest{ClientID: "app", RedirectURI: redirectURI}
+		if _, err := s.ResolveAuthorizeClient(req); err != nil {
+			t.Fatalf("ResolveAuthorizeClient(%q) error = %v", redirectURI, err)
+		}
+		if req.RedirectURI != testRedirectURI || req.redirectURIProvided != (redirectURI != "") {
+			t.Errorf("ResolveAuthorizeClient(%q) = %q, provided %v", redirectURI, req.RedirectURI, req.redirectURIProvided)
+		}
+	}
+}
+
+func TestResolveBuiltInScopes(t *testing.T) {
+	// A client-defined scope cannot replace the consent text of a built-in one
+	client := &model.Client{ClientID: "app", Scopes: []model.ClientScope{
+		{Name: ScopeAccount, Description: "Nothing to worry about"},
+		{Name: "calendar", Description: "View your calendar"},
+	}}
+
+	scopes, err := resolveScopes(client, "openid account grants calendar")
+	if err != nil {
+		t.Fatalf("resolveScopes() error = %v", err)
+	}
+	for _, scope := range scopes {
+		want := standardScopes[scope.Name]
+		if scope.Name == "calendar" {
+			want = "View your calendar"
+		}
+		if scope.Description != want {
+			t.Errorf("scope %s described as %q, want %q", scope.Name, scope.Description, want)
+		}
+	}
+	if _, err := resolveScopes(&model.Client{ClientID: "app"}, "account grants"); err != nil {
+		t.Errorf("resolveScopes() of built-in scopes without client definitions error = %v", err)
+	}
+}
+
+func TestClientCredentialsScopes(t *testing.T) {
+	tests := []struct {
+		name     string
+		scope    string
+		wantCode string // OAuth error code, "" for a token
+	}{
+		{"no scope", "", ""},
+		{"client scope", "calendar", ""},
+		{"openid", ScopeOpenID, OAuthInvalidScope},
+		{"account", ScopeAccount, OAuthInvalidScope},
+		{"grants with a client scope", "calendar " + ScopeGrants, OAuthInvalidScope},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestEnv(t)
+			client := createTestClient(t, "app", testRedirectURI)
+			// Even when the client defines them itself
+			client.Scopes = []model.ClientScope{
+				{Name: "calendar", Description: "View your calendar"},
+				{Name: ScopeAccount, Description: "Manage your account"},
+				{Name: ScopeGrants, Description: "Manage your grants"},
+			}
+
+			s := NewOAuthService()
+			resp, err := s.clientCredentials(client, &TokenRequest{GrantType: GrantClientCredentials, Scope: tt.scope})
+			if code := oauthErrorCode(err); code != tt.wantCode || (code == "" && err != nil) {
+				t.Fatalf("clientCredentials() error = %v, want %q", err, tt.wantCode)
+			}
+			if tt.wantCode == "" && (resp.AccessToken == "" || resp.Scope != tt.scope) {
+				t.Errorf("clientCredentials() = %+v, want a token with scope %q", resp, tt.scope)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/joshleeeeee/go-lite-auth/internal/config"
+	"github.com/joshleeeeee/go-lite-auth/internal/database"
+	"github.com/joshleeeeee/go-lite-auth/internal/model"
+	"github.com/joshleeeeee/go-lite-auth/internal/repository"
+	"github.com/joshleeeeee/go-lite-auth/pkg/jwt"
+)
+
+// OIDC-related errors
+var (
+	ErrInsufficientScope = errors.New("token does not carry the openid scope")
+)
+
+// OpenID Connect scopes
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+// Authentication method references (RFC 8176)
+const (
+	AMRPassword    = "pwd"
+	AMROTP         = "otp"
+	AMRMFA         = "mfa"
+	AMRHardwareKey = "hwk"
+	AMREmail       = "email" // magic link or email OTP; not registered in RFC 8176
+)
+
+// Authentication context class references
+const (
+	ACRSingleFactor = "urn:lite-auth:acr:1"
+	ACRMultiFactor  = "urn:lite-auth:acr:2"
+)
+
+// OIDCService handles OpenID Connect provider logic
+type OIDCService struct {
+	userRepo *repository.UserRepository
+}
+
+// NewOIDCService creates a new OIDCService instance
+func NewOIDCService() *OIDCService {
+	return &OIDCService{
+		userRepo: repository.NewUserRepository(),
+	}
+}
+
+// ProviderMetadata is the OpenID Provider discovery document
+type ProviderMetadata struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	DeviceAuthorizationEndpoint       string   `json:"device_authorization_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+// Discovery returns the OpenID Provider metadata
+func (s *OIDCService) Discovery() *ProviderMetadata {
+	issuer := issuerURL()
+	return &ProviderMetadata{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/oauth/authorize",
+		TokenEndpoint:                     issuer + "/oauth/token",
+		UserInfoEndpoint:                  issuer + "/oauth/userinfo",
+		IntrospectionEndpoint:             issuer + "/oauth/introspect",
+		RevocationEndpoint:                issuer + "/oauth/revoke",
+		DeviceAuthorizationEndpoint:       issuer + "/oauth/device_authorization",
+		JWKSURI:                           issuer + "/jwks.json",
+		ScopesSupported:                   []string{ScopeOpenID, ScopeProfile, ScopeEmail},
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{GrantAuthorizationCode, GrantRefreshToken, GrantClientCredentials, GrantDeviceCode},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  jwt.IDTokenSigningAlgorithms(),
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{PKCEMethodS256, PKCEMethodPlain},
+		ClaimsSupported: []string{
+			"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "acr", "amr",
+			"name", "nickname", "preferred_username", "picture", "updated_at", "email",
+		},
+	}
+}
+
+// UserInfo returns the claims about the token's user that its scopes allow
+func (s *OIDCService) UserInfo(claims *jwt.Claims) (map[string]interface{}, error) {
+	if !hasScope(claims.Scope, ScopeOpenID) {
+		return nil, ErrInsufficientScope
+	}
+
+	user, err := s.userRepo.GetByID(claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Status != 1 {
+		return nil, ErrUserDisabled
+	}
+
+	info := map[string]interface{}{
+		"sub": subject(user),
+	}
+	if hasScope(claims.Scope, ScopeProfile) {
+		info["name"] = displayName(user)
+		info["nickname"] = user.Nickname
+		info["preferred_username"] = user.Username
+		if user.Avatar != "" {
+			info["picture"] = user.Avatar
+		}
+		info["updated_at"] = user.UpdatedAt.Unix()
+	}
+	if hasScope(claims.Scope, ScopeEmail) {
+		info["email"] = user.Email
+	}
+	return info, nil
+}
+
+// generateIDToken issues the ID token for an authorization code redeemed by a client
+func generateIDToken(user *model.User, clientID string, codeData *database.AuthCodeData) (string, error) {
+	return jwt.GenerateIDToken(subject(user), clientID, &jwt.IDTokenClaims{
+		Nonce:    codeData.Nonce,
+		AuthTime: codeData.AuthTime.Unix(),
+		ACR:      acrFor(codeData.AMR),
+		AMR:      codeData.AMR,
+	})
+}
+
+// acrFor returns the authentication context class of a login with the given methods
+func acrFor(amr []string) string {
+	for _, method := range amr {
+		if method == AMRMFA {
+			return ACRMultiFactor
+		}
+	}
+	return ACRSingleFactor
+}
+
+// issuerURL returns the configured issuer without a trailing slash
+func issuerURL() string {
+	return strings.TrimSuffix(config.GlobalConfig.OIDC.Issuer, "/")
+}
+
+// subject returns the stable OIDC subject identifier of a user
+func subject(user *model.User) string {
+	return strconv.FormatUint(uint64(user.ID), 10)
+}
+
+// displayName returns the user's nickname, falling back to the username
+func displayName(user *model.User) string {
+	if user.Nickname != "" {
+		return user.Nickname
+	}
+	return user.Username
+}
+
+// hasScope reports whether a space-separated scope string contains the scope
+func hasScope(scopes, scope string) bool {
+	for _, s := range strings.Fields(scopes) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+
+	"github.com/joshleeeeee/go-lite-auth/internal/config"
+	"github.com/joshleeeeee/go-lite-auth/internal/database"
+	"github.com/joshleeeeee/go-lite-auth/internal/model"
+	"github.com/joshleeeeee/go-lite-auth/internal/repository"
+	"github.com/joshleeeeee/go-lite-auth/pkg/hasher"
+	"github.com/joshleeeeee/go-lite-auth/pkg/mailer"
+	"github.com/redis/go-redis/v9"
+)
+
+// Password reset errors
+var (
+	ErrInvalidResetToken = errors.New("reset token is invalid or expired")
+)
+
+// ForgotPasswordRequest asks for a password reset link
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordWithTokenRequest sets a new password with a reset token
+type ResetPasswordWithTokenRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,min=6,max=50"`
+}
+
+// ForgotPassword emails a single-use reset link to the user with this email. The outcome is
+// never reported, so callers cannot learn whether an account exists: unknown or disabled
+// accounts and repeated requests within the resend interval are silently ignored, and the
+// email is sent in the background so the response time does not tell either.
+func (s *UserService) ForgotPassword(ctx context.Context, req *ForgotPasswordRequest) error {
+	user, err := s.userRepo.GetByEmail(req.Email)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil
+		}
+		return err
+	}
+	if user.Status != 1 {
+		return nil
+	}
+
+	cfg := config.GlobalConfig.Password
+	ok, err := database.MarkPasswordResetSent(ctx, user.ID, cfg.ResetResendDuration())
+	if err != nil {
+		return fmt.Errorf("failed to check reset interval: %w", err)
+	}
+	if !ok {
+		return nil
+	}
+
+	token, err := generateAuthCode()
+	if err != nil {
+		return fmt.Errorf("failed to generate reset token: %w", err)
+	}
+	if err := database.SetPasswordReset(ctx, hashResetToken(token), user.ID, cfg.ResetTokenDuration()); err != nil {
+		return fmt.Errorf("failed to store reset token: %w", err)
+	}
+
+	go sendPasswordReset(user, token)
+	return nil
+}
+
+// ResetPassword sets a new password with a reset token. The token is consumed even when the
+// new password cannot be set, and every token and SSO session of the user is revoked.
+func (s *UserService) ResetPassword(ctx context.Context, req *ResetPasswordWithTokenRequest) error {
+	userID, err := database.GetAndDeletePasswordReset(ctx, hashResetToken(req.Token))
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+	if user.Status != 1 {
+		return ErrUserDisabled
+	}
+
+	hashedPassword, err := hasher.Hash(req.NewPassword)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	user.Password = hashedPassword
+	if err := s.userRepo.Update(user); err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+
+	if err := s.authService.RevokeUserTokens(ctx, user.ID); err != nil {
+		return err
+	}
+	if err := s.ssoService.LogoutUser(ctx, user.ID, ""); err != nil {
+		return err
+	}
+
+	log.Printf("Auth: password of user %d reset with an emailed token", user.ID)
+	emitSecurityEvent(ctx, &SecurityEvent{
+		Type:   EventPasswordChanged,
+		UserID: user.ID,
+		Detail: "password reset with an emailed token, all sessions revoked",
+	})
+	return nil
+}
+
+// sendPasswordReset emails a reset link; failures are only logged since the request has been answered
+func sendPasswordReset(user *model.User, token string) {
+	cfg := config.GlobalConfig.Password
+	link, err := url.Parse(cfg.ResetURL)
+	if err != nil {
+		log.Printf("Auth: invalid password.reset_url: %v", err)
+		return
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	data := map[string]interface{}{
+		"Name":      displayName(user),
+		"URL":       link.String(),
+		"ExpiresIn": cfg.ResetTokenExpire / 60,
+	}
+	if err := mailer.Send(context.Background(), user.Email, mailer.TemplatePasswordReset, data); err != nil {
+		log.Printf("Auth: failed to send password reset email to user %d: %v", user.ID, err)
+	}
+}
+
+// hashResetToken hashes a reset token for storage, so a Redis dump cannot be used to reset passwords
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
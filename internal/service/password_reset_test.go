@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joshleeeeee/go-lite-auth/internal/config"
+	"github.com/joshleeeeee/go-lite-auth/internal/database"
+)
+
+var resetLinkPattern = regexp.MustCompile(`https://auth\.example\.com/reset\?token=[^\s"<]+`)
+
+// resetToken extracts the token of the reset link in an email
+func resetToken(t *testing.T, m *testMailer) string {
+	t.Helper()
+
+	link := resetLinkPattern.FindString(m.next(t).Text)
+	if link == "" {
+		t.Fatal("reset email has no link")
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Query().Get("token")
+}
+
+func TestForgotPasswordKeepsOneTokenPerUser(t *testing.T) {
+	mr := setupTestEnv(t)
+	config.GlobalConfig.Password = config.PasswordConfig{ResetTokenExpire: 1800, ResetResendInterval: 60, ResetURL: "https://auth.example.com/reset"}
+	mail := captureMail(t)
+	ctx := context.Background()
+	createTestUser(t, "alice", "password123")
+	s := NewUserService()
+
+	if err := s.ForgotPassword(ctx, &ForgotPasswordRequest{Email: "alice@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	first := resetToken(t, mail)
+	mr.FastForward(61 * time.Second)
+	if err := s.ForgotPassword(ctx, &ForgotPasswordRequest{Email: "alice@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	second := resetToken(t, mail)
+
+	err := s.ResetPassword(ctx, &ResetPasswordWithTokenRequest{Token: first, NewPassword: "new-password"})
+	if !errors.Is(err, ErrInvalidResetToken) {
+		t.Errorf("ResetPassword() with the replaced token error = %v, want ErrInvalidResetToken", err)
+	}
+	if err := s.ResetPassword(ctx, &ResetPasswordWithTokenRequest{Token: second, NewPassword: "new-password"}); err != nil {
+		t.Fatalf("ResetPassword() with the latest token error = %v", err)
+	}
+	for _, key := range mr.Keys() {
+		if strings.HasPrefix(key, database.PrefixPasswordReset) || strings.HasPrefix(key, database.PrefixResetUser) {
+			t.Errorf("reset key %s left after the reset", key)
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/joshleeeeee/go-lite-auth/internal/config"
+	"github.com/joshleeeeee/go-lite-auth/internal/database"
+	"github.com/joshleeeeee/go-lite-auth/internal/model"
+	"github.com/joshleeeeee/go-lite-auth/internal/repository"
+	"github.com/joshleeeeee/go-lite-auth/pkg/mailer"
+	"github.com/redis/go-redis/v9"
+)
+
+// Passwordless login errors
+var (
+	ErrInvalidMagicLink   = errors.New("magic link is invalid or expired")
+	ErrInvalidEmailOTP    = errors.New("invalid or expired code")
+	ErrTooManyLoginEmails = errors.New("too many sign-in emails requested, please try again later")
+)
+
+// EmailOTPDigits is the length of an email OTP
+const EmailOTPDigits = 6
+
+// MaxEmailOTPAttempts caps the wrong codes for an address from all client IPs together,
+// on top of the per-IP limit of MaxLoginAttempts
+const MaxEmailOTPAttempts = 10
+
+// PasswordlessService handles logins with a magic link or a code sent by email
+type PasswordlessService struct {
+	userRepo    *repository.UserRepository
+	authService *AuthService
+	ssoService  *SSOService
+}
+
+// NewPasswordlessService creates a new PasswordlessService instance
+func NewPasswordlessService() *PasswordlessService {
+	return &PasswordlessService{
+		userRepo:    repository.NewUserRepository(),
+		authService: NewAuthService(),
+		ssoService:  NewSSOService(),
+	}
+}
+
+// PasswordlessRequest asks for a magic link or email OTP; with a service, the login is an SSO login
+type PasswordlessRequest struct {
+	Email   string `json:"email" binding:"required,email"`
+	Service string `json:"service"`
+}
+
+// MagicLinkVerifyRequest exchanges the token of a magic link for a login
+type MagicLinkVerifyRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// EmailOTPVerifyRequest exchanges an email OTP for a login
+type EmailOTPVerifyRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Code  string `json:"code" binding:"required"`
+}
+
+// SendMagicLink emails a single-use sign-in link. Like ForgotPassword it never reports whether
+// the email has an account; only the rate limits, which count every request, are reported.
+func (s *PasswordlessService) SendMagicLink(ctx context.Context, req *PasswordlessRequest, clientIP string) error {
+	user, err := s.prepareSend(ctx, req, clientIP)
+	if err != nil || user == nil {
+		return err
+	}
+
+	cfg := config.GlobalConfig.Passwordless
+	token, err := generateAuthCode()
+	if err != nil {
+		return fmt.Errorf("failed to generate magic link: %w", err)
+	}
+	data := &database.PasswordlessData{UserID: user.ID, Service: req.Service}
+	if err := database.SetMagicLink(ctx, hashResetToken(token), data, cfg.MagicLinkDuration()); err != nil {
+		return fmt.Errorf("failed to store magic link: %w", err)
+	}
+
+	go sendMagicLink(user, token)
+	return nil
+}
+
+// VerifyMagicLink exchanges a magic link token for the tokens, or the SSO session and ticket,
+// of the login it was requested for
+func (s *PasswordlessService) VerifyMagicLink(ctx context.Context, req *MagicLinkVerifyRequest, clientIP string) (*LoginResult, error) {
+	data, err := database.GetAndDeleteMagicLink(ctx, hashResetToken(req.Token))
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrInvalidMagicLink
+		}
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByID(data.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, ErrInvalidMagicLink
+		}
+		return nil, err
+	}
+	return s.login(ctx, user, data.Service, ipEmailFailKey(clientIP, user.Email))
+}
+
+// SendEmailOTP emails a single-use 6-digit sign-in code, reporting the same outcomes as SendMagicLink.
+// Sending a code invalidates the codes sent before it.
+func (s *PasswordlessService) SendEmailOTP(ctx context.Context, req *PasswordlessRequest, clientIP string) error {
+	user, err := s.prepareSend(ctx, req, clientIP)
+	if err != nil || user == nil {
+		return err
+	}
+
+	cfg := config.GlobalConfig.Passwordless
+	code, err := generateEmailOTP()
+	if err != nil {
+		return fmt.Errorf("failed to generate code: %w", err)
+	}
+	data := &database.PasswordlessData{UserID: user.ID, Service: req.Service}
+	if err := database.SetEmailOTP(ctx, hashEmailOTP(user.ID, code), data, cfg.OTPDuration()); err != nil {
+		return fmt.Errorf("failed to store code: %w", err)
+	}
+
+	go sendEmailOTP(user, code)
+	return nil
+}
+
+// VerifyEmailOTP exchanges an email OTP for a login like VerifyMagicLink. Wrong codes count
+// against the login-fail counter of the client IP and email, like wrong passwords in Login,
+// and against a counter of the email alone, so codes cannot be guessed from many IPs.
+func (s *PasswordlessService) VerifyEmailOTP(ctx context.Context, req *EmailOTPVerifyRequest, clientIP string) (*LoginResult, error) {
+	failKey := ipEmailFailKey(clientIP, req.Email)
+	addressKey := emailFailKey(req.Email)
+	failCount, err := database.GetLoginFailCount(ctx, failKey)
+	if err != nil {
+		return nil, err
+	}
+	addressCount, err := database.GetLoginFailCount(ctx, addressKey)
+	if err != nil {
+		return nil, err
+	}
+	if failCount >= MaxLoginAttempts || addressCount >= MaxEmailOTPAttempts {
+		return nil, ErrTooManyAttempts
+	}
+	wrongCode := func() (*LoginResult, error) {
+		database.IncrLoginFail(ctx, failKey, LoginLockDuration)
+		database.IncrLoginFail(ctx, addressKey, LoginLockDuration)
+		return nil, ErrInvalidEmailOTP
+	}
+
+	user, err := s.userRepo.GetByEmail(req.Email)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return wrongCode()
+		}
+		return nil, err
+	}
+
+	data, err := database.GetAndDeleteEmailOTP(ctx, hashEmailOTP(user.ID, strings.TrimSpace(req.Code)))
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return wrongCode()
+		}
+		return nil, err
+	}
+	database.ClearLoginFail(ctx, addressKey)
+	return s.login(ctx, user, data.Service, failKey)
+}
+
+// prepareSend applies the rate limits of login emails and finds the live user of the email.
+// It returns no user, and no error, when nothing should be sent.
+func (s *PasswordlessService) prepareSend(ctx context.Context, req *PasswordlessRequest, clientIP string) (*model.User, error) {
+	// Reject unregistered services before sending anything
+	if req.Service != "" {
+		if err := s.ssoService.CheckService(req.Service); err != nil {
+			return nil, err
+		}
+	}
+
+	cfg := config.GlobalConfig.Passwordless
+	ipCount, err := database.IncrSendCount(ctx, "ip:"+clientIP, cfg.SendWindowDuration())
+	if err != nil {
+		return nil, fmt.Errorf("failed to check send limit: %w", err)
+	}
+	if ipCount > int64(cfg.SendLimitPerIP) {
+		return nil, ErrTooManyLoginEmails
+	}
+	emailCount, err := database.IncrSendCount(ctx, "email:"+strings.ToLower(req.Email), cfg.SendWindowDuration())
+	if err != nil {
+		return nil, fmt.Errorf("failed to check send limit: %w", err)
+	}
+	if emailCount > int64(cfg.SendLimitPerEmail) {
+		return nil, ErrTooManyLoginEmails
+	}
+
+	user, err := s.userRepo.GetByEmail(req.Email)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if user.Status != 1 {
+		return nil, nil
+	}
+	return user, nil
+}
+
+// login completes a login proven by access to the user's email. The email counts as verified,
+// and users with a second factor get an mfa_token like after a password.
+func (s *PasswordlessService) login(ctx context.Context, user *model.User, service, failKey string) (*LoginResult, error) {
+	if user.Status != 1 {
+		return nil, ErrUserDisabled
+	}
+
+	if user.EmailVerifiedAt == nil {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+		if err := s.userRepo.Update(user); err != nil {
+			return nil, fmt.Errorf("failed to update user: %w", err)
+		}
+		log.Printf("Auth: email of user %d verified by a passwordless login", user.ID)
+	}
+
+	amr := []string{AMREmail}
+	mfaToken, err := s.authService.startMFA(ctx, &database.MFAChallengeData{
+		UserID:  user.ID,
+		FailKey: failKey,
+		Service: service,
+		AMR:     amr,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if mfaToken != "" {
+		if service != "" {
+			return &LoginResult{SSO: &SSOLoginResponse{MFARequired: true, MFAToken: mfaToken}}, nil
+		}
+		return &LoginResult{Auth: &AuthResponse{MFARequired: true, MFAToken: mfaToken}}, nil
+	}
+
+	database.ClearLoginFail(ctx, failKey)
+
+	if service != "" {
+		resp, err := s.ssoService.completeLogin(ctx, user, service, amr)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{SSO: resp}, nil
+	}
+
+	resp, err := s.authService.completeLogin(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResult{Auth: resp}, nil
+}
+
+// sendMagicLink emails a magic link; failures are only logged since the request has been answered
+func sendMagicLink(user *model.User, token string) {
+	cfg := config.GlobalConfig.Passwordless
+	link, err := url.Parse(cfg.MagicLinkURL)
+	if err != nil {
+		log.Printf("Auth: invalid passwordless.magic_link_url: %v", err)
+		return
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	data := map[string]interface{}{
+		"Name":      displayName(user),
+		"URL":       link.String(),
+		"ExpiresIn": cfg.MagicLinkExpire / 60,
+	}
+	if err := mailer.Send(context.Background(), user.Email, mailer.TemplateMagicLink, data); err != nil {
+		log.Printf("Auth: failed to send magic link to user %d: %v", user.ID, err)
+	}
+}
+
+// sendEmailOTP emails a sign-in code; failures are only logged since the request has been answered
+func sendEmailOTP(user *model.User, code string) {
+	data := map[string]interface{}{
+		"Name":      displayName(user),
+		"Code":      code,
+		"ExpiresIn": config.GlobalConfig.Passwordless.OTPExpire / 60,
+	}
+	if err := mailer.Send(context.Background(), user.Email, mailer.TemplateEmailOTP, data); err != nil {
+		log.Printf("Auth: failed to send sign-in code to user %d: %v", user.ID, err)
+	}
+}
+
+// generateEmailOTP returns a random numeric code
+func generateEmailOTP() (string, error) {
+	max := big.NewInt(1)
+	for i := 0; i < EmailOTPDigits; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", EmailOTPDigits, n), nil
+}
+
+// hashEmailOTP hashes a code with its user, so that a code only works for the email it was sent to
+func hashEmailOTP(userID uint, code string) string {
+	return hashResetToken(fmt.Sprintf("%d:%s", userID, code))
+}
+
+// emailFailKey is the login-fail counter of passwordless logins to an email
+func emailFailKey(email string) string {
+	return "email:" + strings.ToLower(email)
+}
+
+// ipEmailFailKey is the login-fail counter of passwordless logins to an email from a client IP
+func ipEmailFailKey(clientIP, email string) string {
+	return clientIP + ":" + emailFailKey(email)
+}
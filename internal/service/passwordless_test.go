@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/joshleeeeee/go-lite-auth/internal/config"
+	"github.com/joshleeeeee/go-lite-auth/internal/database"
+)
+
+// setupPasswordless configures passwordless logins with limits the tests do not reach
+func setupPasswordless(t *testing.T) *testMailer {
+	t.Helper()
+
+	config.GlobalConfig.Passwordless = config.PasswordlessConfig{
+		MagicLinkExpire:   900,
+		MagicLinkURL:      "https://auth.example.com/magic",
+		OTPExpire:         300,
+		SendWindow:        3600,
+		SendLimitPerEmail: 100,
+		SendLimitPerIP:    100,
+	}
+	return captureMail(t)
+}
+
+// emailOTP extracts the code of a sign-in email
+func emailOTP(t *testing.T, m *testMailer) string {
+	t.Helper()
+
+	subject := m.next(t).Subject
+	code := subject[strings.LastIndex(subject, " ")+1:]
+	if len(code) != EmailOTPDigits {
+		t.Fatalf("sign-in email has no code: %q", subject)
+	}
+	return code
+}
+
+func TestSendEmailOTPInvalidatesPreviousCode(t *testing.T) {
+	mr := setupTestEnv(t)
+	mail := setupPasswordless(t)
+	ctx := context.Background()
+	createTestUser(t, "alice", "password123")
+	s := NewPasswordlessService()
+	send := &PasswordlessRequest{Email: "alice@example.com"}
+
+	if err := s.SendEmailOTP(ctx, send, "127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	first := emailOTP(t, mail)
+	if err := s.SendEmailOTP(ctx, send, "127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	second := emailOTP(t, mail)
+	if first == second {
+		t.Skip("both emails carry the same random code")
+	}
+
+	_, err := s.VerifyEmailOTP(ctx, &EmailOTPVerifyRequest{Email: "alice@example.com", Code: first}, "127.0.0.1")
+	if !errors.Is(err, ErrInvalidEmailOTP) {
+		t.Errorf("VerifyEmailOTP() with the replaced code error = %v, want ErrInvalidEmailOTP", err)
+	}
+	result, err := s.VerifyEmailOTP(ctx, &EmailOTPVerifyRequest{Email: "alice@example.com", Code: second}, "127.0.0.1")
+	if err != nil || result.Auth == nil || result.Auth.TokenPair == nil {
+		t.Fatalf("VerifyEmailOTP() with the latest code = %+v, %v", result, err)
+	}
+	for _, key := range mr.Keys() {
+		if strings.HasPrefix(key, database.PrefixEmailOTP) || strings.HasPrefix(key, database.PrefixEmailOTPUser) {
+			t.Errorf("email OTP key %s left after the login", key)
+		}
+	}
+}
+
+func TestVerifyEmailOTPFailCounter(t *testing.T) {
+	// Wrong codes for alice@example.com from 10.0.0.1 lock the counter
+	const lockedIP = "10.0.0.1"
+	tests := []struct {
+		name     string
+		email    string
+		clientIP string
+		wantErr  error
+	}{
+		{"same IP and email", "alice@example.com", lockedIP, ErrTooManyAttempts},
+		{"email in another case", "ALICE@EXAMPLE.COM", lockedIP, ErrTooManyAttempts},
+		{"other IP", "alice@example.com", "10.0.0.2", nil},
+		{"other email", "bob@example.com", lockedIP, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestEnv(t)
+			mail := setupPasswordless(t)
+			ctx := context.Background()
+			createTestUser(t, "alice", "password123")
+			createTestUser(t, "bob", "password123")
+			s := NewPasswordlessService()
+
+			for i := 0; i < MaxLoginAttempts; i++ {
+				req := &EmailOTPVerifyRequest{Email: "alice@example.com", Code: "000000"}
+				if i%2 == 1 {
+					req.Email = "Alice@Example.com"
+				}
+				if _, err := s.VerifyEmailOTP(ctx, req, lockedIP); !errors.Is(err, ErrInvalidEmailOTP) {
+					t.Fatalf("attempt %d: VerifyEmailOTP() error = %v, want ErrInvalidEmailOTP", i, err)
+				}
+			}
+
+			if err := s.SendEmailOTP(ctx, &PasswordlessRequest{Email: strings.ToLower(tt.email)}, tt.clientIP); err != nil {
+				t.Fatal(err)
+			}
+			code := emailOTP(t, mail)
+			_, err := s.VerifyEmailOTP(ctx, &EmailOTPVerifyRequest{Email: tt.email, Code: code}, tt.clientIP)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("VerifyEmailOTP() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyEmailOTPLocksAddressAcrossIPs(t *testing.T) {
+	setupTestEnv(t)
+	mail := setupPasswordless(t)
+	ctx := context.Background()
+	createTestUser(t, "alice", "password123")
+	createTestUser(t, "bob", "password123")
+	s := NewPasswordlessService()
+
+	// Each IP stays below its own limit
+	for i := 0; i < MaxEmailOTPAttempts; i++ {
+		clientIP := fmt.Sprintf("10.0.%d.1", i)
+		req := &EmailOTPVerifyRequest{Email: "alice@example.com", Code: "000000"}
+		if _, err := s.VerifyEmailOTP(ctx, req, clientIP); !errors.Is(err, ErrInvalidEmailOTP) {
+			t.Fatalf("attempt %d: VerifyEmailOTP() error = %v, want ErrInvalidEmailOTP", i, err)
+		}
+	}
+
+	tests := []struct {
+		email   string
+		wantErr error
+	}{
+		{"alice@example.com", ErrTooManyAttempts},
+		{"bob@example.com", nil},
+	}
+	for _, tt := range tests {
+		if err := s.SendEmailOTP(ctx, &PasswordlessRequest{Email: tt.email}, "192.0.2.1"); err != nil {
+			t.Fatal(err)
+		}
+		code := emailOTP(t, mail)
+		_, err := s.VerifyEmailOTP(ctx, &EmailOTPVerifyRequest{Email: tt.email, Code: code}, "192.0.2.1")
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("VerifyEmailOTP() for %s from a new IP error = %v, want %v", tt.email, err, tt.wantErr)
+		}
+	}
+}
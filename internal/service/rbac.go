@@ -0,0 +1,53 @@
+package service
+
+import (
+	"strings"
+
+	"github.com/joshleeeeee/go-lite-auth/internal/model"
+	"github.com/joshleeeeee/go-lite-auth/internal/repository"
+)
+
+// PermissionWildcard grants every permission, or every action on a resource as "resource:*"
+const PermissionWildcard = "*"
+
+// Roles and permissions can be released to SSO services like any other attribute.
+// There is no separate group model: "groups" releases the role names, for services that
+// expect group membership under that name.
+func init() {
+	roleRepo := repository.NewRoleRepository()
+	roleNames := func(u *model.User) (interface{}, error) {
+		roles, err := roleRepo.GetRoleNames(u.ID)
+		if err != nil || len(roles) == 0 {
+			return nil, err
+		}
+		return roles, nil
+	}
+	RegisterAttribute("roles", roleNames)
+	RegisterAttribute("groups", roleNames)
+	RegisterAttribute("permissions", func(u *model.User) (interface{}, error) {
+		permissions, err := roleRepo.GetPermissionNames(u.ID)
+		if err != nil || len(permissions) == 0 {
+			return nil, err
+		}
+		return permissions, nil
+	})
+}
+
+// HasPermission reports whether any of the roles grants the permission, directly or through a wildcard.
+// Permissions are looked up on every call, so changes to a role apply to tokens already issued.
+func HasPermission(roles []string, permission string) (bool, error) {
+	candidates := []string{permission, PermissionWildcard}
+	if resource, _, ok := strings.Cut(permission, ":"); ok {
+		candidates = append(candidates, resource+":"+PermissionWildcard)
+	}
+	return repository.NewRoleRepository().AnyRoleHasPermission(roles, candidates)
+}
+
+// tokenRoles returns the roles to embed in a user's tokens. Roles are not delegated to OAuth
+// clients: a client only acts within the scopes the user granted it.
+func (s *AuthService) tokenRoles(userID uint, clientID string) ([]string, error) {
+	if clientID != "" {
+		return nil, nil
+	}
+	return s.roleRepo.GetRoleNames(userID)
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/joshleeeeee/go-lite-auth/internal/config"
+	"github.com/joshleeeeee/go-lite-auth/internal/database"
+	"github.com/joshleeeeee/go-lite-auth/internal/repository"
+	"github.com/joshleeeeee/go-lite-auth/pkg/jwt"
+)
+
+// ErrRefreshTokenReused is returned when a rotated-out refresh token is presented again
+var ErrRefreshTokenReused = errors.New("refresh token reuse detected, the session has been revoked")
+
+// IssueTokenPair issues the first token pair of a grant and starts its refresh token family
+func (s *AuthService) IssueTokenPair(ctx context.Context, userID uint, username string, opts *jwt.TokenOptions) (*jwt.TokenPair, error) {
+	if opts == nil {
+		opts = &jwt.TokenOptions{}
+	}
+	roles, err := s.tokenRoles(userID, opts.ClientID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load roles: %w", err)
+	}
+	opts.Roles = roles
+
+	tokenPair, err := jwt.GenerateTokenPairWithOptions(userID, username, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	family := &database.RefreshFamilyData{
+		UserID:   userID,
+		ClientID: opts.ClientID,
+		Current:  tokenPair.RefreshTokenID,
+	}
+	expire := config.GlobalConfig.JWT.RefreshTokenDuration()
+	if err := database.SetRefreshFamily(ctx, tokenPair.FamilyID, family, expire); err != nil {
+		return nil, fmt.Errorf("failed to store refresh token family: %w", err)
+	}
+
+	return tokenPair, nil
+}
+
+// rotateRefreshToken exchanges the current refresh token of a family for a new token pair.
+// Presenting a refresh token that was already rotated out (and blacklisted) means it leaked:
+// the whole family, including its access tokens, is revoked.
+func (s *AuthService) rotateRefreshToken(ctx context.Context, claims *jwt.Claims) (*jwt.TokenPair, error) {
+	if err := s.checkRefreshUser(claims.UserID); err != nil {
+		return nil, err
+	}
+
+	// Roles are read again, so role changes apply from the next refresh
+	roles, err := s.tokenRoles(claims.UserID, claims.ClientID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load roles: %w", err)
+	}
+
+	tokenPair, err := jwt.GenerateTokenPairWithOptions(claims.UserID, claims.Username, &jwt.TokenOptions{
+		ClientID: claims.ClientID,
+		Scope:    claims.Scope,
+		FamilyID: claims.FamilyID,
+		Roles:    roles,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	expire := config.GlobalConfig.JWT.RefreshTokenDuration()
+	result, err := database.RotateRefreshFamily(ctx, claims.UserID, claims.FamilyID, claims.TokenID, tokenPair.RefreshTokenID, expire)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+
+	switch result {
+	case database.FamilyRotated:
+		if remainingTime := jwt.GetTokenRemainingTime(claims); remainingTime > 0 {
+			database.AddToBlacklist(ctx, claims.TokenID, remainingTime)
+		}
+		return tokenPair, nil
+	case database.FamilyReused:
+		s.revokeReusedFamily(ctx, claims)
+		return nil, ErrRefreshTokenReused
+	default:
+		return nil, jwt.ErrInvalidToken
+	}
+}
+
+// checkRefreshUser rejects refreshes of users that were disabled or deleted since the grant, in
+// case their refresh tokens escaped the revocation
+func (s *AuthService) checkRefreshUser(userID uint) error {
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return ErrUserDisabled
+		}
+		return err
+	}
+	if user.Status != 1 {
+		return ErrUserDisabled
+	}
+	return nil
+}
+
+// revokeReusedFamily revokes a family whose refresh token was replayed and reports the incident
+func (s *AuthService) revokeReusedFamily(ctx context.Context, claims *jwt.Claims) {
+	if err := database.DeleteRefreshFamily(ctx, claims.FamilyID); err != nil {
+		log.Printf("Auth: failed to revoke refresh token family %s: %v", claims.FamilyID, err)
+	}
+
+	emitSecurityEvent(ctx, &SecurityEvent{
+		Type:     EventRefreshTokenReuse,
+		UserID:   claims.UserID,
+		ClientID: claims.ClientID,
+		Detail:   fmt.Sprintf("refresh token %s of family %s was reused, family revoked", claims.TokenID, claims.FamilyID),
+	})
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/joshleeeeee/go-lite-auth/internal/database"
+	"github.com/joshleeeeee/go-lite-auth/internal/model"
+	"github.com/joshleeeeee/go-lite-auth/pkg/jwt"
+)
+
+func TestRefreshTokenFamilyReuse(t *testing.T) {
+	tests := []struct {
+		name      string
+		present   []int // index of the refresh token presented at each step, 0 is the first one issued
+		wantReuse int   // step expected to detect reuse, -1 for none
+	}{
+		{"rotation chain", []int{0, 1, 2}, -1},
+		{"first token replayed", []int{0, 0}, 1},
+		{"old token replayed after further rotations", []int{0, 1, 0}, 2},
+		{"previous token replayed", []int{0, 1, 1}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestEnv(t)
+			events := captureSecurityEvents(t)
+			ctx := context.Background()
+			user := createTestUser(t, "alice", "password123")
+			s := NewAuthService()
+
+			first, err := s.IssueTokenPair(ctx, user.ID, user.Username, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pairs := []*jwt.TokenPair{first}
+
+			for step, index := range tt.present {
+				pair, err := s.RefreshToken(ctx, pairs[index].RefreshToken)
+				if step == tt.wantReuse {
+					if !errors.Is(err, ErrRefreshTokenReused) {
+						t.Fatalf("step %d: RefreshToken() error = %v, want ErrRefreshTokenReused", step, err)
+					}
+					break
+				}
+				if err != nil {
+					t.Fatalf("step %d: RefreshToken() error = %v", step, err)
+				}
+				pairs = append(pairs, pair)
+			}
+
+			latest := pairs[len(pairs)-1]
+			_, accessErr := s.ValidateToken(ctx, latest.AccessToken)
+			if tt.wantReuse < 0 {
+				if accessErr != nil {
+					t.Errorf("ValidateToken() of the latest access token error = %v", accessErr)
+				}
+				if len(*events) != 0 {
+					t.Errorf("security events = %v, want none", *events)
+				}
+				return
+			}
+
+			// The whole family is revoked, including the tokens of the legitimate holder
+			if accessErr == nil {
+				t.Error("access token of a revoked family is still valid")
+			}
+			if _, err := s.RefreshToken(ctx, latest.RefreshToken); err == nil {
+				t.Error("refresh token of a revoked family was rotated")
+			}
+			if len(*events) != 1 || (*events)[0].Type != EventRefreshTokenReuse || (*events)[0].UserID != user.ID {
+				t.Errorf("security events = %v, want one refresh_token_reuse", *events)
+			}
+		})
+	}
+}
+
+func TestRefreshTokenRevokedFamily(t *testing.T) {
+	setupTestEnv(t)
+	events := captureSecurityEvents(t)
+	ctx := context.Background()
+	user := createTestUser(t, "alice", "password123")
+	s := NewAuthService()
+
+	pair, err := s.IssueTokenPair(ctx, user.ID, user.Username, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.DeleteRefreshFamily(ctx, pair.FamilyID); err != nil {
+		t.Fatal(err)
+	}
+
+	// A family ended by logout or revocation is not a replay
+	if _, err := s.RefreshToken(ctx, pair.RefreshToken); !errors.Is(err, jwt.ErrInvalidToken) {
+		t.Errorf("RefreshToken() error = %v, want ErrInvalidToken", err)
+	}
+	if len(*events) != 0 {
+		t.Errorf("security events = %v, want none", *events)
+	}
+}
+
+func TestDisableUserRevokesLongLivedFamily(t *testing.T) {
+	mr := setupTestEnv(t)
+	ctx := context.Background()
+	user := createTestUser(t, "alice", "password123")
+	s := NewAuthService()
+
+	pair, err := s.IssueTokenPair(ctx, user.ID, user.Username, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Keep rotating until the family has outlived the TTL it was created with
+	for i := 0; i < 3; i++ {
+		mr.FastForward(40 * time.Minute)
+		if pair, err = s.RefreshToken(ctx, pair.RefreshToken); err != nil {
+			t.Fatalf("rotation %d: RefreshToken() error = %v", i, err)
+		}
+	}
+
+	families, err := database.GetUserRefreshFamilies(ctx, user.ID)
+	if err != nil || families[pair.FamilyID] != "" || len(families) != 1 {
+		t.Fatalf("GetUserRefreshFamilies() = %v, %v, want the rotated family", families, err)
+	}
+
+	if _, err := NewAdminService().DisableUser(ctx, user.ID+1, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ValidateToken(ctx, pair.AccessToken); err == nil {
+		t.Error("access token of a disabled user is still valid")
+	}
+	if exists, _ := database.RefreshFamilyExists(ctx, pair.FamilyID); exists {
+		t.Error("refresh token family of a disabled user was not revoked")
+	}
+}
+
+func TestRefreshTokenOfInactiveUser(t *testing.T) {
+	tests := []struct {
+		name   string
+		update func(t *testing.T, user *model.User)
+	}{
+		{"disabled", disableTestUser},
+		{"deleted", deleteTestUser},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestEnv(t)
+			ctx := context.Background()
+			user := createTestUser(t, "alice", "password123")
+			s := NewAuthService()
+
+			pair, err := s.IssueTokenPair(ctx, user.ID, user.Username, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// A family the revocation cannot find, e.g. one indexed before the index TTL was extended
+			database.RDB.Del(ctx, fmt.Sprintf("%s%d", database.PrefixUserFamilies, user.ID))
+
+			tt.update(t, user)
+			if _, err := s.RefreshToken(ctx, pair.RefreshToken); !errors.Is(err, ErrUserDisabled) {
+				t.Errorf("RefreshToken() error = %v, want ErrUserDisabled", err)
+			}
+		})
+	}
+}
+
+func disableTestUser(t *testing.T, user *model.User) {
+	t.Helper()
+	if err := database.DB.Model(user).Update("status", 0).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func deleteTestUser(t *testing.T, user *model.User) {
+	t.Helper()
+	if err := database.DB.Delete(user).Error; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// SecurityEventType identifies a security-relevant occurrence
+type SecurityEventType string
+
+// Security event types
+const (
+	EventRefreshTokenReuse   SecurityEventType = "refresh_token_reuse"
+	EventPasswordChanged     SecurityEventType = "password_changed"
+	EventMFAEnabled          SecurityEventType = "mfa_enabled"
+	EventMFADisabled         SecurityEventType = "mfa_disabled"
+	EventPasskeyAdded        SecurityEventType = "passkey_added"
+	EventPasskeyRemoved      SecurityEventType = "passkey_removed"
+	EventPasskeyCloneWarning SecurityEventType = "passkey_clone_warning"
+)
+
+// SecurityEvent describes a security-relevant occurrence for auditing and alerting
+type SecurityEvent struct {
+	Type     SecurityEventType `json:"type"`
+	UserID   uint              `json:"user_id,omitempty"`
+	ClientID string            `json:"client_id,omitempty"`
+	Detail   string            `json:"detail,omitempty"`
+	Time     time.Time         `json:"time"`
+}
+
+// SecurityEventListener receives security events; it runs synchronously and should return quickly
+type SecurityEventListener func(ctx context.Context, event *SecurityEvent)
+
+var (
+	securityListenerMu sync.RWMutex
+	securityListeners  []SecurityEventListener
+)
+
+// OnSecurityEvent registers a listener for every emitted security event
+func OnSecurityEvent(listener SecurityEventListener) {
+	securityListenerMu.Lock()
+	defer securityListenerMu.Unlock()
+	securityListeners = append(securityListeners, listener)
+}
+
+// emitSecurityEvent logs a security event and passes it to the registered listeners
+func emitSecurityEvent(ctx context.Context, event *SecurityEvent) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	log.Printf("SECURITY: %s user=%d client=%s %s", event.Type, event.UserID, event.ClientID, event.Detail)
+
+	securityListenerMu.RLock()
+	listeners := securityListeners
+	securityListenerMu.RUnlock()
+
+	for _, listener := range listeners {
+		listener(ctx, event)
+	}
+}
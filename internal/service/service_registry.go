@@ -0,0 +1,225 @@
+package service
+
+import (
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joshleeeeee/go-lite-auth/internal/config"
+	"github.com/joshleeeeee/go-lite-auth/internal/model"
+	"github.com/joshleeeeee/go-lite-auth/internal/repository"
+)
+
+// Default attributes released to services without an explicit allow-list
+var DefaultReleasedAttributes = []string{"user_id", "email", "nickname"}
+
+// RegisteredService is an SSO service resolved from the client registry
+type RegisteredService struct {
+	Client            *model.Client
+	TicketTTL         time.Duration
+	AllowedAttributes []string
+	AttributeRenames  map[string]string
+}
+
+// ReleasesAttribute reports whether the service may receive the given attribute
+func (s *RegisteredService) ReleasesAttribute(name string) bool {
+	for _, allowed := range s.AllowedAttributes {
+		if allowed == name || allowed == AllAttributes {
+			return true
+		}
+	}
+	return false
+}
+
+// ServiceRegistry resolves SSO service URLs against the registered clients.
+// The clients are loaded once and cached for sso.service_cache_ttl seconds, shared by every
+// registry; call InvalidateServiceRegistry after changing clients to apply the change at once.
+type ServiceRegistry struct {
+	clientRepo *repository.ClientRepository
+}
+
+// registeredClient is an SSO-enabled client with its service patterns ready to match
+type registeredClient struct {
+	client   *model.Client
+	patterns []servicePattern
+}
+
+type servicePattern struct {
+	matchType string
+	pattern   string
+	regex     *regexp.Regexp // compiled MatchRegex pattern, nil when invalid
+}
+
+var registryCache struct {
+	sync.RWMutex
+	clients  []registeredClient
+	loadedAt time.Time
+}
+
+// InvalidateServiceRegistry drops the cached clients, so the next match reloads them
+func InvalidateServiceRegistry() {
+	registryCache.Lock()
+	defer registryCache.Unlock()
+	registryCache.clients = nil
+	registryCache.loadedAt = time.Time{}
+}
+
+// NewServiceRegistry creates a new ServiceRegistry instance
+func NewServiceRegistry() *ServiceRegistry {
+	return &ServiceRegistry{
+		clientRepo: repository.NewClientRepository(),
+	}
+}
+
+// Match finds the registered service for a service URL.
+// Exact matches win over prefix matches (longest prefix first), which win over regex matches.
+func (r *ServiceRegistry) Match(service string) (*RegisteredService, error) {
+	if service == "" {
+		return nil, ErrInvalidService
+	}
+
+	clients, err := r.clients()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		prefixMatch *model.Client
+		prefixLen   int
+		regexMatch  *model.Client
+	)
+
+	for _, registered := range clients {
+		client := registered.client
+
+		if client.RedirectURI == service {
+			return newRegisteredService(client), nil
+		}
+
+		for _, uri := range registered.patterns {
+			switch uri.matchType {
+			case model.MatchExact, "":
+				if uri.pattern == service {
+					return newRegisteredService(client), nil
+				}
+			case model.MatchPrefix:
+				if matchPrefix(uri.pattern, service) && len(uri.pattern) > prefixLen {
+					prefixMatch, prefixLen = client, len(uri.pattern)
+				}
+			case model.MatchRegex:
+				if regexMatch == nil && uri.regex != nil && uri.regex.MatchString(service) {
+					regexMatch = client
+				}
+			}
+		}
+	}
+
+	if prefixMatch != nil {
+		return newRegisteredService(prefixMatch), nil
+	}
+	if regexMatch != nil {
+		return newRegisteredService(regexMatch), nil
+	}
+
+	return nil, ErrInvalidService
+}
+
+// clients returns the cached SSO-enabled clients, reloading them once the cache has expired
+func (r *ServiceRegistry) clients() ([]registeredClient, error) {
+	ttl := config.GlobalConfig.SSO.ServiceCacheDuration()
+
+	registryCache.RLock()
+	clients, loadedAt := registryCache.clients, registryCache.loadedAt
+	registryCache.RUnlock()
+	if !loadedAt.IsZero() && time.Since(loadedAt) < ttl {
+		return clients, nil
+	}
+
+	models, err := r.clientRepo.ListSSOEnabled()
+	if err != nil {
+		return nil, err
+	}
+	clients = make([]registeredClient, len(models))
+	for i := range models {
+		clients[i] = compileClient(&models[i])
+	}
+
+	registryCache.Lock()
+	registryCache.clients, registryCache.loadedAt = clients, time.Now()
+	registryCache.Unlock()
+	return clients, nil
+}
+
+// compileClient prepares the service patterns of a client, compiling its regular expressions once
+func compileClient(client *model.Client) registeredClient {
+	registered := registeredClient{client: client}
+	for _, uri := range client.ServiceURIs {
+		pattern := servicePattern{matchType: uri.MatchType, pattern: uri.Pattern}
+		if uri.MatchType == model.MatchRegex {
+			pattern.regex = compileServiceRegex(uri.Pattern)
+		}
+		registered.patterns = append(registered.patterns, pattern)
+	}
+	return registered
+}
+
+// newRegisteredService applies the client's SSO settings on top of the defaults
+func newRegisteredService(client *model.Client) *RegisteredService {
+	ttl := TicketExpire
+	if client.TicketTTL > 0 {
+		ttl = time.Duration(client.TicketTTL) * time.Second
+	}
+
+	attributes := DefaultReleasedAttributes
+	if client.AllowedAttributes != "" {
+		attributes = splitList(client.AllowedAttributes)
+	}
+
+	return &RegisteredService{
+		Client:            client,
+		TicketTTL:         ttl,
+		AllowedAttributes: attributes,
+		AttributeRenames:  checkRenames(client.ClientID, parseRenames(client.ClientID, client.AttributeRenames), attributes),
+	}
+}
+
+// matchPrefix matches a service URL against a prefix, only on a path, query or fragment boundary
+// so that "https://app.example.com" does not match "https://app.example.com.evil.com"
+func matchPrefix(prefix, service string) bool {
+	if !strings.HasPrefix(service, prefix) {
+		return false
+	}
+	if len(service) == len(prefix) || strings.HasSuffix(prefix, "/") {
+		return true
+	}
+	switch service[len(prefix)] {
+	case '/', '?', '#':
+		return true
+	}
+	return false
+}
+
+// compileServiceRegex compiles a pattern that has to match the whole service URL. Anchoring does not
+// protect the host: "https://app.example.com.*" also matches "https://app.example.com.evil.com",
+// so patterns should end the host explicitly, e.g. "https://app\.example\.com/.*".
+func compileServiceRegex(pattern string) *regexp.Regexp {
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		log.Printf("SSO: ignoring invalid service pattern %q: %v", pattern, err)
+		return nil
+	}
+	return re
+}
+
+// splitList splits a comma-separated setting into trimmed, non-empty values
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
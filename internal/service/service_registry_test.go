@@ -0,0 +1,137 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/joshleeeeee/go-lite-auth/internal/database"
+	"github.com/joshleeeeee/go-lite-auth/internal/model"
+)
+
+func TestServiceRegistryMatch(t *testing.T) {
+	setupTestEnv(t)
+	createTestClient(t, "exact", testRedirectURI)
+	addServiceURI(t, "exact", "https://app.example.com/other", model.MatchExact)
+	createTestClient(t, "short-prefix", "https://short.example.com/callback")
+	addServiceURI(t, "short-prefix", "https://app.example.com", model.MatchPrefix)
+	createTestClient(t, "long-prefix", "https://long.example.com/callback")
+	addServiceURI(t, "long-prefix", "https://app.example.com/admin", model.MatchPrefix)
+	createTestClient(t, "loose-regex", "https://loose.example.com/callback")
+	addServiceURI(t, "loose-regex", "https://loose.example.com.*", model.MatchRegex)
+	createTestClient(t, "pinned-regex", "https://pinned.example.com/callback")
+	addServiceURI(t, "pinned-regex", `https://[a-z]+\.pinned\.example\.com/.*`, model.MatchRegex)
+	addServiceURI(t, "pinned-regex", `https://app.example.com/[`, model.MatchRegex)
+
+	tests := []struct {
+		service    string
+		wantClient string
+	}{
+		{testRedirectURI, "exact"},
+		{"https://app.example.com/other", "exact"},
+		{"https://app.example.com/admin/users", "long-prefix"},
+		{"https://app.example.com/home", "short-prefix"},
+		{"https://app.example.com.evil.com/", ""},
+		{"https://eu.pinned.example.com/login", "pinned-regex"},
+		{"https://eu.pinned.example.com.evil.com/login", ""},
+		{"https://evil.com/?https://eu.pinned.example.com/", ""},
+		// unanchored hosts match other domains, which is why the README warns against them
+		{"https://loose.example.com.evil.com/", "loose-regex"},
+		{"", ""},
+	}
+
+	r := NewServiceRegistry()
+	for _, tt := range tests {
+		t.Run(tt.service, func(t *testing.T) {
+			got, err := r.Match(tt.service)
+			if tt.wantClient == "" {
+				if !errors.Is(err, ErrInvalidService) {
+					t.Errorf("Match() = %v, %v, want ErrInvalidService", got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Match() error = %v", err)
+			}
+			if got.Client.ClientID != tt.wantClient {
+				t.Errorf("Match() client = %q, want %q", got.Client.ClientID, tt.wantClient)
+			}
+		})
+	}
+}
+
+func TestServiceRegistryCache(t *testing.T) {
+	setupTestEnv(t)
+	r := NewServiceRegistry()
+	if _, err := r.Match(testRedirectURI); !errors.Is(err, ErrInvalidService) {
+		t.Fatalf("Match() before registration error = %v, want ErrInvalidService", err)
+	}
+
+	// Clients changed behind the registry's back are only seen after invalidation
+	client := &model.Client{ClientID: "app", ClientSecret: "secret", Name: "app", RedirectURI: testRedirectURI, Status: 1}
+	if err := database.DB.Create(client).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Match(testRedirectURI); !errors.Is(err, ErrInvalidService) {
+		t.Errorf("Match() served from cache error = %v, want ErrInvalidService", err)
+	}
+
+	InvalidateServiceRegistry()
+	if _, err := r.Match(testRedirectURI); err != nil {
+		t.Errorf("Match() after invalidation error = %v", err)
+	}
+}
+
+// addServiceURI registers an additional service pattern for a client
+func addServiceURI(t *testing.T, clientID, pattern, matchType string) {
+	t.Helper()
+
+	uri := &model.ClientServiceURI{ClientID: clientID, Pattern: pattern, MatchType: matchType}
+	if err := database.DB.Create(uri).Error; err != nil {
+		t.Fatalf("failed to create service URI: %v", err)
+	}
+	InvalidateServiceRegistry()
+}
+
+func TestServiceRegistrySSOEnabled(t *testing.T) {
+	setupTestEnv(t)
+	enabled, disabled := true, false
+	clients := []*model.Client{
+		{ClientID: "default", Name: "default", RedirectURI: "https://default.example.com/cas", Status: 1},
+		{ClientID: "enabled", Name: "enabled", RedirectURI: "https://enabled.example.com/cas", Status: 1, SSOEnabled: &enabled},
+		{ClientID: "disabled", Name: "disabled", RedirectURI: "https://disabled.example.com/cas", Status: 1, SSOEnabled: &disabled},
+	}
+	for _, client := range clients {
+		if err := database.DB.Create(client).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		clientID string
+		want     bool
+	}{
+		{"default", true},
+		{"enabled", true},
+		{"disabled", false},
+	}
+	r := NewServiceRegistry()
+	for _, tt := range tests {
+		t.Run(tt.clientID, func(t *testing.T) {
+			var stored model.Client
+			if err := database.DB.Where("client_id = ?", tt.clientID).First(&stored).Error; err != nil {
+				t.Fatal(err)
+			}
+			if stored.SSOEnabled == nil || *stored.SSOEnabled != tt.want {
+				t.Errorf("stored sso_enabled = %v, want %v", stored.SSOEnabled, tt.want)
+			}
+
+			_, err := r.Match("https://" + tt.clientID + ".example.com/cas")
+			if tt.want && err != nil {
+				t.Errorf("Match() error = %v", err)
+			}
+			if !tt.want && !errors.Is(err, ErrInvalidService) {
+				t.Errorf("Match() of a client with SSO disabled error = %v, want ErrInvalidService", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/joshleeeeee/go-lite-auth/internal/config"
+)
+
+// Single Logout configuration
+const (
+	LogoutRetryBackoff = 500 * time.Millisecond // Delay between back-channel logout attempts
+)
+
+// SLONotifier delivers CAS back-channel logout requests to services
+type SLONotifier struct {
+	client  *http.Client
+	retries int
+}
+
+// NewSLONotifier creates a new SLONotifier from the SSO configuration
+func NewSLONotifier(cfg *config.SSOConfig) *SLONotifier {
+	retries := cfg.LogoutRetries
+	if retries < 0 {
+		retries = 0
+	}
+	return &SLONotifier{
+		client: &http.Client{
+			Timeout: cfg.LogoutTimeoutDuration(),
+			// A logout endpoint must answer itself, never bounce the request elsewhere
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		retries: retries,
+	}
+}
+
+// logoutRequest is the SAML payload of a CAS back-channel logout
+type logoutRequest struct {
+	XMLName      xml.Name `xml:"samlp:LogoutRequest"`
+	SAMLP        string   `xml:"xmlns:samlp,attr"`
+	SAML         string   `xml:"xmlns:saml,attr"`
+	ID           string   `xml:"ID,attr"`
+	Version      string   `xml:"Version,attr"`
+	IssueInstant string   `xml:"IssueInstant,attr"`
+	NameID       string   `xml:"saml:NameID"`
+	SessionIndex string   `xml:"samlp:SessionIndex"`
+}
+
+// buildLogoutRequest renders the logoutRequest payload for a Service Ticket
+func buildLogoutRequest(username, ticket string) (string, error) {
+	payload, err := xml.Marshal(&logoutRequest{
+		SAMLP:        "urn:oasis:names:tc:SAML:2.0:protocol",
+		SAML:         "urn:oasis:names:tc:SAML:2.0:assertion",
+		ID:           "LR-" + uuid.New().String(),
+		Version:      "2.0",
+		IssueInstant: time.Now().UTC().Format(time.RFC3339),
+		NameID:       username,
+		SessionIndex: ticket,
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(payload), nil
+}
+
+// NotifyAll sends a logout request to every service, keyed by the ticket issued to it.
+// It returns the errors of services that could not be notified, keyed by ticket.
+func (n *SLONotifier) NotifyAll(ctx context.Context, username string, services map[string]string) map[string]error {
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		failed = make(map[string]error)
+	)
+
+	for ticket, service := range services {
+		wg.Add(1)
+		go func(ticket, service string) {
+			defer wg.Done()
+			if err := n.Notify(ctx, username, ticket, service); err != nil {
+				mu.Lock()
+				failed[ticket] = err
+				mu.Unlock()
+			}
+		}(ticket, service)
+	}
+	wg.Wait()
+
+	return failed
+}
+
+// Notify sends a logout request for a single Service Ticket, retrying on failure
+func (n *SLONotifier) Notify(ctx context.Context, username, ticket, service string) error {
+	target, err := url.Parse(service)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") {
+		return fmt.Errorf("service %q does not accept back-channel logout", service)
+	}
+
+	payload, err := buildLogoutRequest(username, ticket)
+	if err != nil {
+		return fmt.Errorf("failed to build logout request: %w", err)
+	}
+	body := url.Values{"logoutRequest": {payload}}.Encode()
+
+	for attempt := 0; ; attempt++ {
+		err = n.post(ctx, service, body)
+		if err == nil || attempt >= n.retries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(LogoutRetryBackoff * time.Duration(attempt+1)):
+		}
+	}
+}
+
+// post delivers one logout request and treats any 2xx status as acknowledged
+func (n *SLONotifier) post(ctx context.Context, service, body string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, service, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("service responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// logFailures reports services that did not acknowledge a logout request
+func logFailures(username string, services map[string]string, failed map[string]error) {
+	for ticket, err := range failed {
+		log.Printf("SLO: failed to notify %s of logout for user %s (ticket %s): %v", services[ticket], username, ticket, err)
+	}
+}
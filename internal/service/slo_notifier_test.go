@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/joshleeeeee/go-lite-auth/internal/config"
+)
+
+func TestSLONotifierSendsLogoutRequest(t *testing.T) {
+	var received struct {
+		contentType string
+		request     struct {
+			XMLName      xml.Name `xml:"LogoutRequest"`
+			ID           string   `xml:"ID,attr"`
+			Version      string   `xml:"Version,attr"`
+			NameID       string   `xml:"NameID"`
+			SessionIndex string   `xml:"SessionIndex"`
+		}
+	}
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.contentType = r.Header.Get("Content-Type")
+		if err := xml.Unmarshal([]byte(r.FormValue("logoutRequest")), &received.request); err != nil {
+			t.Errorf("logoutRequest is not valid XML: %v", err)
+		}
+	}))
+	defer service.Close()
+
+	n := NewSLONotifier(&config.SSOConfig{LogoutTimeout: 1})
+	if err := n.Notify(context.Background(), "alice", "ST-123", service.URL); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	if received.contentType != "application/x-www-form-urlencoded" {
+		t.Errorf("Content-Type = %q", received.contentType)
+	}
+	req := received.request
+	if req.NameID != "alice" || req.SessionIndex != "ST-123" || req.Version != "2.0" || req.ID == "" {
+		t.Errorf("logoutRequest = %+v", req)
+	}
+}
+
+func TestSLONotifierRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int32
+		retries  int
+		wantErr  bool
+		wantHits int32
+	}{
+		{"first attempt succeeds", 0, 2, false, 1},
+		{"succeeds after retries", 2, 2, false, 3},
+		{"gives up after retries", 3, 1, true, 2},
+		{"no retries", 1, 0, true, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var hits int32
+			service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&hits, 1) <= tt.failures {
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}
+			}))
+			defer service.Close()
+
+			n := NewSLONotifier(&config.SSOConfig{LogoutTimeout: 1, LogoutRetries: tt.retries})
+			err := n.Notify(context.Background(), "alice", "ST-1", service.URL)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Notify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := atomic.LoadInt32(&hits); got != tt.wantHits {
+				t.Errorf("service called %d times, want %d", got, tt.wantHits)
+			}
+		})
+	}
+}
+
+func TestSLONotifierTimeout(t *testing.T) {
+	release := make(chan struct{})
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer service.Close()
+	defer close(release)
+
+	n := NewSLONotifier(&config.SSOConfig{LogoutTimeout: 1})
+	start := time.Now()
+	if err := n.Notify(context.Background(), "alice", "ST-1", service.URL); err == nil {
+		t.Fatal("Notify() to a hung service succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Notify() returned after %v, want about 1s", elapsed)
+	}
+}
+
+func TestSLONotifierDefaultTimeout(t *testing.T) {
+	n := NewSLONotifier(&config.SSOConfig{})
+	if n.client.Timeout != config.DefaultLogoutTimeout {
+		t.Errorf("timeout = %v, want %v", n.client.Timeout, config.DefaultLogoutTimeout)
+	}
+}
+
+func TestSLONotifierNotifyAll(t *testing.T) {
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ok.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	n := NewSLONotifier(&config.SSOConfig{LogoutTimeout: 1})
+	failed := n.NotifyAll(context.Background(), "alice", map[string]string{
+		"ST-ok":     ok.URL,
+		"ST-failed": failing.URL,
+		"ST-scheme": "ftp://app.example.com/logout",
+	})
+
+	if len(failed) != 2 || failed["ST-failed"] == nil || failed["ST-scheme"] == nil {
+		t.Errorf("NotifyAll() failures = %v, want ST-failed and ST-scheme", failed)
+	}
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/joshleeeeee/go-lite-auth/internal/config"
+	"github.com/joshleeeeee/go-lite-auth/internal/database"
+	"github.com/redis/go-redis/v9"
+)
+
+// Proxy-related errors
+var (
+	ErrPGTNotFound          = errors.New("proxy-granting ticket not found or expired")
+	ErrInvalidProxyCallback = errors.New("proxy callback URL must be a valid HTTPS URL")
+)
+
+// Proxy ticket configuration
+const (
+	PGTPrefix    = "PGT-"
+	PGTIOUPrefix = "PGTIOU-"
+)
+
+// Proxy issues a Proxy Ticket for the target service on behalf of the holder of a Proxy-Granting Ticket
+func (s *SSOService) Proxy(ctx context.Context, pgt, targetService string) (string, error) {
+	if pgt == "" {
+		return "", ErrPGTNotFound
+	}
+	if targetService == "" {
+		return "", ErrInvalidService
+	}
+
+	pgtData, err := database.GetProxyGrantingTicket(ctx, pgt)
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return "", ErrPGTNotFound
+		}
+		return "", err
+	}
+
+	// A PGT never outlives the SSO session it was granted under
+	if pgtData.TGT != "" {
+		if _, err := s.GetTGTUser(ctx, pgtData.TGT); err != nil {
+			if errors.Is(err, ErrTGTNotFound) || errors.Is(err, ErrUserDisabled) {
+				return "", ErrPGTNotFound
+			}
+			return "", err
+		}
+	}
+
+	return s.issueTicket(ctx, ProxyTicketPrefix, &database.TicketData{
+		UserID:   pgtData.UserID,
+		Username: pgtData.Username,
+		Service:  targetService,
+		TGT:      pgtData.TGT,
+		Proxies:  pgtData.Proxies,
+	})
+}
+
+// grantProxyGrantingTicket delivers a new PGT to the service's HTTPS callback and returns the PGTIOU
+// that the service uses to correlate the callback with the validation response
+func (s *SSOService) grantProxyGrantingTicket(ctx context.Context, ticketData *database.TicketData, pgtURL string) (string, error) {
+	callback, err := url.Parse(pgtURL)
+	if err != nil || callback.Scheme != "https" || callback.Host == "" {
+		return "", ErrInvalidProxyCallback
+	}
+
+	// Only registered services may act as proxies
+	if err := s.CheckService(pgtURL); err != nil {
+		return "", err
+	}
+
+	pgtID, err := generateTicketID(PGTPrefix)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate PGT ID: %w", err)
+	}
+	pgtIOU, err := generateTicketID(PGTIOUPrefix)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate PGTIOU: %w", err)
+	}
+
+	// The PGT is stored before the callback, since a service may use it to request a Proxy Ticket
+	// while handling the callback, and removed again when the callback fails
+	pgtData := &database.TicketData{
+		UserID:   ticketData.UserID,
+		Username: ticketData.Username,
+		Service:  pgtURL,
+		TGT:      ticketData.TGT,
+		Proxies:  append([]string{pgtURL}, ticketData.Proxies...),
+	}
+	expire := config.GlobalConfig.SSO.TGTExpireDuration()
+	if err := database.SetProxyGrantingTicket(ctx, pgtID, pgtData, expire); err != nil {
+		return "", fmt.Errorf("failed to store PGT: %w", err)
+	}
+
+	// The callback proves control of the HTTPS endpoint; the PGT is only returned through it
+	query := callback.Query()
+	query.Set("pgtId", pgtID)
+	query.Set("pgtIou", pgtIOU)
+	callback.RawQuery = query.Encode()
+
+	if err := s.callProxyCallback(ctx, callback.String()); err != nil {
+		if delErr := database.DeleteProxyGrantingTicket(ctx, pgtID); delErr != nil {
+			log.Printf("SSO: failed to delete PGT of a failed proxy callback: %v", delErr)
+		}
+		return "", err
+	}
+
+	return pgtIOU, nil
+}
+
+// callProxyCallback delivers a PGT to the pgtUrl of a service, which must answer 200
+func (s *SSOService) callProxyCallback(ctx context.Context, callbackURL string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, callbackURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.proxyClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("proxy callback failed: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("proxy callback responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
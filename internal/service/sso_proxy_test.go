@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/joshleeeeee/go-lite-auth/internal/database"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestGrantProxyGrantingTicket(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		wantErr       bool
+		wantPGT       bool
+		useInCallback bool
+	}{
+		{"proxy ticket requested from the callback", http.StatusOK, false, true, true},
+		{"callback fails", http.StatusInternalServerError, true, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestEnv(t)
+			ctx := context.Background()
+			user := createTestUser(t, "alice", "password123")
+			createTestClient(t, "backend", testRedirectURI)
+
+			s := NewSSOService()
+			var pgtID, proxyTicket string
+			var proxyErr error
+			callback := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				pgtID = r.URL.Query().Get("pgtId")
+				if tt.useInCallback {
+					// A CAS client may redeem the PGT before answering the callback
+					proxyTicket, proxyErr = s.Proxy(r.Context(), pgtID, testRedirectURI)
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer callback.Close()
+			createTestClient(t, "proxy", callback.URL+"/pgt")
+			s.proxyClient = callback.Client()
+
+			ticket := &database.TicketData{UserID: user.ID, Username: user.Username, Service: testRedirectURI}
+			pgtIOU, err := s.grantProxyGrantingTicket(ctx, ticket, callback.URL+"/pgt")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("grantProxyGrantingTicket() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && pgtIOU == "" {
+				t.Error("no PGTIOU returned")
+			}
+			if pgtID == "" {
+				t.Fatal("callback did not receive a pgtId")
+			}
+			if tt.useInCallback && (proxyErr != nil || proxyTicket == "") {
+				t.Errorf("Proxy() inside the callback = %q, %v", proxyTicket, proxyErr)
+			}
+
+			_, err = database.GetProxyGrantingTicket(ctx, pgtID)
+			if stored := err == nil; stored != tt.wantPGT {
+				t.Errorf("PGT stored = %v, want %v (err %v)", stored, tt.wantPGT, err)
+			}
+			if !tt.wantPGT && !errors.Is(err, redis.Nil) {
+				t.Errorf("GetProxyGrantingTicket() error = %v, want redis.Nil", err)
+			}
+		})
+	}
+}
@@ -6,12 +6,16 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"log"
+	"net/http"
+	"strings"
 	"time"
 
+	"github.com/joshleeeeee/go-lite-auth/internal/config"
 	"github.com/joshleeeeee/go-lite-auth/internal/database"
 	"github.com/joshleeeeee/go-lite-auth/internal/model"
 	"github.com/joshleeeeee/go-lite-auth/internal/repository"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/redis/go-redis/v9"
 )
 
 // SSO-related errors
@@ -20,19 +24,27 @@ var (
 	ErrTicketUsed       = errors.New("ticket has already been used")
 	ErrServiceMismatch  = errors.New("service URL mismatch")
 	ErrInvalidService   = errors.New("invalid or missing service URL")
+	ErrTGTNotFound      = errors.New("ticket-granting ticket not found or expired")
+	ErrProxyTicket      = errors.New("proxy tickets are not accepted by this endpoint")
+	ErrTicketNotRenewed = errors.New("ticket was not issued from a new login")
 )
 
 // Ticket configuration
 const (
-	TicketPrefix   = "ST-"
-	TicketExpire   = 60 * time.Second // Service Ticket expires in 60 seconds
-	TicketIDLength = 32               // Length of random ticket ID
+	TicketPrefix      = "ST-"
+	ProxyTicketPrefix = "PT-"
+	TGTPrefix         = "TGT-"
+	TicketExpire      = 60 * time.Second // Service Ticket expires in 60 seconds
+	TicketIDLength    = 32               // Length of random ticket ID
 )
 
 // SSOService handles SSO-related business logic
 type SSOService struct {
 	userRepo    *repository.UserRepository
 	authService *AuthService
+	registry    *ServiceRegistry
+	notifier    *SLONotifier
+	proxyClient *http.Client
 }
 
 // NewSSOService creates a new SSOService instance
@@ -40,6 +52,9 @@ func NewSSOService() *SSOService {
 	return &SSOService{
 		userRepo:    repository.NewUserRepository(),
 		authService: NewAuthService(),
+		registry:    NewServiceRegistry(),
+		notifier:    NewSLONotifier(&config.GlobalConfig.SSO),
+		proxyClient: &http.Client{Timeout: config.GlobalConfig.SSO.ProxyTimeoutDuration()},
 	}
 }
 
@@ -52,31 +67,48 @@ type SSOLoginRequest struct {
 
 // SSOLoginResponse represents the response after successful SSO login
 type SSOLoginResponse struct {
-	Ticket      string `json:"ticket"`
-	RedirectURL string `json:"redirect_url"`
+	Ticket      string `json:"ticket,omitempty"`
+	RedirectURL string `json:"redirect_url,omitempty"`
+	TGT         string `json:"-"` // delivered to the browser as a cookie only
+	MFARequired bool   `json:"mfa_required,omitempty"`
+	MFAToken    string `json:"mfa_token,omitempty"`
+}
+
+// TicketValidation describes a ticket validation request
+type TicketValidation struct {
+	Ticket     string
+	Service    string
+	PGTURL     string // optional proxy callback receiving a Proxy-Granting Ticket
+	AllowProxy bool   // accept Proxy Tickets (PT-) in addition to Service Tickets
+	Renew      bool   // only accept tickets issued from primary credentials
 }
 
 // ValidateTicketResponse represents the response when validating a ticket
 type ValidateTicketResponse struct {
-	UserID   uint   `json:"user_id"`
-	Username string `json:"username"`
-	Email    string `json:"email"`
-	Nickname string `json:"nickname"`
+	UserID       uint                   `json:"user_id"`
+	Username     string                 `json:"username"`
+	Email        string                 `json:"email,omitempty"`
+	Nickname     string                 `json:"nickname,omitempty"`
+	Proxies      []string               `json:"proxies,omitempty"`
+	FromNewLogin bool                   `json:"from_new_login"`
+	Attributes   map[string]interface{} `json:"attributes,omitempty"` // attributes released to the service
+	PGTIOU       string                 `json:"-"`                    // only returned through the CAS protocol endpoints
 }
 
-// generateTicketID generates a random ticket ID
-func generateTicketID() (string, error) {
+// generateTicketID generates a random ticket ID with the given prefix
+func generateTicketID(prefix string) (string, error) {
 	bytes := make([]byte, TicketIDLength/2)
 	if _, err := rand.Read(bytes); err != nil {
 		return "", err
 	}
-	return TicketPrefix + hex.EncodeToString(bytes), nil
+	return prefix + hex.EncodeToString(bytes), nil
 }
 
 // Login authenticates a user and generates a Service Ticket for SSO
 func (s *SSOService) Login(ctx context.Context, req *SSOLoginRequest, clientIP string) (*SSOLoginResponse, error) {
-	if req.Service == "" {
-		return nil, ErrInvalidService
+	// Reject unregistered services before touching credentials
+	if err := s.CheckService(req.Service); err != nil {
+		return nil, err
 	}
 
 	// Check login rate limit
@@ -100,7 +132,7 @@ func (s *SSOService) Login(ctx context.Context, req *SSOLoginRequest, clientIP s
 	}
 
 	// Check password
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+	if !s.authService.checkPassword(user, req.Password) {
 		database.IncrLoginFail(ctx, failKey, LoginLockDuration)
 		return nil, ErrInvalidCredentials
 	}
@@ -109,77 +141,313 @@ func (s *SSOService) Login(ctx context.Context, req *SSOLoginRequest, clientIP s
 	if user.Status != 1 {
 		return nil, ErrUserDisabled
 	}
+	if err := checkEmailVerified(user); err != nil {
+		return nil, err
+	}
+
+	// Users with a second factor get an mfa_token to exchange at /api/auth/mfa/verify
+	mfaToken, err := s.authService.startMFA(ctx, &database.MFAChallengeData{
+		UserID:  user.ID,
+		FailKey: failKey,
+		Service: req.Service,
+		AMR:     []string{AMRPassword},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if mfaToken != "" {
+		return &SSOLoginResponse{MFARequired: true, MFAToken: mfaToken}, nil
+	}
 
 	// Clear login failures on success
 	database.ClearLoginFail(ctx, failKey)
 
+	return s.completeLogin(ctx, user, req.Service, []string{AMRPassword})
+}
+
+// completeLogin establishes the SSO session of an authenticated user and issues a Service Ticket
+func (s *SSOService) completeLogin(ctx context.Context, user *model.User, service string, amr []string) (*SSOLoginResponse, error) {
+	// Establish the SSO session
+	tgt, err := s.CreateTGT(ctx, user, amr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create TGT: %w", err)
+	}
+
 	// Generate Service Ticket
-	ticket, err := s.GenerateServiceTicket(ctx, user, req.Service)
+	ticket, err := s.GenerateServiceTicket(ctx, user, service, tgt, true)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate ticket: %w", err)
 	}
 
 	// Build redirect URL with ticket
-	redirectURL := buildRedirectURL(req.Service, ticket)
+	redirectURL := buildRedirectURL(service, ticket)
 
 	return &SSOLoginResponse{
 		Ticket:      ticket,
 		RedirectURL: redirectURL,
+		TGT:         tgt,
 	}, nil
 }
 
-// GenerateServiceTicket creates a one-time Service Ticket
-func (s *SSOService) GenerateServiceTicket(ctx context.Context, user *model.User, service string) (string, error) {
-	ticketID, err := generateTicketID()
+// LoginWithTGT issues a Service Ticket for an existing SSO session without asking for credentials
+func (s *SSOService) LoginWithTGT(ctx context.Context, tgt, service string) (*SSOLoginResponse, error) {
+	if err := s.CheckService(service); err != nil {
+		return nil, err
+	}
+
+	user, err := s.GetTGTUser(ctx, tgt)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate ticket ID: %w", err)
+		return nil, err
+	}
+
+	ticket, err := s.GenerateServiceTicket(ctx, user, service, tgt, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ticket: %w", err)
+	}
+
+	return &SSOLoginResponse{
+		Ticket:      ticket,
+		RedirectURL: buildRedirectURL(service, ticket),
+		TGT:         tgt,
+	}, nil
+}
+
+// CreateTGT creates a Ticket-Granting Ticket representing the user's SSO session,
+// recording the authentication methods (amr) the user logged in with
+func (s *SSOService) CreateTGT(ctx context.Context, user *model.User, amr []string) (string, error) {
+	tgtID, err := generateTicketID(TGTPrefix)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate TGT ID: %w", err)
+	}
+
+	tgtData := &database.TGTData{
+		UserID:    user.ID,
+		Username:  user.Username,
+		AMR:       amr,
+		CreatedAt: time.Now(),
+	}
+
+	expire := config.GlobalConfig.SSO.TGTExpireDuration()
+	if err := database.SetTGT(ctx, tgtID, tgtData, expire); err != nil {
+		return "", fmt.Errorf("failed to store TGT: %w", err)
+	}
+
+	return tgtID, nil
+}
+
+// GetTGTUser resolves the user of a Ticket-Granting Ticket, destroying the TGT if the user is no longer active
+func (s *SSOService) GetTGTUser(ctx context.Context, tgt string) (*model.User, error) {
+	_, user, err := s.GetTGTSession(ctx, tgt)
+	return user, err
+}
+
+// GetTGTSession resolves the SSO session and its user, destroying the TGT if the user is no longer active
+func (s *SSOService) GetTGTSession(ctx context.Context, tgt string) (*database.TGTData, *model.User, error) {
+	if tgt == "" {
+		return nil, nil, ErrTGTNotFound
+	}
+
+	tgtData, err := database.GetTGT(ctx, tgt)
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil, ErrTGTNotFound
+		}
+		return nil, nil, err
+	}
+
+	user, err := s.userRepo.GetByID(tgtData.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			database.DeleteTGT(ctx, tgt)
+			return nil, nil, ErrTGTNotFound
+		}
+		return nil, nil, err
 	}
 
-	ticketData := &database.TicketData{
-		UserID:   user.ID,
-		Username: user.Username,
-		Service:  service,
+	if user.Status != 1 {
+		database.DeleteTGT(ctx, tgt)
+		return nil, nil, ErrUserDisabled
 	}
 
-	if err := database.SetTicketWithService(ctx, ticketID, ticketData, TicketExpire); err != nil {
+	return tgtData, user, nil
+}
+
+// Logout destroys the SSO session and notifies every service that was issued a ticket under it (SLO)
+func (s *SSOService) Logout(ctx context.Context, tgt string) error {
+	if tgt == "" {
+		return nil
+	}
+
+	tgtData, err := database.GetTGT(ctx, tgt)
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil
+		}
+		return err
+	}
+
+	services, err := database.GetTGTServices(ctx, tgt)
+	if err != nil {
+		return fmt.Errorf("failed to load TGT services: %w", err)
+	}
+
+	if err := database.DeleteTGT(ctx, tgt); err != nil {
+		return fmt.Errorf("failed to delete TGT: %w", err)
+	}
+
+	// Back-channel notifications must outlive the logout request itself
+	if len(services) > 0 {
+		go func() {
+			failed := s.notifier.NotifyAll(context.Background(), tgtData.Username, services)
+			logFailures(tgtData.Username, services, failed)
+		}()
+	}
+
+	return nil
+}
+
+// LogoutUser ends every SSO session of a user except keepTGT (when not empty),
+// notifying their services as on a regular logout
+func (s *SSOService) LogoutUser(ctx context.Context, userID uint, keepTGT string) error {
+	tgts, err := database.GetUserTGTs(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to list SSO sessions: %w", err)
+	}
+
+	for _, tgt := range tgts {
+		if tgt == keepTGT {
+			continue
+		}
+		if err := s.Logout(ctx, tgt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GenerateServiceTicket creates a one-time Service Ticket.
+// When issued under a TGT, the service is recorded so it can be notified on logout.
+// fromNewLogin marks tickets issued right after the user presented primary credentials.
+func (s *SSOService) GenerateServiceTicket(ctx context.Context, user *model.User, service, tgt string, fromNewLogin bool) (string, error) {
+	return s.issueTicket(ctx, TicketPrefix, &database.TicketData{
+		UserID:       user.ID,
+		Username:     user.Username,
+		Service:      service,
+		TGT:          tgt,
+		FromNewLogin: fromNewLogin,
+	})
+}
+
+// CheckService verifies that a service URL belongs to an enabled, registered client
+func (s *SSOService) CheckService(service string) error {
+	_, err := s.registry.Match(service)
+	return err
+}
+
+// issueTicket stores a one-time ticket for a registered service and records the service
+// with the TGT for Single Logout
+func (s *SSOService) issueTicket(ctx context.Context, prefix string, ticketData *database.TicketData) (string, error) {
+	registered, err := s.registry.Match(ticketData.Service)
+	if err != nil {
+		return "", err
+	}
+
+	ticketID, err := generateTicketID(prefix)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate ticket ID: %w", err)
+	}
+
+	if err := database.SetTicketWithService(ctx, ticketID, ticketData, registered.TicketTTL); err != nil {
 		return "", fmt.Errorf("failed to store ticket: %w", err)
 	}
 
+	if ticketData.TGT != "" {
+		expire := config.GlobalConfig.SSO.TGTExpireDuration()
+		if err := database.AddTGTService(ctx, ticketData.TGT, ticketID, ticketData.Service, expire); err != nil {
+			return "", fmt.Errorf("failed to register service for logout: %w", err)
+		}
+	}
+
 	return ticketID, nil
 }
 
 // ValidateServiceTicket validates and consumes a Service Ticket (one-time use)
 func (s *SSOService) ValidateServiceTicket(ctx context.Context, ticket, service string) (*ValidateTicketResponse, error) {
-	if ticket == "" {
+	return s.ValidateTicket(ctx, &TicketValidation{
+		Ticket:  ticket,
+		Service: service,
+	})
+}
+
+// ValidateTicket validates and consumes a Service or Proxy Ticket, delivering a
+// Proxy-Granting Ticket to the callback when one is requested
+func (s *SSOService) ValidateTicket(ctx context.Context, v *TicketValidation) (*ValidateTicketResponse, error) {
+	if v.Ticket == "" {
 		return nil, ErrTicketNotFound
 	}
-	if service == "" {
+	if v.Service == "" {
 		return nil, ErrInvalidService
 	}
 
 	// Atomically get and delete ticket (ensures one-time use)
-	ticketData, err := database.GetAndDeleteTicketData(ctx, ticket)
+	ticketData, err := database.GetAndDeleteTicketData(ctx, v.Ticket)
 	if err != nil {
 		return nil, ErrTicketNotFound
 	}
 
+	// Proxy Tickets are only accepted where the caller is prepared to inspect the proxy chain
+	if strings.HasPrefix(v.Ticket, ProxyTicketPrefix) && !v.AllowProxy {
+		return nil, ErrProxyTicket
+	}
+
 	// Validate service URL matches
-	if ticketData.Service != service {
+	if ticketData.Service != v.Service {
 		return nil, ErrServiceMismatch
 	}
 
+	// renew=true demands that the user actually re-authenticated for this ticket
+	if v.Renew && !ticketData.FromNewLogin {
+		return nil, ErrTicketNotRenewed
+	}
+
+	// The service may have been disabled since the ticket was issued
+	registered, err := s.registry.Match(v.Service)
+	if err != nil {
+		return nil, err
+	}
+
 	// Get full user info
 	user, err := s.userRepo.GetByID(ticketData.UserID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user info: %w", err)
 	}
 
-	return &ValidateTicketResponse{
-		UserID:   user.ID,
-		Username: user.Username,
-		Email:    user.Email,
-		Nickname: user.Nickname,
-	}, nil
+	resp := &ValidateTicketResponse{
+		UserID:       user.ID,
+		Username:     user.Username,
+		Proxies:      ticketData.Proxies,
+		FromNewLogin: ticketData.FromNewLogin,
+		Attributes:   releaseAttributes(user, registered),
+	}
+	// The legacy fields follow the same policy as the attributes themselves
+	if registered.ReleasesAttribute("email") {
+		resp.Email = user.Email
+	}
+	if registered.ReleasesAttribute("nickname") {
+		resp.Nickname = user.Nickname
+	}
+
+	// A failed callback does not fail the validation, the service simply gets no PGT
+	if v.PGTURL != "" {
+		pgtIOU, err := s.grantProxyGrantingTicket(ctx, ticketData, v.PGTURL)
+		if err != nil {
+			log.Printf("SSO: no PGT issued for %s: %v", v.PGTURL, err)
+		} else {
+			resp.PGTIOU = pgtIOU
+		}
+	}
+
+	return resp, nil
 }
 
 // buildRedirectURL appends the ticket parameter to the service URL
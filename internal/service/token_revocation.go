@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/joshleeeeee/go-lite-auth/internal/config"
+	"github.com/joshleeeeee/go-lite-auth/internal/database"
+	"github.com/joshleeeeee/go-lite-auth/pkg/jwt"
+)
+
+// RevokeToken revokes a token for the rest of its lifetime. Revoking a refresh token
+// also revokes the access tokens that were issued together with it.
+func (s *AuthService) RevokeToken(ctx context.Context, claims *jwt.Claims) error {
+	remainingTime := jwt.GetTokenRemainingTime(claims)
+	if remainingTime <= 0 {
+		return nil
+	}
+
+	if err := database.AddToBlacklist(ctx, claims.TokenID, remainingTime); err != nil {
+		return fmt.Errorf("failed to blacklist token: %w", err)
+	}
+
+	if claims.Type == jwt.RefreshToken {
+		// Revoking a refresh token ends its whole grant
+		if claims.FamilyID != "" {
+			if err := database.DeleteRefreshFamily(ctx, claims.FamilyID); err != nil {
+				return fmt.Errorf("failed to revoke refresh token family: %w", err)
+			}
+		}
+
+		// Access tokens issued with the refresh token expire within one access token lifetime
+		expire := config.GlobalConfig.JWT.AccessTokenDuration()
+		if err := database.RevokeRefreshLineage(ctx, claims.TokenID, expire); err != nil {
+			return fmt.Errorf("failed to revoke access tokens: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// RevokeUserTokens revokes every refresh token family of a user, and so every token issued to the user
+func (s *AuthService) RevokeUserTokens(ctx context.Context, userID uint) error {
+	return revokeRefreshFamilies(ctx, userID, func(string, string) bool { return true })
+}
+
+// RevokeOtherUserTokens revokes every token of a user except those of the given refresh token family
+func (s *AuthService) RevokeOtherUserTokens(ctx context.Context, userID uint, keepFamilyID string) error {
+	return revokeRefreshFamilies(ctx, userID, func(familyID, _ string) bool {
+		return familyID != keepFamilyID
+	})
+}
+
+// RevokeClientTokens revokes every token a client holds for a user by revoking their refresh token families
+func (s *AuthService) RevokeClientTokens(ctx context.Context, userID uint, clientID string) error {
+	return revokeRefreshFamilies(ctx, userID, func(_, familyClientID string) bool {
+		return familyClientID == clientID
+	})
+}
+
+// revokeRefreshFamilies revokes the user's refresh token families whose client matches,
+// and with them every access token issued from those families
+func revokeRefreshFamilies(ctx context.Context, userID uint, match func(familyID, clientID string) bool) error {
+	families, err := database.GetUserRefreshFamilies(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to list refresh token families: %w", err)
+	}
+
+	for familyID, clientID := range families {
+		if !match(familyID, clientID) {
+			continue
+		}
+		if err := database.DeleteRefreshFamily(ctx, familyID); err != nil {
+			return fmt.Errorf("failed to revoke refresh token family: %w", err)
+		}
+	}
+	return nil
+}
+
+// IsTokenRevoked reports whether a token, the refresh token it was issued with, or its
+// refresh token family has been revoked
+func IsTokenRevoked(ctx context.Context, claims *jwt.Claims) (bool, error) {
+	keys := []string{database.PrefixBlacklist + claims.TokenID}
+	if claims.RefreshID != "" {
+		keys = append(keys, database.PrefixRevokedRefresh+claims.RefreshID)
+	}
+	revoked, err := database.AnyExists(ctx, keys...)
+	if err != nil || revoked {
+		return revoked, err
+	}
+
+	// A family only exists while it has not been revoked or expired
+	if claims.FamilyID != "" {
+		exists, err := database.RefreshFamilyExists(ctx, claims.FamilyID)
+		if err != nil {
+			return false, err
+		}
+		return !exists, nil
+	}
+	return false, nil
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/joshleeeeee/go-lite-auth/internal/database"
+	"github.com/joshleeeeee/go-lite-auth/internal/model"
+	"github.com/joshleeeeee/go-lite-auth/internal/repository"
+	"github.com/joshleeeeee/go-lite-auth/pkg/hasher"
+	"github.com/joshleeeeee/go-lite-auth/pkg/jwt"
+)
+
+// Profile errors
+var (
+	ErrEmailTaken              = errors.New("email is already in use")
+	ErrInvalidAvatar           = errors.New("avatar must be an http or https URL")
+	ErrWrongPassword           = errors.New("current password is incorrect")
+	ErrPasswordUnchanged       = errors.New("new password must differ from the current password")
+	ErrTooManyPasswordAttempts = errors.New("too many password attempts, please try again later")
+)
+
+// ScopeAccount lets a client token change the user's profile and password; first-party tokens always can
+const ScopeAccount = "account"
+
+// UserService handles self-service changes to a user's own account
+type UserService struct {
+	userRepo    *repository.UserRepository
+	authService *AuthService
+	ssoService  *SSOService
+}
+
+// NewUserService creates a new UserService instance
+func NewUserService() *UserService {
+	return &UserService{
+		userRepo:    repository.NewUserRepository(),
+		authService: NewAuthService(),
+		ssoService:  NewSSOService(),
+	}
+}
+
+// UpdateProfileRequest represents a partial profile update; omitted fields are left unchanged
+type UpdateProfileRequest struct {
+	Nickname *string `json:"nickname" binding:"omitempty,max=50"`
+	Avatar   *string `json:"avatar" binding:"omitempty,max=255"` // empty removes the avatar
+	Email    *string `json:"email" binding:"omitempty,email,max=100"`
+}
+
+// ChangePasswordRequest represents a password change by the user
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=6,max=50"`
+}
+
+// UpdateProfile applies a partial update to the user's profile. A new email address has to be
+// verified again.
+func (s *UserService) UpdateProfile(ctx context.Context, userID uint, req *UpdateProfileRequest) (*model.User, error) {
+	user, err := s.getUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Nickname != nil {
+		user.Nickname = strings.TrimSpace(*req.Nickname)
+	}
+	if req.Avatar != nil {
+		avatar := strings.TrimSpace(*req.Avatar)
+		if avatar != "" && !isHTTPURL(avatar) {
+			return nil, ErrInvalidAvatar
+		}
+		user.Avatar = avatar
+	}
+	emailChanged := req.Email != nil && !strings.EqualFold(*req.Email, user.Email)
+	if emailChanged {
+		exists, err := s.userRepo.ExistsByEmail(*req.Email)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check email: %w", err)
+		}
+		if exists {
+			return nil, ErrEmailTaken
+		}
+		user.Email = *req.Email
+		user.EmailVerifiedAt = nil
+	}
+
+	if err := s.userRepo.Update(user); err != nil {
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+
+	if emailChanged {
+		if err := requestEmailVerification(ctx, user); err != nil {
+			log.Printf("Auth: no verification email for the new address of user %d: %v", user.ID, err)
+		}
+	}
+	return user, nil
+}
+
+// ChangePassword replaces the user's password after checking the current one. Every other
+// session ends: refresh token families other than the caller's are revoked and SSO sessions
+// other than keepTGT (when not empty) are logged out.
+func (s *UserService) ChangePassword(ctx context.Context, claims *jwt.Claims, keepTGT string, req *ChangePasswordRequest) error {
+	// Guessing the current password with a stolen token is throttled like a login
+	failKey := fmt.Sprintf("password:%d", claims.UserID)
+	failCount, err := database.GetLoginFailCount(ctx, failKey)
+	if err != nil {
+		return fmt.Errorf("failed to check login attempts: %w", err)
+	}
+	if failCount >= MaxLoginAttempts {
+		return ErrTooManyPasswordAttempts
+	}
+
+	user, err := s.getUser(claims.UserID)
+	if err != nil {
+		return err
+	}
+	if match, _, err := hasher.Verify(req.CurrentPassword, user.Password); err != nil || !match {
+		database.IncrLoginFail(ctx, failKey, LoginLockDuration)
+		return ErrWrongPassword
+	}
+	database.ClearLoginFail(ctx, failKey)
+
+	if req.NewPassword == req.CurrentPassword {
+		return ErrPasswordUnchanged
+	}
+
+	hashedPassword, err := hasher.Hash(req.NewPassword)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	user.Password = hashedPassword
+	if err := s.userRepo.Update(user); err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+
+	if err := s.authService.RevokeOtherUserTokens(ctx, user.ID, claims.FamilyID); err != nil {
+		return err
+	}
+	if err := s.ssoService.LogoutUser(ctx, user.ID, keepTGT); err != nil {
+		return err
+	}
+
+	log.Printf("Auth: password of user %d changed", user.ID)
+	emitSecurityEvent(ctx, &SecurityEvent{
+		Type:   EventPasswordChanged,
+		UserID: user.ID,
+		Detail: "password changed by the user, other sessions revoked",
+	})
+	return nil
+}
+
+// getUser finds a live user
+func (s *UserService) getUser(id uint) (*model.User, error) {
+	user, err := s.userRepo.GetByID(id)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// isHTTPURL reports whether value is an absolute http or https URL
+func isHTTPURL(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -0,0 +1,600 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"github.com/joshleeeeee/go-lite-auth/internal/config"
+	"github.com/joshleeeeee/go-lite-auth/internal/database"
+	"github.com/joshleeeeee/go-lite-auth/internal/model"
+	"github.com/joshleeeeee/go-lite-auth/internal/repository"
+	"github.com/redis/go-redis/v9"
+)
+
+// WebAuthn errors
+var (
+	ErrInvalidWebAuthnChallenge = errors.New("WebAuthn challenge is invalid or expired")
+	ErrInvalidWebAuthnResponse  = errors.New("invalid WebAuthn response")
+	ErrPasskeyNotFound          = errors.New("passkey not found")
+	ErrPasskeyRegistered        = errors.New("passkey is already registered")
+	ErrNoPasskeys               = errors.New("no passkey is registered")
+	ErrInvalidPasskeyName       = errors.New("passkey name must be at most 50 characters")
+)
+
+// Passkey naming
+const (
+	DefaultPasskeyName   = "Passkey"
+	PasskeyNameMaxLength = 50
+)
+
+// WebAuthnService handles passkey registration, passwordless login and passkeys as a second factor
+type WebAuthnService struct {
+	userRepo     *repository.UserRepository
+	mfaRepo      *repository.MFARepository
+	webauthnRepo *repository.WebAuthnRepository
+	mfaService   *MFAService
+}
+
+// NewWebAuthnService creates a new WebAuthnService instance
+func NewWebAuthnService() *WebAuthnService {
+	return &WebAuthnService{
+		userRepo:     repository.NewUserRepository(),
+		mfaRepo:      repository.NewMFARepository(),
+		webauthnRepo: repository.NewWebAuthnRepository(),
+		mfaService:   NewMFAService(),
+	}
+}
+
+// PasskeyLoginRequest starts a passwordless login; with a service, the login is an SSO login
+type PasskeyLoginRequest struct {
+	Service string `json:"service" form:"service"`
+}
+
+// PasskeyMFARequest starts the passkey check of a login waiting for its second factor
+type PasskeyMFARequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+}
+
+// PasskeyChangeRequest confirms adding or removing a passkey with the password, or a TOTP or recovery code
+type PasskeyChangeRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+// PasskeyRegistration is a new passkey. Recovery codes are only issued with the first second
+// factor of a user, and are only available in this response.
+type PasskeyRegistration struct {
+	Passkey       *model.WebAuthnCredential `json:"passkey"`
+	RecoveryCodes []string                  `json:"recovery_codes,omitempty"`
+}
+
+// passkeyUser adapts a user and their passkeys to the webauthn library
+type passkeyUser struct {
+	user        *model.User
+	passkeys    []model.WebAuthnCredential
+	credentials []webauthn.Credential
+}
+
+func (u *passkeyUser) WebAuthnID() []byte                         { return userHandle(u.user.ID) }
+func (u *passkeyUser) WebAuthnName() string                       { return u.user.Username }
+func (u *passkeyUser) WebAuthnDisplayName() string                { return displayName(u.user) }
+func (u *passkeyUser) WebAuthnIcon() string                       { return "" }
+func (u *passkeyUser) WebAuthnCredentials() []webauthn.Credential { return u.credentials }
+
+// passkey finds the stored passkey of a credential returned by the library
+func (u *passkeyUser) passkey(credentialID []byte) *model.WebAuthnCredential {
+	for i := range u.credentials {
+		if bytes.Equal(u.credentials[i].ID, credentialID) {
+			return &u.passkeys[i]
+		}
+	}
+	return nil
+}
+
+// BeginRegistration returns the options of navigator.credentials.create() for a new passkey,
+// after the user confirmed it like DeletePasskey
+func (s *WebAuthnService) BeginRegistration(ctx context.Context, userID uint, req *PasskeyChangeRequest) (*protocol.CredentialCreation, error) {
+	user, err := s.mfaService.getUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.mfaService.reauthenticate(ctx, user, req.Password, req.Code); err != nil {
+		return nil, err
+	}
+	pu, err := s.loadPasskeyUser(user)
+	if err != nil {
+		return nil, err
+	}
+
+	rp, err := relyingParty()
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the authenticator from registering a second passkey for the same account
+	exclusions := make([]protocol.CredentialDescriptor, len(pu.credentials))
+	for i, credential := range pu.credentials {
+		exclusions[i] = credential.Descriptor()
+	}
+
+	creation, session, err := rp.BeginRegistration(pu, webauthn.WithExclusions(exclusions))
+	if err != nil {
+		return nil, fmt.Errorf("failed to start WebAuthn registration: %w", err)
+	}
+	if err := startCeremony(ctx, session, &database.WebAuthnSessionData{
+		Purpose: database.WebAuthnRegistration,
+		UserID:  userID,
+	}); err != nil {
+		return nil, err
+	}
+	return creation, nil
+}
+
+// FinishRegistration verifies the attestation of navigator.credentials.create() and stores the passkey
+func (s *WebAuthnService) FinishRegistration(ctx context.Context, userID uint, name string, body io.Reader) (*PasskeyRegistration, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = DefaultPasskeyName
+	}
+	if utf8.RuneCountInString(name) > PasskeyNameMaxLength {
+		return nil, ErrInvalidPasskeyName
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(body)
+	if err != nil {
+		return nil, ErrInvalidWebAuthnResponse
+	}
+	ceremony, session, err := finishCeremony(ctx, parsed.Response.CollectedClientData.Challenge, database.WebAuthnRegistration)
+	if err != nil {
+		return nil, err
+	}
+	if ceremony.UserID != userID {
+		return nil, ErrInvalidWebAuthnChallenge
+	}
+
+	user, err := s.mfaService.getUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	pu, err := s.loadPasskeyUser(user)
+	if err != nil {
+		return nil, err
+	}
+
+	rp, err := relyingParty()
+	if err != nil {
+		return nil, err
+	}
+	credential, err := rp.CreateCredential(pu, *session, parsed)
+	if err != nil {
+		log.Printf("Auth: passkey registration of user %d rejected: %v", userID, err)
+		return nil, ErrInvalidWebAuthnResponse
+	}
+
+	credentialID := base64.RawURLEncoding.EncodeToString(credential.ID)
+	if _, err := s.webauthnRepo.GetByCredentialID(credentialID); err == nil {
+		return nil, ErrPasskeyRegistered
+	} else if !errors.Is(err, repository.ErrWebAuthnCredentialNotFound) {
+		return nil, err
+	}
+
+	totpEnabled, err := s.mfaRepo.HasConfirmedTOTP(userID)
+	if err != nil {
+		return nil, err
+	}
+	firstFactor := !totpEnabled && len(pu.passkeys) == 0
+
+	transports := make([]string, len(credential.Transport))
+	for i, transport := range credential.Transport {
+		transports[i] = string(transport)
+	}
+	passkey := &model.WebAuthnCredential{
+		UserID:          userID,
+		CredentialID:    credentialID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Transports:      strings.Join(transports, ","),
+		AAGUID:          formatAAGUID(credential.Authenticator.AAGUID),
+		SignCount:       credential.Authenticator.SignCount,
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+		Name:            name,
+	}
+	if err := s.webauthnRepo.Create(passkey); err != nil {
+		return nil, fmt.Errorf("failed to save passkey: %w", err)
+	}
+
+	registration := &PasskeyRegistration{Passkey: passkey}
+	if firstFactor {
+		codes, hashes, err := generateRecoveryCodes()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate recovery codes: %w", err)
+		}
+		if err := s.mfaRepo.ReplaceRecoveryCodes(userID, hashes); err != nil {
+			return nil, fmt.Errorf("failed to save recovery codes: %w", err)
+		}
+		registration.RecoveryCodes = codes
+	}
+
+	log.Printf("Auth: passkey %d registered for user %d", passkey.ID, userID)
+	emitSecurityEvent(ctx, &SecurityEvent{Type: EventPasskeyAdded, UserID: userID, Detail: fmt.Sprintf("passkey %q added", name)})
+	return registration, nil
+}
+
+// ListPasskeys returns the passkeys of a user
+func (s *WebAuthnService) ListPasskeys(userID uint) ([]model.WebAuthnCredential, error) {
+	return s.webauthnRepo.ListByUser(userID)
+}
+
+// DeletePasskey removes a passkey of a user after checking their password, or a TOTP or
+// recovery code. Without TOTP or other passkeys, the recovery codes are removed with it.
+func (s *WebAuthnService) DeletePasskey(ctx context.Context, userID, id uint, req *PasskeyChangeRequest) error {
+	user, err := s.mfaService.getUser(userID)
+	if err != nil {
+		return err
+	}
+	if err := s.mfaService.reauthenticate(ctx, user, req.Password, req.Code); err != nil {
+		return err
+	}
+
+	if err := s.webauthnRepo.Delete(userID, id); err != nil {
+		if errors.Is(err, repository.ErrWebAuthnCredentialNotFound) {
+			return ErrPasskeyNotFound
+		}
+		return err
+	}
+
+	remaining, err := s.webauthnRepo.CountByUser(userID)
+	if err != nil {
+		return err
+	}
+	totpEnabled, err := s.mfaRepo.HasConfirmedTOTP(userID)
+	if err != nil {
+		return err
+	}
+	if remaining == 0 && !totpEnabled {
+		if err := s.mfaRepo.DeleteMFA(userID); err != nil {
+			return fmt.Errorf("failed to remove recovery codes: %w", err)
+		}
+	}
+
+	log.Printf("Auth: passkey %d of user %d removed", id, userID)
+	emitSecurityEvent(ctx, &SecurityEvent{Type: EventPasskeyRemoved, UserID: userID, Detail: fmt.Sprintf("passkey %d removed", id)})
+	return nil
+}
+
+// BeginLogin returns the options of navigator.credentials.get() for a passwordless login with
+// any passkey of the site (discoverable credentials). User verification is required, so the
+// passkey alone is a multi-factor login.
+func (s *WebAuthnService) BeginLogin(ctx context.Context, req *PasskeyLoginRequest) (*protocol.CredentialAssertion, error) {
+	// Reject unregistered services before starting the ceremony
+	if req.Service != "" {
+		if err := s.mfaService.ssoService.CheckService(req.Service); err != nil {
+			return nil, err
+		}
+	}
+
+	rp, err := relyingParty()
+	if err != nil {
+		return nil, err
+	}
+	assertion, session, err := rp.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		return nil, fmt.Errorf("failed to start WebAuthn login: %w", err)
+	}
+	if err := startCeremony(ctx, session, &database.WebAuthnSessionData{
+		Purpose: database.WebAuthnLogin,
+		Service: req.Service,
+	}); err != nil {
+		return nil, err
+	}
+	return assertion, nil
+}
+
+// FinishLogin verifies the assertion of a passwordless login and issues the tokens, or the SSO
+// session and a Service Ticket when the login was started with a service
+func (s *WebAuthnService) FinishLogin(ctx context.Context, body io.Reader) (*LoginResult, error) {
+	parsed, err := protocol.ParseCredentialRequestResponseBody(body)
+	if err != nil {
+		return nil, ErrInvalidWebAuthnResponse
+	}
+	ceremony, session, err := finishCeremony(ctx, parsed.Response.CollectedClientData.Challenge, database.WebAuthnLogin)
+	if err != nil {
+		return nil, err
+	}
+
+	rp, err := relyingParty()
+	if err != nil {
+		return nil, err
+	}
+	var pu *passkeyUser
+	credential, err := rp.ValidateDiscoverableLogin(func(rawID, handle []byte) (webauthn.User, error) {
+		found, err := s.findPasskeyUser(rawID, handle)
+		if err != nil {
+			return nil, err
+		}
+		pu = found
+		return found, nil
+	}, *session, parsed)
+	if err != nil {
+		return nil, ErrInvalidWebAuthnResponse
+	}
+
+	if pu.user.Status != 1 {
+		return nil, ErrUserDisabled
+	}
+	if err := checkEmailVerified(pu.user); err != nil {
+		return nil, err
+	}
+	if err := s.recordUse(ctx, pu, credential); err != nil {
+		return nil, err
+	}
+
+	amr := []string{AMRHardwareKey, AMRMFA}
+	if ceremony.Service != "" {
+		resp, err := s.mfaService.ssoService.completeLogin(ctx, pu.user, ceremony.Service, amr)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{SSO: resp}, nil
+	}
+
+	resp, err := s.mfaService.authService.completeLogin(ctx, pu.user)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResult{Auth: resp}, nil
+}
+
+// BeginMFA returns the options of navigator.credentials.get() to complete an mfa_token with
+// one of the user's passkeys
+func (s *WebAuthnService) BeginMFA(ctx context.Context, req *PasskeyMFARequest) (*protocol.CredentialAssertion, error) {
+	_, user, err := s.mfaService.loadChallenge(ctx, req.MFAToken)
+	if err != nil {
+		return nil, err
+	}
+	pu, err := s.loadPasskeyUser(user)
+	if err != nil {
+		return nil, err
+	}
+	if len(pu.credentials) == 0 {
+		return nil, ErrNoPasskeys
+	}
+
+	rp, err := relyingParty()
+	if err != nil {
+		return nil, err
+	}
+	assertion, session, err := rp.BeginLogin(pu)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start WebAuthn login: %w", err)
+	}
+	if err := startCeremony(ctx, session, &database.WebAuthnSessionData{
+		Purpose:  database.WebAuthnMFA,
+		UserID:   user.ID,
+		MFAToken: req.MFAToken,
+	}); err != nil {
+		return nil, err
+	}
+	return assertion, nil
+}
+
+// FinishMFA verifies the passkey assertion of an mfa_token and completes its login like
+// MFAService.VerifyLogin. Rejected assertions count as failed logins.
+func (s *WebAuthnService) FinishMFA(ctx context.Context, body io.Reader) (*LoginResult, error) {
+	parsed, err := protocol.ParseCredentialRequestResponseBody(body)
+	if err != nil {
+		return nil, ErrInvalidWebAuthnResponse
+	}
+	ceremony, session, err := finishCeremony(ctx, parsed.Response.CollectedClientData.Challenge, database.WebAuthnMFA)
+	if err != nil {
+		return nil, err
+	}
+
+	challenge, user, err := s.mfaService.loadChallenge(ctx, ceremony.MFAToken)
+	if err != nil {
+		return nil, err
+	}
+	if user.ID != ceremony.UserID {
+		return nil, ErrInvalidWebAuthnChallenge
+	}
+	pu, err := s.loadPasskeyUser(user)
+	if err != nil {
+		return nil, err
+	}
+
+	rp, err := relyingParty()
+	if err != nil {
+		return nil, err
+	}
+	credential, err := rp.ValidateLogin(pu, *session, parsed)
+	if err != nil {
+		database.IncrLoginFail(ctx, challenge.FailKey, LoginLockDuration)
+		return nil, ErrInvalidWebAuthnResponse
+	}
+	if err := s.recordUse(ctx, pu, credential); err != nil {
+		return nil, err
+	}
+
+	return s.mfaService.completeChallenge(ctx, ceremony.MFAToken, challenge, user, []string{AMRHardwareKey, AMRMFA})
+}
+
+// recordUse stores the sign counter of a verified assertion. A counter that did not increase
+// means the authenticator may have been cloned, so the assertion is rejected.
+func (s *WebAuthnService) recordUse(ctx context.Context, pu *passkeyUser, credential *webauthn.Credential) error {
+	passkey := pu.passkey(credential.ID)
+	if passkey == nil {
+		return ErrInvalidWebAuthnResponse
+	}
+	if credential.Authenticator.CloneWarning {
+		emitSecurityEvent(ctx, &SecurityEvent{
+			Type:   EventPasskeyCloneWarning,
+			UserID: pu.user.ID,
+			Detail: fmt.Sprintf("passkey %d sign counter did not increase (stored %d)", passkey.ID, passkey.SignCount),
+		})
+		return ErrInvalidWebAuthnResponse
+	}
+
+	passkey.SignCount = credential.Authenticator.SignCount
+	passkey.BackupState = credential.Flags.BackupState
+	if err := s.webauthnRepo.RecordUse(passkey); err != nil {
+		return fmt.Errorf("failed to update passkey: %w", err)
+	}
+	return nil
+}
+
+// loadPasskeyUser loads the passkeys of a user
+func (s *WebAuthnService) loadPasskeyUser(user *model.User) (*passkeyUser, error) {
+	passkeys, err := s.webauthnRepo.ListByUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	pu := &passkeyUser{user: user, passkeys: passkeys, credentials: make([]webauthn.Credential, len(passkeys))}
+	for i, passkey := range passkeys {
+		id, err := base64.RawURLEncoding.DecodeString(passkey.CredentialID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid credential ID of passkey %d: %w", passkey.ID, err)
+		}
+		var transports []protocol.AuthenticatorTransport
+		for _, transport := range strings.Split(passkey.Transports, ",") {
+			if transport != "" {
+				transports = append(transports, protocol.AuthenticatorTransport(transport))
+			}
+		}
+		pu.credentials[i] = webauthn.Credential{
+			ID:              id,
+			PublicKey:       passkey.PublicKey,
+			AttestationType: passkey.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: passkey.BackupEligible,
+				BackupState:    passkey.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{SignCount: passkey.SignCount},
+		}
+	}
+	return pu, nil
+}
+
+// findPasskeyUser finds the owner of a discoverable credential from its user handle
+func (s *WebAuthnService) findPasskeyUser(credentialID, handle []byte) (*passkeyUser, error) {
+	userID, ok := parseUserHandle(handle)
+	if !ok {
+		return nil, ErrPasskeyNotFound
+	}
+	passkey, err := s.webauthnRepo.GetByCredentialID(base64.RawURLEncoding.EncodeToString(credentialID))
+	if err != nil {
+		return nil, err
+	}
+	if passkey.UserID != userID {
+		return nil, ErrPasskeyNotFound
+	}
+
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.loadPasskeyUser(user)
+}
+
+// relyingParty configures the webauthn library from the webauthn config section
+func relyingParty() (*webauthn.WebAuthn, error) {
+	cfg := &config.GlobalConfig.WebAuthn
+	timeout := webauthn.TimeoutConfig{
+		Enforce:    true,
+		Timeout:    cfg.ChallengeDuration(),
+		TimeoutUVD: cfg.ChallengeDuration(),
+	}
+
+	rp, err := webauthn.New(&webauthn.Config{
+		RPID:                  cfg.RPID,
+		RPDisplayName:         cfg.RPDisplayName,
+		RPOrigins:             cfg.RPOrigins,
+		AttestationPreference: protocol.PreferNoAttestation,
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementPreferred,
+			UserVerification: protocol.VerificationPreferred,
+		},
+		Timeouts: webauthn.TimeoutsConfig{Login: timeout, Registration: timeout},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid WebAuthn configuration: %w", err)
+	}
+	return rp, nil
+}
+
+// startCeremony stores the session of a WebAuthn ceremony under its challenge
+func startCeremony(ctx context.Context, session *webauthn.SessionData, ceremony *database.WebAuthnSessionData) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("failed to marshal WebAuthn session: %w", err)
+	}
+	ceremony.Session = data
+
+	expire := config.GlobalConfig.WebAuthn.ChallengeDuration()
+	if err := database.SetWebAuthnSession(ctx, session.Challenge, ceremony, expire); err != nil {
+		return fmt.Errorf("failed to store WebAuthn session: %w", err)
+	}
+	return nil
+}
+
+// finishCeremony consumes the session of the challenge signed by the authenticator; a
+// challenge is only accepted once, and only by the ceremony it was issued for
+func finishCeremony(ctx context.Context, challenge, purpose string) (*database.WebAuthnSessionData, *webauthn.SessionData, error) {
+	if challenge == "" {
+		return nil, nil, ErrInvalidWebAuthnChallenge
+	}
+	ceremony, err := database.GetAndDeleteWebAuthnSession(ctx, challenge)
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil, ErrInvalidWebAuthnChallenge
+		}
+		return nil, nil, err
+	}
+	if ceremony.Purpose != purpose {
+		return nil, nil, ErrInvalidWebAuthnChallenge
+	}
+
+	var session webauthn.SessionData
+	if err := json.Unmarshal(ceremony.Session, &session); err != nil {
+		return nil, nil, fmt.Errorf("failed to unmarshal WebAuthn session: %w", err)
+	}
+	return ceremony, &session, nil
+}
+
+// userHandle is the WebAuthn user handle of a user: the user ID as 8 big-endian bytes
+func userHandle(userID uint) []byte {
+	handle := make([]byte, 8)
+	binary.BigEndian.PutUint64(handle, uint64(userID))
+	return handle
+}
+
+// parseUserHandle reads the user ID of a user handle
+func parseUserHandle(handle []byte) (uint, bool) {
+	if len(handle) != 8 {
+		return 0, false
+	}
+	return uint(binary.BigEndian.Uint64(handle)), true
+}
+
+// formatAAGUID formats the authenticator model of a credential as a UUID
+func formatAAGUID(aaguid []byte) string {
+	id, err := uuid.FromBytes(aaguid)
+	if err != nil {
+		return ""
+	}
+	return id.String()
+}
@@ -0,0 +1,358 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/joshleeeeee/go-lite-auth/internal/database"
+	"github.com/joshleeeeee/go-lite-auth/internal/model"
+)
+
+// Authenticator data flags (WebAuthn section 6.1)
+const (
+	flagUserPresent      = 0x01
+	flagUserVerified     = 0x04
+	flagAttestedCredData = 0x40
+)
+
+// softAuthenticator is an ES256 authenticator in software, producing the PublicKeyCredential
+// JSON a browser would send
+type softAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	signCount    uint32
+}
+
+func newSoftAuthenticator(t *testing.T, userID uint) *softAuthenticator {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credentialID := make([]byte, 16)
+	if _, err := rand.Read(credentialID); err != nil {
+		t.Fatal(err)
+	}
+	return &softAuthenticator{key: key, credentialID: credentialID, userHandle: userHandle(userID)}
+}
+
+// register answers navigator.credentials.create() with a "none" attestation
+func (a *softAuthenticator) register(t *testing.T, creation *protocol.CredentialCreation) io.Reader {
+	t.Helper()
+
+	// COSE_Key of an EC2 P-256 ES256 key
+	coseKey, err := webauthncbor.Marshal(map[int]interface{}{
+		1:  2,
+		3:  -7,
+		-1: 1,
+		-2: a.key.PublicKey.X.FillBytes(make([]byte, 32)),
+		-3: a.key.PublicKey.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	attested := make([]byte, 16) // AAGUID
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.credentialID)))
+	attested = append(attested, a.credentialID...)
+	attested = append(attested, coseKey...)
+
+	attestation, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authenticatorData(flagUserPresent|flagUserVerified|flagAttestedCredData, attested),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a.credential(t, map[string]string{
+		"clientDataJSON":    encodeB64(a.clientData(t, "webauthn.create", creation.Response.Challenge)),
+		"attestationObject": encodeB64(attestation),
+	})
+}
+
+// assert answers navigator.credentials.get() with the next sign counter
+func (a *softAuthenticator) assert(t *testing.T, challenge protocol.URLEncodedBase64) io.Reader {
+	t.Helper()
+
+	a.signCount++
+	return a.assertWithCounter(t, challenge, a.signCount)
+}
+
+// assertWithCounter answers navigator.credentials.get() with the given sign counter
+func (a *softAuthenticator) assertWithCounter(t *testing.T, challenge protocol.URLEncodedBase64, signCount uint32) io.Reader {
+	t.Helper()
+
+	a.signCount = signCount
+	clientData := a.clientData(t, "webauthn.get", challenge)
+	authData := a.authenticatorData(flagUserPresent|flagUserVerified, nil)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(authData, clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a.credential(t, map[string]string{
+		"clientDataJSON":    encodeB64(clientData),
+		"authenticatorData": encodeB64(authData),
+		"signature":         encodeB64(signature),
+		"userHandle":        encodeB64(a.userHandle),
+	})
+}
+
+func (a *softAuthenticator) authenticatorData(flags byte, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	return append(data, attested...)
+}
+
+func (a *softAuthenticator) clientData(t *testing.T, ceremony string, challenge protocol.URLEncodedBase64) []byte {
+	t.Helper()
+
+	data, err := json.Marshal(map[string]string{"type": ceremony, "challenge": challenge.String(), "origin": testOrigin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func (a *softAuthenticator) credential(t *testing.T, response map[string]string) io.Reader {
+	t.Helper()
+
+	body, err := json.Marshal(map[string]interface{}{
+		"id":       encodeB64(a.credentialID),
+		"rawId":    encodeB64(a.credentialID),
+		"type":     "public-key",
+		"response": response,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.NewReader(body)
+}
+
+func encodeB64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// registerTestPasskey registers a passkey of the software authenticator, confirmed with the password
+func registerTestPasskey(t *testing.T, s *WebAuthnService, user *model.User, password string) (*softAuthenticator, *PasskeyRegistration) {
+	t.Helper()
+
+	ctx := context.Background()
+	creation, err := s.BeginRegistration(ctx, user.ID, &PasskeyChangeRequest{Password: password})
+	if err != nil {
+		t.Fatalf("BeginRegistration() error = %v", err)
+	}
+	authenticator := newSoftAuthenticator(t, user.ID)
+	registration, err := s.FinishRegistration(ctx, user.ID, "Laptop", authenticator.register(t, creation))
+	if err != nil {
+		t.Fatalf("FinishRegistration() error = %v", err)
+	}
+	return authenticator, registration
+}
+
+func TestPasskeyRegistrationAndLogin(t *testing.T) {
+	setupTestEnv(t)
+	ctx := context.Background()
+	user := createTestUser(t, "alice", "password123")
+	s := NewWebAuthnService()
+
+	authenticator, registration := registerTestPasskey(t, s, user, "password123")
+	if registration.Passkey.Name != "Laptop" || len(registration.RecoveryCodes) != RecoveryCodeCount {
+		t.Errorf("FinishRegistration() = %+v, want a named passkey and recovery codes", registration)
+	}
+
+	// Passwordless login
+	assertion, err := s.BeginLogin(ctx, &PasskeyLoginRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := s.FinishLogin(ctx, authenticator.assert(t, assertion.Response.Challenge))
+	if err != nil || result.Auth == nil || result.Auth.TokenPair == nil {
+		t.Fatalf("FinishLogin() = %+v, %v", result, err)
+	}
+
+	// The passkey makes password logins two-step
+	login, err := NewAuthService().Login(ctx, &LoginRequest{Username: "alice", Password: "password123"}, "127.0.0.1")
+	if err != nil || !login.MFARequired {
+		t.Fatalf("Login() = %+v, %v, want an mfa_token", login, err)
+	}
+	assertion, err = s.BeginMFA(ctx, &PasskeyMFARequest{MFAToken: login.MFAToken})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err = s.FinishMFA(ctx, authenticator.assert(t, assertion.Response.Challenge))
+	if err != nil || result.Auth == nil || result.Auth.TokenPair == nil {
+		t.Fatalf("FinishMFA() = %+v, %v", result, err)
+	}
+
+	var stored model.WebAuthnCredential
+	if err := database.DB.First(&stored, registration.Passkey.ID).Error; err != nil || stored.SignCount != 2 {
+		t.Errorf("stored sign counter = %d, %v, want 2", stored.SignCount, err)
+	}
+}
+
+func TestPasskeyCloneDetection(t *testing.T) {
+	tests := []struct {
+		name      string
+		counters  []uint32
+		wantOK    []bool
+		wantEvent bool
+	}{
+		{"increasing counter", []uint32{1, 2, 7}, []bool{true, true, true}, false},
+		{"repeated counter", []uint32{5, 5}, []bool{true, false}, true},
+		{"decreasing counter", []uint32{5, 3}, []bool{true, false}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestEnv(t)
+			events := captureSecurityEvents(t)
+			ctx := context.Background()
+			user := createTestUser(t, "alice", "password123")
+			s := NewWebAuthnService()
+			authenticator, _ := registerTestPasskey(t, s, user, "password123")
+
+			for i, counter := range tt.counters {
+				assertion, err := s.BeginLogin(ctx, &PasskeyLoginRequest{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, err = s.FinishLogin(ctx, authenticator.assertWithCounter(t, assertion.Response.Challenge, counter))
+				if ok := err == nil; ok != tt.wantOK[i] {
+					t.Errorf("login %d with counter %d: FinishLogin() error = %v, want ok %v", i, counter, err, tt.wantOK[i])
+				}
+				if err != nil && !errors.Is(err, ErrInvalidWebAuthnResponse) {
+					t.Errorf("login %d: FinishLogin() error = %v, want ErrInvalidWebAuthnResponse", i, err)
+				}
+			}
+
+			cloneWarnings := 0
+			for _, event := range *events {
+				if event.Type == EventPasskeyCloneWarning {
+					cloneWarnings++
+				}
+			}
+			if (cloneWarnings > 0) != tt.wantEvent {
+				t.Errorf("passkey_clone_warning events = %d, want event %v", cloneWarnings, tt.wantEvent)
+			}
+		})
+	}
+}
+
+func TestPasskeyChangesRequireReauthentication(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     *PasskeyChangeRequest
+		wantErr error
+	}{
+		{"nothing", &PasskeyChangeRequest{}, ErrReauthRequired},
+		{"wrong password", &PasskeyChangeRequest{Password: "wrong-password"}, ErrWrongPassword},
+		{"wrong code", &PasskeyChangeRequest{Code: "000000"}, ErrInvalidMFACode},
+		{"password", &PasskeyChangeRequest{Password: "password123"}, nil},
+		{"recovery code", nil, nil}, // uses a recovery code of the first passkey
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestEnv(t)
+			ctx := context.Background()
+			user := createTestUser(t, "alice", "password123")
+			s := NewWebAuthnService()
+			_, registration := registerTestPasskey(t, s, user, "password123")
+			req := tt.req
+			if req == nil {
+				req = &PasskeyChangeRequest{Code: registration.RecoveryCodes[0]}
+			}
+
+			if _, err := s.BeginRegistration(ctx, user.ID, req); !errors.Is(err, tt.wantErr) {
+				t.Errorf("BeginRegistration() error = %v, want %v", err, tt.wantErr)
+			}
+			if req.Code != "" && tt.wantErr == nil {
+				// Recovery codes are single-use, use another one to delete
+				req = &PasskeyChangeRequest{Code: registration.RecoveryCodes[1]}
+			}
+
+			err := s.DeletePasskey(ctx, user.ID, registration.Passkey.ID, req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("DeletePasskey() error = %v, want %v", err, tt.wantErr)
+			}
+			count, _ := s.webauthnRepo.CountByUser(user.ID)
+			if deleted := count == 0; deleted != (tt.wantErr == nil) {
+				t.Errorf("passkey deleted = %v, want %v", deleted, tt.wantErr == nil)
+			}
+		})
+	}
+}
+
+func TestFinishCeremonyPurpose(t *testing.T) {
+	setupTestEnv(t)
+	ctx := context.Background()
+	user := createTestUser(t, "alice", "password123")
+	s := NewWebAuthnService()
+
+	creation, err := s.BeginRegistration(ctx, user.ID, &PasskeyChangeRequest{Password: "password123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenge := creation.Response.Challenge.String()
+
+	tests := []struct {
+		name      string
+		challenge string
+		purpose   string
+		wantErr   bool
+	}{
+		{"empty challenge", "", database.WebAuthnRegistration, true},
+		{"unknown challenge", "unknown", database.WebAuthnRegistration, true},
+		{"issued for another ceremony", challenge, database.WebAuthnLogin, true},
+		// A challenge presented to the wrong ceremony is consumed
+		{"consumed", challenge, database.WebAuthnRegistration, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := finishCeremony(ctx, tt.challenge, tt.purpose)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("finishCeremony() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidWebAuthnChallenge) {
+				t.Errorf("finishCeremony() error = %v, want ErrInvalidWebAuthnChallenge", err)
+			}
+		})
+	}
+
+	// A registration challenge cannot be signed to log in
+	creation, err = s.BeginRegistration(ctx, user.ID, &PasskeyChangeRequest{Password: "password123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	authenticator := newSoftAuthenticator(t, user.ID)
+	if _, err := s.FinishLogin(ctx, authenticator.assert(t, creation.Response.Challenge)); !errors.Is(err, ErrInvalidWebAuthnChallenge) {
+		t.Errorf("FinishLogin() with a registration challenge error = %v, want ErrInvalidWebAuthnChallenge", err)
+	}
+
+	creation, err = s.BeginRegistration(ctx, user.ID, &PasskeyChangeRequest{Password: "password123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := finishCeremony(ctx, creation.Response.Challenge.String(), database.WebAuthnRegistration); err != nil {
+		t.Errorf("finishCeremony() of the issued purpose error = %v", err)
+	}
+}
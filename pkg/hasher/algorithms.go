@@ -0,0 +1,358 @@
+package hasher
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// b64 is the unpadded base64 of salts and keys in PHC strings
+var b64 = base64.RawStdEncoding
+
+// BcryptHasher creates bcrypt hashes in their traditional $2a$ format
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h *BcryptHasher) Algorithm() string {
+	return AlgorithmBcrypt
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	// bcrypt silently falls back to its default cost below the minimum
+	if h.Cost < bcrypt.MinCost || h.Cost > MaxBcryptCost {
+		return "", fmt.Errorf("%w: cost must be between %d and %d", ErrInvalidParams, bcrypt.MinCost, MaxBcryptCost)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (h *BcryptHasher) Verify(password, encoded string) (bool, error) {
+	if err := checkBcrypt(encoded); err != nil {
+		return false, err
+	}
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return false, fmt.Errorf("%w: %v", ErrMalformedHash, err)
+}
+
+func (h *BcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != h.Cost
+}
+
+// checkBcrypt rejects bcrypt hashes that cannot be parsed or whose cost is above MaxBcryptCost
+func checkBcrypt(encoded string) error {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformedHash, err)
+	}
+	if cost > MaxBcryptCost {
+		return fmt.Errorf("%w: cost must be at most %d", ErrInvalidParams, MaxBcryptCost)
+	}
+	return nil
+}
+
+// Argon2idHasher creates $argon2id$v=19$m=<KiB>,t=<iterations>,p=<parallelism>$<salt>$<key> hashes
+type Argon2idHasher struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+}
+
+type argon2idHash struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+func (h *Argon2idHasher) Algorithm() string {
+	return AlgorithmArgon2id
+}
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	if h.Iterations < 1 || h.Parallelism < 1 || h.Memory < 8*uint32(h.Parallelism) {
+		return "", fmt.Errorf("%w: iterations and parallelism must be positive, memory at least 8 KiB per lane", ErrInvalidParams)
+	}
+	if err := checkArgon2idLimits(uint64(h.Memory), uint64(h.Iterations), uint64(h.Parallelism)); err != nil {
+		return "", err
+	}
+	salt, err := randomSalt()
+	if err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Memory, h.Iterations, h.Parallelism, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+}
+
+func (h *Argon2idHasher) Verify(password, encoded string) (bool, error) {
+	d, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+	key := argon2.IDKey([]byte(password), d.salt, d.iterations, d.memory, d.parallelism, uint32(len(d.key)))
+	return subtle.ConstantTimeCompare(key, d.key) == 1, nil
+}
+
+func (h *Argon2idHasher) NeedsRehash(encoded string) bool {
+	d, err := decodeArgon2id(encoded)
+	return err != nil || d.memory != h.Memory || d.iterations != h.Iterations ||
+		d.parallelism != h.Parallelism || len(d.key) != KeyLength
+}
+
+func decodeArgon2id(encoded string) (*argon2idHash, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != AlgorithmArgon2id || parts[2] != fmt.Sprintf("v=%d", argon2.Version) {
+		return nil, ErrMalformedHash
+	}
+	params, err := phcParams(parts[3], "m", "t", "p")
+	if err != nil {
+		return nil, err
+	}
+	if params["t"] < 1 || params["p"] < 1 {
+		return nil, ErrMalformedHash
+	}
+	if err := checkArgon2idLimits(params["m"], params["t"], params["p"]); err != nil {
+		return nil, err
+	}
+	d := &argon2idHash{
+		memory:      uint32(params["m"]),
+		iterations:  uint32(params["t"]),
+		parallelism: uint8(params["p"]),
+	}
+	if d.salt, d.key, err = decodeSaltAndKey(parts[4], parts[5], b64); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// checkArgon2idLimits rejects Argon2id parameters above the Max constants
+func checkArgon2idLimits(memory, iterations, parallelism uint64) error {
+	if memory > MaxArgon2idMemory || iterations > MaxArgon2idIterations || parallelism > MaxArgon2idParallelism {
+		return fmt.Errorf("%w: m, t and p must be at most %d KiB, %d and %d",
+			ErrInvalidParams, MaxArgon2idMemory, MaxArgon2idIterations, MaxArgon2idParallelism)
+	}
+	return nil
+}
+
+// ScryptHasher creates $scrypt$ln=<log2 N>,r=<block size>,p=<parallelism>$<salt>$<key> hashes
+type ScryptHasher struct {
+	LogN int
+	R    int
+	P    int
+}
+
+type scryptHash struct {
+	logN int
+	r    int
+	p    int
+	salt []byte
+	key  []byte
+}
+
+func (h *ScryptHasher) Algorithm() string {
+	return AlgorithmScrypt
+}
+
+func (h *ScryptHasher) Hash(password string) (string, error) {
+	if h.LogN < 1 || h.LogN > 30 || h.R < 1 || h.P < 1 {
+		return "", fmt.Errorf("%w: ln must be between 1 and 30, r and p positive", ErrInvalidParams)
+	}
+	if err := checkScryptLimits(h.LogN, h.R, h.P); err != nil {
+		return "", err
+	}
+	salt, err := randomSalt()
+	if err != nil {
+		return "", err
+	}
+	key, err := scrypt.Key([]byte(password), salt, 1<<h.LogN, h.R, h.P, KeyLength)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidParams, err)
+	}
+	return fmt.Sprintf("$scrypt$ln=%d,r=%d,p=%d$%s$%s",
+		h.LogN, h.R, h.P, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+}
+
+func (h *ScryptHasher) Verify(password, encoded string) (bool, error) {
+	d, err := decodeScrypt(encoded)
+	if err != nil {
+		return false, err
+	}
+	key, err := scrypt.Key([]byte(password), d.salt, 1<<d.logN, d.r, d.p, len(d.key))
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrMalformedHash, err)
+	}
+	return subtle.ConstantTimeCompare(key, d.key) == 1, nil
+}
+
+func (h *ScryptHasher) NeedsRehash(encoded string) bool {
+	d, err := decodeScrypt(encoded)
+	return err != nil || d.logN != h.LogN || d.r != h.R || d.p != h.P || len(d.key) != KeyLength
+}
+
+func decodeScrypt(encoded string) (*scryptHash, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 5 || parts[1] != AlgorithmScrypt {
+		return nil, ErrMalformedHash
+	}
+	params, err := phcParams(parts[2], "ln", "r", "p")
+	if err != nil {
+		return nil, err
+	}
+	if params["ln"] < 1 || params["ln"] > 30 || params["r"] < 1 || params["p"] < 1 {
+		return nil, ErrMalformedHash
+	}
+	d := &scryptHash{
+		logN: int(params["ln"]),
+		r:    int(params["r"]),
+		p:    int(params["p"]),
+	}
+	if err := checkScryptLimits(d.logN, d.r, d.p); err != nil {
+		return nil, err
+	}
+	if d.salt, d.key, err = decodeSaltAndKey(parts[3], parts[4], b64); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// checkScryptLimits rejects scrypt parameters using more than MaxScryptMemory or MaxScryptParallelism
+func checkScryptLimits(logN, r, p int) error {
+	if r > MaxScryptMemory/128 || uint64(128*r)<<logN > MaxScryptMemory || p > MaxScryptParallelism {
+		return fmt.Errorf("%w: 128 * r * N must be at most %d bytes and p at most %d",
+			ErrInvalidParams, MaxScryptMemory, MaxScryptParallelism)
+	}
+	return nil
+}
+
+// PBKDF2Hasher verifies PBKDF2-SHA256 hashes imported from legacy systems, in the PHC layout
+// $pbkdf2-sha256$i=<iterations>$<salt>$<key>, the passlib layout $pbkdf2-sha256$<iterations>$<salt>$<key>
+// or the Django layout pbkdf2_sha256$<iterations>$<salt>$<key>. It creates hashes in the PHC layout.
+type PBKDF2Hasher struct {
+	Iterations int
+}
+
+type pbkdf2Hash struct {
+	iterations int
+	salt       []byte
+	key        []byte
+}
+
+func (h *PBKDF2Hasher) Algorithm() string {
+	return AlgorithmPBKDF2SHA256
+}
+
+func (h *PBKDF2Hasher) Hash(password string) (string, error) {
+	if h.Iterations < 1 || h.Iterations > MaxPBKDF2Iterations {
+		return "", fmt.Errorf("%w: iterations must be between 1 and %d", ErrInvalidParams, MaxPBKDF2Iterations)
+	}
+	salt, err := randomSalt()
+	if err != nil {
+		return "", err
+	}
+	key := pbkdf2.Key([]byte(password), salt, h.Iterations, KeyLength, sha256.New)
+	return fmt.Sprintf("$pbkdf2-sha256$i=%d$%s$%s", h.Iterations, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+}
+
+func (h *PBKDF2Hasher) Verify(password, encoded string) (bool, error) {
+	d, err := decodePBKDF2(encoded)
+	if err != nil {
+		return false, err
+	}
+	key := pbkdf2.Key([]byte(password), d.salt, d.iterations, len(d.key), sha256.New)
+	return subtle.ConstantTimeCompare(key, d.key) == 1, nil
+}
+
+func (h *PBKDF2Hasher) NeedsRehash(encoded string) bool {
+	d, err := decodePBKDF2(encoded)
+	return err != nil || d.iterations != h.Iterations || len(d.key) != KeyLength
+}
+
+func decodePBKDF2(encoded string) (*pbkdf2Hash, error) {
+	parts := strings.Split(encoded, "$")
+	d := &pbkdf2Hash{}
+	var err error
+
+	switch {
+	case len(parts) == 4 && parts[0] == "pbkdf2_sha256":
+		// Django: the salt is used as text and the key is padded base64
+		if d.iterations, err = strconv.Atoi(parts[1]); err != nil {
+			return nil, ErrMalformedHash
+		}
+		if d.key, err = base64.StdEncoding.DecodeString(parts[3]); err != nil || len(d.key) == 0 || len(d.key) > MaxKeyLength || parts[2] == "" {
+			return nil, ErrMalformedHash
+		}
+		d.salt = []byte(parts[2])
+	case len(parts) == 5 && parts[0] == "" && parts[1] == AlgorithmPBKDF2SHA256:
+		if strings.HasPrefix(parts[2], "i=") {
+			params, err := phcParams(parts[2], "i")
+			if err != nil {
+				return nil, err
+			}
+			d.iterations = int(params["i"])
+		} else {
+			// passlib writes the bare iteration count and its "adapted" base64, with . instead of +
+			if d.iterations, err = strconv.Atoi(parts[2]); err != nil {
+				return nil, ErrMalformedHash
+			}
+			parts[3] = strings.ReplaceAll(parts[3], ".", "+")
+			parts[4] = strings.ReplaceAll(parts[4], ".", "+")
+		}
+		if d.salt, d.key, err = decodeSaltAndKey(parts[3], parts[4], b64); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrMalformedHash
+	}
+
+	if d.iterations < 1 {
+		return nil, ErrMalformedHash
+	}
+	if d.iterations > MaxPBKDF2Iterations {
+		return nil, fmt.Errorf("%w: iterations must be at most %d", ErrInvalidParams, MaxPBKDF2Iterations)
+	}
+	return d, nil
+}
+
+// decodeSaltAndKey decodes the last two fields of a hash; keys are at most MaxKeyLength bytes
+func decodeSaltAndKey(salt, key string, encoding *base64.Encoding) ([]byte, []byte, error) {
+	s, err := encoding.DecodeString(salt)
+	if err != nil || len(s) == 0 {
+		return nil, nil, ErrMalformedHash
+	}
+	k, err := encoding.DecodeString(key)
+	if err != nil || len(k) == 0 || len(k) > MaxKeyLength {
+		return nil, nil, ErrMalformedHash
+	}
+	return s, k, nil
+}
+
+// randomSalt returns a new random salt
+func randomSalt() ([]byte, error) {
+	salt := make([]byte, SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
@@ -0,0 +1,191 @@
+package hasher
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/joshleeeeee/go-lite-auth/internal/config"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrUnknownAlgorithm = errors.New("unknown password hash algorithm")
+	ErrMalformedHash    = errors.New("malformed password hash")
+	ErrInvalidParams    = errors.New("invalid password hash parameters")
+)
+
+// Algorithms, named by their PHC identifiers
+const (
+	AlgorithmBcrypt       = "bcrypt"
+	AlgorithmArgon2id     = "argon2id"
+	AlgorithmScrypt       = "scrypt"
+	AlgorithmPBKDF2SHA256 = "pbkdf2-sha256" // only verified, to import users of legacy systems
+)
+
+// Salt and key sizes in bytes of the hashes created here
+const (
+	SaltLength = 16
+	KeyLength  = 32
+)
+
+// Upper bounds of the parameters of hashes. Hashes carry their own parameters and may come
+// from an import, so these bound the time and memory a single verification can take.
+const (
+	MaxBcryptCost          = 16
+	MaxArgon2idMemory      = 1 << 20 // KiB
+	MaxArgon2idIterations  = 16
+	MaxArgon2idParallelism = 16
+	MaxScryptMemory        = 1 << 30 // bytes, 128 * r * N
+	MaxScryptParallelism   = 16
+	MaxPBKDF2Iterations    = 5000000
+	MaxKeyLength           = 64
+)
+
+// PasswordHasher hashes passwords with one algorithm and verifies hashes of that algorithm
+type PasswordHasher interface {
+	// Algorithm returns the PHC identifier of the hashes the hasher creates
+	Algorithm() string
+	// Hash returns the encoded hash of a password, including a random salt and the parameters
+	Hash(password string) (string, error)
+	// Verify reports whether a password matches a hash, using the parameters stored in the hash
+	Verify(password, encoded string) (bool, error)
+	// NeedsRehash reports whether a hash of the algorithm was made with other parameters than the hasher's
+	NeedsRehash(encoded string) bool
+}
+
+// verifiers check the hashes of every supported algorithm; their own parameters are not used
+var verifiers = map[string]PasswordHasher{
+	AlgorithmBcrypt:       &BcryptHasher{},
+	AlgorithmArgon2id:     &Argon2idHasher{},
+	AlgorithmScrypt:       &ScryptHasher{},
+	AlgorithmPBKDF2SHA256: &PBKDF2Hasher{},
+}
+
+var (
+	mu sync.RWMutex
+	// current hashes new passwords; bcrypt with its default cost until Init is called
+	current PasswordHasher = &BcryptHasher{Cost: bcrypt.DefaultCost}
+)
+
+// Init creates the hasher of the configured algorithm
+func Init(cfg *config.PasswordHashConfig) error {
+	var h PasswordHasher
+	switch cfg.Algorithm {
+	case AlgorithmBcrypt:
+		h = &BcryptHasher{Cost: cfg.Bcrypt.Cost}
+	case AlgorithmArgon2id, "":
+		h = &Argon2idHasher{
+			Memory:      cfg.Argon2id.Memory,
+			Iterations:  cfg.Argon2id.Iterations,
+			Parallelism: cfg.Argon2id.Parallelism,
+		}
+	case AlgorithmScrypt:
+		h = &ScryptHasher{LogN: cfg.Scrypt.LN, R: cfg.Scrypt.R, P: cfg.Scrypt.P}
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownAlgorithm, cfg.Algorithm)
+	}
+
+	// Hashing a password once checks the parameters before the first user depends on them
+	if _, err := h.Hash("lite-auth"); err != nil {
+		return fmt.Errorf("%s: %w", h.Algorithm(), err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	current = h
+	return nil
+}
+
+// Current returns the hasher of new passwords
+func Current() PasswordHasher {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
+
+// Hash hashes a new password with the configured algorithm
+func Hash(password string) (string, error) {
+	return Current().Hash(password)
+}
+
+// Verify checks a password against a hash of any supported algorithm. After a match, rehash
+// reports whether the hash should be replaced by one of the configured algorithm and parameters.
+func Verify(password, encoded string) (match, rehash bool, err error) {
+	algorithm := Identify(encoded)
+	verifier, ok := verifiers[algorithm]
+	if !ok {
+		return false, false, ErrUnknownAlgorithm
+	}
+
+	match, err = verifier.Verify(password, encoded)
+	if err != nil || !match {
+		return false, false, err
+	}
+
+	h := Current()
+	return true, algorithm != h.Algorithm() || h.NeedsRehash(encoded), nil
+}
+
+// Validate checks that a hash, e.g. one imported from another system, can be verified
+func Validate(encoded string) error {
+	var err error
+	switch Identify(encoded) {
+	case AlgorithmBcrypt:
+		err = checkBcrypt(encoded)
+	case AlgorithmArgon2id:
+		_, err = decodeArgon2id(encoded)
+	case AlgorithmScrypt:
+		_, err = decodeScrypt(encoded)
+	case AlgorithmPBKDF2SHA256:
+		_, err = decodePBKDF2(encoded)
+	default:
+		return ErrUnknownAlgorithm
+	}
+	if err != nil && !errors.Is(err, ErrMalformedHash) && !errors.Is(err, ErrInvalidParams) {
+		return fmt.Errorf("%w: %v", ErrMalformedHash, err)
+	}
+	return err
+}
+
+// Identify returns the algorithm of an encoded hash, or an empty string when it is not supported.
+// bcrypt hashes keep their traditional $2a$/$2b$/$2y$ prefixes, and PBKDF2 is also recognized
+// in the layout of Django (pbkdf2_sha256$...).
+func Identify(encoded string) string {
+	switch {
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		return AlgorithmBcrypt
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		return AlgorithmArgon2id
+	case strings.HasPrefix(encoded, "$scrypt$"):
+		return AlgorithmScrypt
+	case strings.HasPrefix(encoded, "$pbkdf2-sha256$"), strings.HasPrefix(encoded, "pbkdf2_sha256$"):
+		return AlgorithmPBKDF2SHA256
+	default:
+		return ""
+	}
+}
+
+// phcParams parses the comma-separated name=value parameters of a PHC string
+func phcParams(segment string, names ...string) (map[string]uint64, error) {
+	params := make(map[string]uint64, len(names))
+	for _, pair := range strings.Split(segment, ",") {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, ErrMalformedHash
+		}
+		n, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return nil, ErrMalformedHash
+		}
+		params[name] = n
+	}
+	for _, name := range names {
+		if _, ok := params[name]; !ok {
+			return nil, ErrMalformedHash
+		}
+	}
+	return params, nil
+}
@@ -0,0 +1,138 @@
+package hasher
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Hashes of "legacy-pass" made by Django, passlib and the scrypt PHC layout
+const (
+	djangoVector  = "pbkdf2_sha256$260000$saltsalt1234$HLfCAzJdnwcDVeGZ/9jvLCG+L84LJiwZBfUqkWgZO9I="
+	passlibVector = "$pbkdf2-sha256$29000$MDEyMzQ1Njc4OWFiY2RlZg$wRId0g6Wc.WFtv1D4vfCcaW1xl6k9fc9sN0GjHjXUvw"
+	scryptVector  = "$scrypt$ln=14,r=8,p=1$MDEyMzQ1Njc4OWFiY2RlZg$Xra2wkIhcycQvGoQv7NuaZfTL0fJ2XVNkucuk8qd7Kk"
+)
+
+func TestValidate(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("legacy-pass"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	argon2idHash, err := (&Argon2idHasher{Memory: 64, Iterations: 1, Parallelism: 1}).Hash("legacy-pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	salt, key := "MDEyMzQ1Njc4OWFiY2RlZg", "Xra2wkIhcycQvGoQv7NuaZfTL0fJ2XVNkucuk8qd7Kk"
+	longKey := strings.Repeat("A", 88) // 66 bytes
+
+	tests := []struct {
+		name    string
+		encoded string
+		wantErr error
+	}{
+		{"bcrypt", string(bcryptHash), nil},
+		{"bcrypt above the maximum cost", strings.Replace(string(bcryptHash), "$04$", "$31$", 1), ErrInvalidParams},
+		{"bcrypt truncated", string(bcryptHash[:20]), ErrMalformedHash},
+
+		{"argon2id", argon2idHash, nil},
+		{"argon2id other version", strings.Replace(argon2idHash, "v=19", "v=16", 1), ErrMalformedHash},
+		{"argon2id missing parameter", "$argon2id$v=19$m=64,t=1$" + salt + "$" + key, ErrMalformedHash},
+		{"argon2id zero iterations", "$argon2id$v=19$m=64,t=0,p=1$" + salt + "$" + key, ErrMalformedHash},
+		{"argon2id parameter above uint32", "$argon2id$v=19$m=4294967296,t=1,p=1$" + salt + "$" + key, ErrMalformedHash},
+		{"argon2id memory above the maximum", "$argon2id$v=19$m=4294967295,t=1,p=1$" + salt + "$" + key, ErrInvalidParams},
+		{"argon2id iterations above the maximum", "$argon2id$v=19$m=64,t=100000,p=1$" + salt + "$" + key, ErrInvalidParams},
+		{"argon2id parallelism above the maximum", "$argon2id$v=19$m=65536,t=1,p=255$" + salt + "$" + key, ErrInvalidParams},
+		{"argon2id key above the maximum", "$argon2id$v=19$m=64,t=1,p=1$" + salt + "$" + longKey, ErrMalformedHash},
+		{"argon2id missing salt", "$argon2id$v=19$m=64,t=1,p=1$$" + key, ErrMalformedHash},
+
+		{"scrypt", scryptVector, nil},
+		{"scrypt N above 2^30", "$scrypt$ln=31,r=8,p=1$" + salt + "$" + key, ErrMalformedHash},
+		{"scrypt memory above the maximum", "$scrypt$ln=21,r=8,p=1$" + salt + "$" + key, ErrInvalidParams},
+		{"scrypt block size above the maximum", "$scrypt$ln=1,r=4294967295,p=1$" + salt + "$" + key, ErrInvalidParams},
+		{"scrypt parallelism above the maximum", "$scrypt$ln=14,r=8,p=4294967295$" + salt + "$" + key, ErrInvalidParams},
+		{"scrypt invalid base64", "$scrypt$ln=14,r=8,p=1$" + salt + "$!!", ErrMalformedHash},
+
+		{"pbkdf2 Django", djangoVector, nil},
+		{"pbkdf2 passlib", passlibVector, nil},
+		{"pbkdf2 PHC", "$pbkdf2-sha256$i=29000$" + salt + "$" + key, nil},
+		{"pbkdf2 Django iterations above the maximum", "pbkdf2_sha256$4294967295$saltsalt1234$HLfCAzJdnwcDVeGZ/9jvLCG+L84LJiwZBfUqkWgZO9I=", ErrInvalidParams},
+		{"pbkdf2 Django iterations above int", "pbkdf2_sha256$99999999999999999999$saltsalt1234$HLfCAzJdnwcDVeGZ/9jvLCG+L84LJiwZBfUqkWgZO9I=", ErrMalformedHash},
+		{"pbkdf2 passlib iterations above the maximum", "$pbkdf2-sha256$1000000000$" + salt + "$" + key, ErrInvalidParams},
+		{"pbkdf2 PHC iterations above the maximum", "$pbkdf2-sha256$i=1000000000$" + salt + "$" + key, ErrInvalidParams},
+		{"pbkdf2 zero iterations", "$pbkdf2-sha256$i=0$" + salt + "$" + key, ErrMalformedHash},
+		{"pbkdf2 Django empty salt", "pbkdf2_sha256$260000$$HLfCAzJdnwcDVeGZ/9jvLCG+L84LJiwZBfUqkWgZO9I=", ErrMalformedHash},
+		{"pbkdf2 Django key above the maximum", "pbkdf2_sha256$260000$saltsalt1234$" + longKey, ErrMalformedHash},
+
+		{"unknown algorithm", "$md5$salt$hash", ErrUnknownAlgorithm},
+		{"plaintext", "legacy-pass", ErrUnknownAlgorithm},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.encoded)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("Validate() error = %v, want nil", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Validate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyImportedHashes(t *testing.T) {
+	for _, encoded := range []string{djangoVector, passlibVector, scryptVector} {
+		match, _, err := Verify("legacy-pass", encoded)
+		if err != nil || !match {
+			t.Errorf("Verify(%q) = %v, %v, want a match", encoded, match, err)
+		}
+		if match, _, err := Verify("wrong-pass", encoded); err != nil || match {
+			t.Errorf("Verify(%q) with a wrong password = %v, %v, want no match", encoded, match, err)
+		}
+	}
+}
+
+func TestHashLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		hasher PasswordHasher
+		valid  bool
+	}{
+		{"bcrypt", &BcryptHasher{Cost: bcrypt.MinCost}, true},
+		{"bcrypt above the maximum cost", &BcryptHasher{Cost: MaxBcryptCost + 1}, false},
+		{"argon2id", &Argon2idHasher{Memory: 64, Iterations: 1, Parallelism: 1}, true},
+		{"argon2id memory below 8 KiB per lane", &Argon2idHasher{Memory: 8, Iterations: 1, Parallelism: 2}, false},
+		{"argon2id memory above the maximum", &Argon2idHasher{Memory: MaxArgon2idMemory + 1, Iterations: 1, Parallelism: 1}, false},
+		{"argon2id parallelism above the maximum", &Argon2idHasher{Memory: 1024, Iterations: 1, Parallelism: MaxArgon2idParallelism + 1}, false},
+		{"scrypt", &ScryptHasher{LogN: 4, R: 8, P: 1}, true},
+		{"scrypt memory above the maximum", &ScryptHasher{LogN: 20, R: 16, P: 1}, false},
+		{"pbkdf2", &PBKDF2Hasher{Iterations: 1000}, true},
+		{"pbkdf2 iterations above the maximum", &PBKDF2Hasher{Iterations: MaxPBKDF2Iterations + 1}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := tt.hasher.Hash("password123")
+			if !tt.valid {
+				if !errors.Is(err, ErrInvalidParams) {
+					t.Fatalf("Hash() error = %v, want ErrInvalidParams", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Hash() error = %v", err)
+			}
+			if match, err := tt.hasher.Verify("password123", encoded); err != nil || !match {
+				t.Errorf("Verify() = %v, %v, want a match", match, err)
+			}
+			if tt.hasher.NeedsRehash(encoded) {
+				t.Errorf("NeedsRehash(%q) = true for a hash of the same parameters", encoded)
+			}
+			if err := Validate(encoded); err != nil {
+				t.Errorf("Validate(%q) error = %v", encoded, err)
+			}
+		})
+	}
+}
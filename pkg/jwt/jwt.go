@@ -24,32 +24,87 @@ const (
 
 // Claims represents the JWT claims
 type Claims struct {
-	UserID   uint      `json:"user_id"`
-	Username string    `json:"username"`
-	TokenID  string    `json:"token_id"` // for blacklist
-	Type     TokenType `json:"type"`
+	UserID    uint      `json:"user_id"`
+	Username  string    `json:"username"`
+	TokenID   string    `json:"token_id"` // for blacklist
+	Type      TokenType `json:"type"`
+	ClientID  string    `json:"client_id,omitempty"` // OAuth client the token was issued to
+	Scope     string    `json:"scope,omitempty"`     // space-separated OAuth scopes
+	RefreshID string    `json:"rid,omitempty"`       // refresh token issued together with an access token
+	FamilyID  string    `json:"fid,omitempty"`       // refresh token family (one per grant, kept across rotations)
+	Roles     []string  `json:"roles,omitempty"`     // RBAC roles of the user
 	jwt.RegisteredClaims
 }
 
+// IsClientToken reports whether the token was issued to a client acting on its own behalf
+// (client credentials grant) rather than to a user
+func (c *Claims) IsClientToken() bool {
+	return c.UserID == 0 && c.ClientID != ""
+}
+
+// TokenOptions carries optional claims for generated tokens
+type TokenOptions struct {
+	ClientID string
+	Scope    string
+	FamilyID string // refresh token family to continue; a new family is started when empty
+	Roles    []string
+}
+
 // TokenPair contains both access and refresh tokens
 type TokenPair struct {
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
 	ExpiresIn    int64  `json:"expires_in"`
+
+	FamilyID       string `json:"-"`
+	RefreshTokenID string `json:"-"`
 }
 
 // GenerateTokenPair generates both access and refresh tokens
 func GenerateTokenPair(userID uint, username string) (*TokenPair, error) {
+	return GenerateTokenPairWithOptions(userID, username, nil)
+}
+
+// GenerateTokenPairWithOptions generates both access and refresh tokens carrying the optional claims
+func GenerateTokenPairWithOptions(userID uint, username string, opts *TokenOptions) (*TokenPair, error) {
 	cfg := config.GlobalConfig.JWT
+	if opts == nil {
+		opts = &TokenOptions{}
+	}
+
+	// The access token remembers its refresh token, so revoking the refresh token revokes both
+	refreshID := uuid.New().String()
+	familyID := opts.FamilyID
+	if familyID == "" {
+		familyID = uuid.New().String()
+	}
 
 	// Generate access token
-	accessToken, err := generateToken(userID, username, AccessToken, cfg.AccessTokenDuration())
+	accessToken, err := generateToken(&Claims{
+		UserID:    userID,
+		Username:  username,
+		TokenID:   uuid.New().String(),
+		Type:      AccessToken,
+		ClientID:  opts.ClientID,
+		Scope:     opts.Scope,
+		RefreshID: refreshID,
+		FamilyID:  familyID,
+		Roles:     opts.Roles,
+	}, cfg.AccessTokenDuration())
 	if err != nil {
 		return nil, err
 	}
 
 	// Generate refresh token
-	refreshToken, err := generateToken(userID, username, RefreshToken, cfg.RefreshTokenDuration())
+	refreshToken, err := generateToken(&Claims{
+		UserID:   userID,
+		Username: username,
+		TokenID:  refreshID,
+		Type:     RefreshToken,
+		ClientID: opts.ClientID,
+		Scope:    opts.Scope,
+		FamilyID: familyID,
+	}, cfg.RefreshTokenDuration())
 	if err != nil {
 		return nil, err
 	}
@@ -58,24 +113,46 @@ func GenerateTokenPair(userID uint, username string) (*TokenPair, error) {
 		AccessToken:  accessToken,
 		RefreshToken: refreshToken,
 		ExpiresIn:    int64(cfg.AccessTokenExpire),
+
+		FamilyID:       familyID,
+		RefreshTokenID: refreshID,
 	}, nil
 }
 
-// generateToken creates a single JWT token
-func generateToken(userID uint, username string, tokenType TokenType, duration time.Duration) (string, error) {
+// GenerateClientToken generates an access token for a client acting on its own behalf.
+// No refresh token is issued: the client can always authenticate again.
+func GenerateClientToken(clientID, scope string) (*TokenPair, error) {
 	cfg := config.GlobalConfig.JWT
 
-	claims := &Claims{
-		UserID:   userID,
-		Username: username,
+	accessToken, err := generateToken(&Claims{
 		TokenID:  uuid.New().String(),
-		Type:     tokenType,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(duration)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
-			Issuer:    cfg.Issuer,
-		},
+		Type:     AccessToken,
+		ClientID: clientID,
+		Scope:    scope,
+	}, cfg.AccessTokenDuration())
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken: accessToken,
+		ExpiresIn:   int64(cfg.AccessTokenExpire),
+	}, nil
+}
+
+// generateToken signs a single JWT token valid for the duration
+func generateToken(claims *Claims, duration time.Duration) (string, error) {
+	cfg := config.GlobalConfig.JWT
+
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(duration)),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		NotBefore: jwt.NewNumericDate(time.Now()),
+		Issuer:    cfg.Issuer,
+	}
+
+	if !UsesHMAC() {
+		return signWithKeyManager(claims)
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -87,10 +164,16 @@ func ParseToken(tokenString string) (*Claims, error) {
 	cfg := config.GlobalConfig.JWT
 
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+			if !UsesHMAC() {
+				return nil, ErrInvalidToken
+			}
+			return []byte(cfg.Secret), nil
+		}
+		if UsesHMAC() {
 			return nil, ErrInvalidToken
 		}
-		return []byte(cfg.Secret), nil
+		return verificationKey(token)
 	})
 
 	if err != nil {
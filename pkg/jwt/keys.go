@@ -0,0 +1,450 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/joshleeeeee/go-lite-auth/internal/config"
+)
+
+var (
+	ErrSigningKeyNotLoaded = errors.New("signing key not loaded")
+	ErrUnsupportedKey      = errors.New("unsupported key type")
+	ErrUnknownKeyID        = errors.New("unknown key ID")
+)
+
+// Signing algorithms
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgEdDSA = "EdDSA"
+)
+
+// Generated RSA keys are 2048 bits
+const rsaKeyBits = 2048
+
+// Key is an asymmetric signing key identified by its key ID (kid)
+type Key struct {
+	ID        string
+	Method    jwt.SigningMethod
+	Private   crypto.Signer // nil for keys that are only trusted for verification
+	Public    crypto.PublicKey
+	ExpiresAt time.Time // zero while the key may verify tokens indefinitely
+}
+
+// KeyManager provides the keys tokens are signed and verified with.
+// Implementations must be safe for concurrent use.
+type KeyManager interface {
+	// SigningKey returns the active key new tokens are signed with
+	SigningKey() (*Key, error)
+	// VerificationKey returns the key with the given ID if it may still verify tokens
+	VerificationKey(kid string) (*Key, error)
+	// VerificationKeys returns every key that may still verify tokens, active key first
+	VerificationKeys() []*Key
+}
+
+var (
+	keyManagerMu sync.RWMutex
+	keyManager   KeyManager
+)
+
+// SetKeyManager replaces the key manager, e.g. with one backed by a KMS
+func SetKeyManager(km KeyManager) {
+	keyManagerMu.Lock()
+	defer keyManagerMu.Unlock()
+	keyManager = km
+}
+
+// GetKeyManager returns the current key manager
+func GetKeyManager() KeyManager {
+	keyManagerMu.RLock()
+	defer keyManagerMu.RUnlock()
+	return keyManager
+}
+
+// LocalKeyManager keeps keys in memory. Rotating retires the active key, which keeps
+// verifying tokens until every token it could have signed has expired.
+type LocalKeyManager struct {
+	mu        sync.RWMutex
+	active    *Key
+	retired   []*Key
+	retention time.Duration
+}
+
+// NewLocalKeyManager creates a key manager with an active key and additional verification keys.
+// Retention is how long a key keeps verifying tokens after it is rotated out.
+func NewLocalKeyManager(active *Key, retention time.Duration, verification ...*Key) *LocalKeyManager {
+	return &LocalKeyManager{
+		active:    active,
+		retired:   verification,
+		retention: retention,
+	}
+}
+
+// SigningKey returns the active key
+func (m *LocalKeyManager) SigningKey() (*Key, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.active == nil || m.active.Private == nil {
+		return nil, ErrSigningKeyNotLoaded
+	}
+	return m.active, nil
+}
+
+// VerificationKey returns the active or an unexpired retired key by ID
+func (m *LocalKeyManager) VerificationKey(kid string) (*Key, error) {
+	for _, key := range m.VerificationKeys() {
+		if key.ID == kid {
+			return key, nil
+		}
+	}
+	return nil, ErrUnknownKeyID
+}
+
+// VerificationKeys returns the active key followed by the unexpired retired keys
+func (m *LocalKeyManager) VerificationKeys() []*Key {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	keys := make([]*Key, 0, len(m.retired)+1)
+	if m.active != nil {
+		keys = append(keys, m.active)
+	}
+	for _, key := range m.retired {
+		if key.ExpiresAt.IsZero() || now.Before(key.ExpiresAt) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Rotate makes the key the active signing key and retires the previous one
+func (m *LocalKeyManager) Rotate(key *Key) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	retired := make([]*Key, 0, len(m.retired)+1)
+	if m.active != nil {
+		previous := *m.active
+		previous.ExpiresAt = now.Add(m.retention)
+		retired = append(retired, &previous)
+	}
+	// Drop keys whose tokens have all expired
+	for _, k := range m.retired {
+		if k.ExpiresAt.IsZero() || now.Before(k.ExpiresAt) {
+			retired = append(retired, k)
+		}
+	}
+
+	m.active = key
+	m.retired = retired
+}
+
+// StartRotation generates and activates a new key of the same algorithm at every interval
+func (m *LocalKeyManager) StartRotation(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			current, err := m.SigningKey()
+			if err != nil {
+				continue
+			}
+			key, err := GenerateKey(current.Method.Alg())
+			if err != nil {
+				log.Printf("JWT: failed to generate rotated key: %v", err)
+				continue
+			}
+			m.Rotate(key)
+			log.Printf("JWT: rotated signing key, new kid %s", key.ID)
+		}
+	}()
+}
+
+// InitKeys sets up the default key manager from the JWT configuration. With HS256 access tokens
+// stay HMAC-signed and the key manager only signs ID tokens, using RS256.
+func InitKeys(cfg *config.JWTConfig) error {
+	alg := cfg.Algorithm
+	if alg == "" || alg == AlgHS256 {
+		alg = AlgRS256
+	}
+
+	var (
+		active *Key
+		err    error
+	)
+	if cfg.SigningKeyFile != "" {
+		active, err = LoadKeyFile(cfg.SigningKeyFile)
+	} else {
+		active, err = GenerateKey(alg)
+	}
+	if err != nil {
+		return err
+	}
+	if active.Private == nil {
+		return fmt.Errorf("signing key %s has no private key", cfg.SigningKeyFile)
+	}
+	if alg == cfg.Algorithm && active.Method.Alg() != alg {
+		return fmt.Errorf("signing key %s is a %s key, but jwt.algorithm is %s", cfg.SigningKeyFile, active.Method.Alg(), alg)
+	}
+
+	verification := make([]*Key, 0, len(cfg.VerificationKeyFiles))
+	for _, path := range cfg.VerificationKeyFiles {
+		key, err := LoadKeyFile(path)
+		if err != nil {
+			return err
+		}
+		verification = append(verification, key)
+	}
+
+	km := NewLocalKeyManager(active, maxTokenLifetime(), verification...)
+	if cfg.KeyRotationInterval > 0 {
+		km.StartRotation(cfg.KeyRotationDuration())
+	}
+
+	SetKeyManager(km)
+	warnProcessLocalKeys(cfg, alg)
+	return nil
+}
+
+// warnProcessLocalKeys explains which tokens are signed with keys that only exist in this process
+func warnProcessLocalKeys(cfg *config.JWTConfig, alg string) {
+	if cfg.SigningKeyFile != "" && cfg.KeyRotationInterval <= 0 {
+		return
+	}
+
+	tokens := "ID tokens and access tokens"
+	if cfg.Algorithm == "" || cfg.Algorithm == AlgHS256 {
+		tokens = "ID tokens (access tokens are signed with jwt.secret)"
+	}
+	if cfg.SigningKeyFile == "" {
+		log.Printf("JWT: no signing key file configured, generated an ephemeral %s key for %s", alg, tokens)
+	} else {
+		log.Printf("JWT: rotating the signing key of %s in this process", tokens)
+	}
+	log.Println("JWT: generated keys are per process: their tokens become invalid after a restart and are rejected by other replicas")
+}
+
+// UsesHMAC reports whether access and refresh tokens are signed with the shared secret
+func UsesHMAC() bool {
+	alg := config.GlobalConfig.JWT.Algorithm
+	return alg == "" || alg == AlgHS256
+}
+
+// signWithKeyManager signs claims with the active key and names it in the kid header
+func signWithKeyManager(claims jwt.Claims) (string, error) {
+	km := GetKeyManager()
+	if km == nil {
+		return "", ErrSigningKeyNotLoaded
+	}
+	key, err := km.SigningKey()
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Private)
+}
+
+// verificationKey resolves the public key for a token from its kid header
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	km := GetKeyManager()
+	if km == nil {
+		return nil, ErrSigningKeyNotLoaded
+	}
+	kid, _ := token.Header["kid"].(string)
+	key, err := km.VerificationKey(kid)
+	if err != nil {
+		return nil, err
+	}
+	// The token must use the algorithm of its key, never one the token chooses
+	if key.Method.Alg() != token.Method.Alg() {
+		return nil, ErrInvalidToken
+	}
+	return key.Public, nil
+}
+
+// GenerateKey generates a new key for the signing algorithm
+func GenerateKey(alg string) (*Key, error) {
+	var (
+		private crypto.Signer
+		err     error
+	)
+	switch alg {
+	case AlgRS256:
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case AlgES256:
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewKey(private.Public(), private)
+}
+
+// LoadKeyFile reads a PEM encoded private key (PKCS#1, PKCS#8 or SEC 1) or public key (PKIX)
+func LoadKeyFile(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("key file %s is not PEM encoded", path)
+	}
+
+	switch block.Type {
+	case "PUBLIC KEY":
+		public, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		return NewKey(public, nil)
+	case "RSA PRIVATE KEY":
+		private, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		return NewKey(private.Public(), private)
+	case "EC PRIVATE KEY":
+		private, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		return NewKey(private.Public(), private)
+	default:
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		private, ok := parsed.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("%s: %w", path, ErrUnsupportedKey)
+		}
+		return NewKey(private.Public(), private)
+	}
+}
+
+// NewKey wraps a key pair, deriving its signing method and its RFC 7638 thumbprint as key ID
+func NewKey(public crypto.PublicKey, private crypto.Signer) (*Key, error) {
+	var method jwt.SigningMethod
+	switch pub := public.(type) {
+	case *rsa.PublicKey:
+		method = jwt.SigningMethodRS256
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256():
+			method = jwt.SigningMethodES256
+		case elliptic.P384():
+			method = jwt.SigningMethodES384
+		case elliptic.P521():
+			method = jwt.SigningMethodES512
+		default:
+			return nil, ErrUnsupportedKey
+		}
+	case ed25519.PublicKey:
+		method = jwt.SigningMethodEdDSA
+	default:
+		return nil, ErrUnsupportedKey
+	}
+
+	key := &Key{Method: method, Private: private, Public: public}
+	key.ID = thumbprint(key.JWK())
+	return key, nil
+}
+
+// JWK returns the public key in JSON Web Key format (RFC 7517)
+func (k *Key) JWK() JSONWebKey {
+	jwk := JSONWebKey{
+		Use: "sig",
+		Alg: k.Method.Alg(),
+		Kid: k.ID,
+	}
+
+	switch pub := k.Public.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = pub.Curve.Params().Name
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, size)))
+		jwk.Y = base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	}
+	return jwk
+}
+
+// thumbprint computes the RFC 7638 JWK thumbprint from the required members in lexicographic order
+func thumbprint(jwk JSONWebKey) string {
+	var members interface{}
+	switch jwk.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{jwk.Crv, jwk.Kty, jwk.X, jwk.Y}
+	default:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	}
+
+	data, _ := json.Marshal(members)
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// maxTokenLifetime is how long a rotated key must keep verifying tokens it signed
+func maxTokenLifetime() time.Duration {
+	cfg := config.GlobalConfig
+	lifetime := cfg.JWT.RefreshTokenDuration()
+	if d := cfg.JWT.AccessTokenDuration(); d > lifetime {
+		lifetime = d
+	}
+	if d := cfg.OIDC.IDTokenDuration(); d > lifetime {
+		lifetime = d
+	}
+	return lifetime
+}
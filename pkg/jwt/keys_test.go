@@ -0,0 +1,312 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/joshleeeeee/go-lite-auth/internal/config"
+)
+
+// setupKeys configures the signing algorithm and installs a key manager with a generated key
+func setupKeys(t *testing.T, alg string) {
+	t.Helper()
+
+	config.GlobalConfig = &config.Config{
+		JWT: config.JWTConfig{
+			Secret:             "test-secret",
+			AccessTokenExpire:  600,
+			RefreshTokenExpire: 3600,
+			Issuer:             "lite-auth",
+			Algorithm:          alg,
+		},
+		OIDC: config.OIDCConfig{Issuer: "http://localhost:8080", IDTokenExpire: 600},
+	}
+	if err := InitKeys(&config.GlobalConfig.JWT); err != nil {
+		t.Fatalf("InitKeys() error = %v", err)
+	}
+	t.Cleanup(func() { SetKeyManager(nil) })
+}
+
+// tokenHeader returns the header of a token without verifying it
+func tokenHeader(t *testing.T, tokenString string) map[string]interface{} {
+	t.Helper()
+
+	token, _, err := jwt.NewParser().ParseUnverified(tokenString, &Claims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token.Header
+}
+
+func testKey(t *testing.T, alg string) *Key {
+	t.Helper()
+
+	key, err := GenerateKey(alg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestSignAndParse(t *testing.T) {
+	for _, alg := range []string{AlgHS256, AlgRS256, AlgES256, AlgEdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			setupKeys(t, alg)
+
+			pair, err := GenerateTokenPairWithOptions(1, "alice", &TokenOptions{ClientID: "client-a", Scope: "openid"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			header := tokenHeader(t, pair.AccessToken)
+			if header["alg"] != alg {
+				t.Errorf("alg = %v, want %s", header["alg"], alg)
+			}
+			if alg != AlgHS256 {
+				active, _ := GetKeyManager().SigningKey()
+				if header["kid"] != active.ID {
+					t.Errorf("kid = %v, want the active key %s", header["kid"], active.ID)
+				}
+			}
+
+			for _, token := range []string{pair.AccessToken, pair.RefreshToken} {
+				claims, err := ParseToken(token)
+				if err != nil {
+					t.Fatalf("ParseToken() error = %v", err)
+				}
+				if claims.UserID != 1 || claims.ClientID != "client-a" || claims.FamilyID != pair.FamilyID {
+					t.Errorf("ParseToken() = %+v", claims)
+				}
+			}
+		})
+	}
+}
+
+func TestRotationRetainsOldKeys(t *testing.T) {
+	for _, alg := range []string{AlgRS256, AlgES256, AlgEdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			setupKeys(t, alg)
+			old := testKey(t, alg)
+			km := NewLocalKeyManager(old, time.Hour)
+			SetKeyManager(km)
+
+			oldToken, err := GenerateTokenPair(1, "alice")
+			if err != nil {
+				t.Fatal(err)
+			}
+			next := testKey(t, alg)
+			km.Rotate(next)
+
+			newToken, err := GenerateTokenPair(1, "alice")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if kid := tokenHeader(t, newToken.AccessToken)["kid"]; kid != next.ID {
+				t.Errorf("kid after rotation = %v, want %s", kid, next.ID)
+			}
+			if _, err := ParseToken(oldToken.AccessToken); err != nil {
+				t.Errorf("ParseToken() of a token of the rotated-out key error = %v", err)
+			}
+			if len(JWKS().Keys) != 2 {
+				t.Errorf("JWKS() has %d keys, want the active and the retained key", len(JWKS().Keys))
+			}
+
+			// Once the retention has passed, the old key neither verifies nor is published
+			km.mu.Lock()
+			km.retired[0].ExpiresAt = time.Now().Add(-time.Second)
+			km.mu.Unlock()
+			if _, err := ParseToken(oldToken.AccessToken); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("ParseToken() after the retention error = %v, want ErrInvalidToken", err)
+			}
+			if _, err := km.VerificationKey(old.ID); !errors.Is(err, ErrUnknownKeyID) {
+				t.Errorf("VerificationKey() of the expired key error = %v, want ErrUnknownKeyID", err)
+			}
+			if len(JWKS().Keys) != 1 {
+				t.Errorf("JWKS() has %d keys, want only the active key", len(JWKS().Keys))
+			}
+
+			// The next rotation drops it
+			km.Rotate(testKey(t, alg))
+			if len(km.retired) != 1 || km.retired[0].ID != next.ID {
+				t.Errorf("retired keys after the next rotation = %d, want only the previous key", len(km.retired))
+			}
+			if _, err := ParseToken(newToken.AccessToken); err != nil {
+				t.Errorf("ParseToken() of a token of the previous key error = %v", err)
+			}
+		})
+	}
+}
+
+func TestParseTokenRejectsOtherAlgorithms(t *testing.T) {
+	setupKeys(t, AlgES256)
+	ecKey := testKey(t, AlgES256)
+	rsaKey := testKey(t, AlgRS256)
+	SetKeyManager(NewLocalKeyManager(ecKey, time.Hour, rsaKey))
+
+	claims := func() *Claims {
+		now := time.Now()
+		return &Claims{UserID: 1, Username: "alice", TokenID: "token-id", Type: AccessToken,
+			RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)), IssuedAt: jwt.NewNumericDate(now)}}
+	}
+	sign := func(method jwt.SigningMethod, kid string, key interface{}) string {
+		token := jwt.NewWithClaims(method, claims())
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	rsaPublic, err := x509.MarshalPKIXPublicKey(rsaKey.Public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"signed by the active key", sign(jwt.SigningMethodES256, ecKey.ID, ecKey.Private), false},
+		{"signed by a verification key", sign(jwt.SigningMethodRS256, rsaKey.ID, rsaKey.Private), false},
+		{"RS256 under the kid of an ES256 key", sign(jwt.SigningMethodRS256, ecKey.ID, rsaKey.Private), true},
+		{"ES384 under the kid of an ES256 key", sign(jwt.SigningMethodES384, ecKey.ID, p384Key), true},
+		{"HS256 with the shared secret", sign(jwt.SigningMethodHS256, "", []byte("test-secret")), true},
+		{"HS256 keyed with a public key", sign(jwt.SigningMethodHS256, rsaKey.ID, rsaPublic), true},
+		{"unknown kid", sign(jwt.SigningMethodES256, "unknown", ecKey.Private), true},
+		{"no kid", sign(jwt.SigningMethodES256, "", ecKey.Private), true},
+		{"alg none", sign(jwt.SigningMethodNone, ecKey.ID, jwt.UnsafeAllowNoneSignatureType), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseToken(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadKeyFile(t *testing.T) {
+	rsaKey := testKey(t, AlgRS256)
+	ecKey := testKey(t, AlgES256)
+	edKey := testKey(t, AlgEdDSA)
+
+	pkcs8 := func(key *Key) []byte {
+		der, err := x509.MarshalPKCS8PrivateKey(key.Private)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return der
+	}
+	pkix := func(key *Key) []byte {
+		der, err := x509.MarshalPKIXPublicKey(key.Public)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return der
+	}
+	sec1, err := x509.MarshalECPrivateKey(ecKey.Private.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		blockType  string
+		der        []byte
+		want       *Key
+		wantSigner bool
+	}{
+		{"RSA PKCS#1", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey.Private.(*rsa.PrivateKey)), rsaKey, true},
+		{"RSA PKCS#8", "PRIVATE KEY", pkcs8(rsaKey), rsaKey, true},
+		{"RSA public", "PUBLIC KEY", pkix(rsaKey), rsaKey, false},
+		{"EC SEC 1", "EC PRIVATE KEY", sec1, ecKey, true},
+		{"EC PKCS#8", "PRIVATE KEY", pkcs8(ecKey), ecKey, true},
+		{"Ed25519 PKCS#8", "PRIVATE KEY", pkcs8(edKey), edKey, true},
+		{"Ed25519 public", "PUBLIC KEY", pkix(edKey), edKey, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "key.pem")
+			if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: tt.blockType, Bytes: tt.der}), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			key, err := LoadKeyFile(path)
+			if err != nil {
+				t.Fatalf("LoadKeyFile() error = %v", err)
+			}
+			if key.ID != tt.want.ID || key.Method != tt.want.Method || (key.Private != nil) != tt.wantSigner {
+				t.Errorf("LoadKeyFile() = kid %s %s signer %v, want kid %s %s signer %v",
+					key.ID, key.Method.Alg(), key.Private != nil, tt.want.ID, tt.want.Method.Alg(), tt.wantSigner)
+			}
+		})
+	}
+
+	t.Run("not PEM", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "key.pem")
+		if err := os.WriteFile(path, []byte("not a key"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadKeyFile(path); err == nil {
+			t.Error("LoadKeyFile() of a file without PEM block succeeded")
+		}
+	})
+}
+
+func TestInitKeysChecksKeyAlgorithm(t *testing.T) {
+	_, edPrivate, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(edPrivate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "ed25519.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		algorithm string
+		wantErr   bool
+	}{
+		{AlgEdDSA, false},
+		{AlgRS256, true},
+		{AlgES256, true},
+		{AlgHS256, false}, // the key only signs ID tokens
+	}
+	for _, tt := range tests {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			setupKeys(t, tt.algorithm)
+			cfg := config.GlobalConfig.JWT
+			cfg.SigningKeyFile = path
+			err := InitKeys(&cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("InitKeys() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "jwt.algorithm") {
+				t.Errorf("InitKeys() error = %v, want it to name jwt.algorithm", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package jwt
+
+import (
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/joshleeeeee/go-lite-auth/internal/config"
+)
+
+// IDTokenClaims represents the claims of an OpenID Connect ID token
+type IDTokenClaims struct {
+	Nonce    string   `json:"nonce,omitempty"`
+	AuthTime int64    `json:"auth_time,omitempty"`
+	ACR      string   `json:"acr,omitempty"`
+	AMR      []string `json:"amr,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// JSONWebKey is the public part of a signing key (RFC 7517)
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JSONWebKeySet is the document served at the JWKS endpoint
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// GenerateIDToken issues an ID token about the subject for the audience (client_id), signed with the active key
+func GenerateIDToken(subject, audience string, claims *IDTokenClaims) (string, error) {
+	cfg := config.GlobalConfig.OIDC
+	now := time.Now()
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		Issuer:    strings.TrimSuffix(cfg.Issuer, "/"),
+		Subject:   subject,
+		Audience:  jwt.ClaimStrings{audience},
+		ExpiresAt: jwt.NewNumericDate(now.Add(cfg.IDTokenDuration())),
+		IssuedAt:  jwt.NewNumericDate(now),
+	}
+
+	return signWithKeyManager(claims)
+}
+
+// JWKS returns the public keys that verify tokens, including rotated keys whose tokens may still be valid
+func JWKS() *JSONWebKeySet {
+	set := &JSONWebKeySet{Keys: []JSONWebKey{}}
+	if km := GetKeyManager(); km != nil {
+		for _, key := range km.VerificationKeys() {
+			set.Keys = append(set.Keys, key.JWK())
+		}
+	}
+	return set
+}
+
+// IDTokenSigningAlgorithms returns the algorithms ID tokens may be signed with
+func IDTokenSigningAlgorithms() []string {
+	if km := GetKeyManager(); km != nil {
+		if key, err := km.SigningKey(); err == nil {
+			return []string{key.Method.Alg()}
+		}
+	}
+	return []string{AlgRS256}
+}
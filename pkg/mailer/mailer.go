@@ -0,0 +1,218 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joshleeeeee/go-lite-auth/internal/config"
+)
+
+var (
+	ErrMailerNotInitialized = errors.New("mailer not initialized")
+	ErrUnknownDriver        = errors.New("unknown mail driver")
+)
+
+// Mail drivers
+const (
+	DriverSMTP = "smtp"
+	DriverLog  = "log"
+)
+
+// Message is an email with a plain text body and an optional HTML alternative
+type Message struct {
+	From    string
+	To      []string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer delivers email messages
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+var (
+	mu      sync.RWMutex
+	current Mailer
+	from    string
+)
+
+// Init creates the configured mailer and loads the email templates
+func Init(cfg *config.MailConfig) error {
+	var m Mailer
+	switch cfg.Driver {
+	case DriverSMTP:
+		m = NewSMTPMailer(&cfg.SMTP)
+	case DriverLog, "":
+		m = NewLogMailer(cfg.LogDir)
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownDriver, cfg.Driver)
+	}
+
+	if err := LoadTemplates(cfg.TemplateDir); err != nil {
+		return err
+	}
+
+	SetMailer(m, cfg.From)
+	return nil
+}
+
+// SetMailer replaces the mailer used by Send, e.g. to capture messages in tests
+func SetMailer(m Mailer, sender string) {
+	mu.Lock()
+	defer mu.Unlock()
+	current = m
+	from = sender
+}
+
+// Send renders a template and delivers it to a single recipient with the configured mailer
+func Send(ctx context.Context, to, template string, data interface{}) error {
+	mu.RLock()
+	m, sender := current, from
+	mu.RUnlock()
+	if m == nil {
+		return ErrMailerNotInitialized
+	}
+
+	msg, err := Render(template, data)
+	if err != nil {
+		return err
+	}
+	msg.From = sender
+	msg.To = []string{to}
+	return m.Send(ctx, msg)
+}
+
+// SMTPMailer delivers messages through an SMTP server, using STARTTLS when offered
+type SMTPMailer struct {
+	addr string
+	auth smtp.Auth
+}
+
+// NewSMTPMailer creates an SMTPMailer; authentication is skipped when no username is configured
+func NewSMTPMailer(cfg *config.SMTPConfig) *SMTPMailer {
+	m := &SMTPMailer{addr: cfg.Addr()}
+	if cfg.Username != "" {
+		m.auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+	return m
+}
+
+// Send delivers a message
+func (m *SMTPMailer) Send(ctx context.Context, msg *Message) error {
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+	if err := smtp.SendMail(m.addr, m.auth, envelopeAddress(msg.From), msg.To, data); err != nil {
+		return fmt.Errorf("failed to send mail: %w", err)
+	}
+	return nil
+}
+
+// LogMailer writes messages to the server log, or to .eml files in a directory when one is set.
+// It lets the email flows be used in development and tests without a mail server.
+type LogMailer struct {
+	dir string
+}
+
+// NewLogMailer creates a LogMailer
+func NewLogMailer(dir string) *LogMailer {
+	return &LogMailer{dir: dir}
+}
+
+// Send logs or saves a message
+func (m *LogMailer) Send(ctx context.Context, msg *Message) error {
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	if m.dir == "" {
+		log.Printf("Mail: to %s\n%s", strings.Join(msg.To, ", "), data)
+		return nil
+	}
+
+	if err := os.MkdirAll(m.dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create mail directory: %w", err)
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), randomHex(4))
+	path := filepath.Join(m.dir, name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write mail: %w", err)
+	}
+	log.Printf("Mail: to %s saved to %s", strings.Join(msg.To, ", "), path)
+	return nil
+}
+
+// Bytes encodes the message in MIME format, as multipart/alternative when it has an HTML body
+func (msg *Message) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", msg.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(msg.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+
+	if msg.HTML == "" {
+		buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+		buf.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+		buf.WriteString(msg.Text)
+		return buf.Bytes(), nil
+	}
+
+	w := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", w.Boundary())
+	parts := []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	}
+	for _, part := range parts {
+		pw, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"8bit"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := pw.Write([]byte(part.body)); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// envelopeAddress extracts the bare address from a "Name <address>" sender
+func envelopeAddress(sender string) string {
+	if start := strings.LastIndex(sender, "<"); start >= 0 {
+		if end := strings.LastIndex(sender, ">"); end > start {
+			return sender[start+1 : end]
+		}
+	}
+	return sender
+}
+
+// randomHex returns n random bytes as hex, used to keep saved file names unique
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
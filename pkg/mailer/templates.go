@@ -0,0 +1,124 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+)
+
+// Email templates
+const (
+	TemplatePasswordReset     = "password_reset"
+	TemplateEmailVerification = "email_verification"
+	TemplateMagicLink         = "magic_link"
+	TemplateEmailOTP          = "email_otp"
+)
+
+var ErrUnknownTemplate = errors.New("unknown email template")
+
+// Each template file <name>.tmpl defines the "subject", "text" and optionally "html" blocks.
+// The HTML block is parsed with html/template so that data is escaped.
+//
+//go:embed templates/*.tmpl
+var builtinTemplates embed.FS
+
+type emailTemplate struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+var (
+	templatesMu sync.RWMutex
+	templates   map[string]*emailTemplate
+)
+
+// LoadTemplates parses the built-in templates, then the templates of dir (when not empty),
+// which replace the built-in templates of the same name
+func LoadTemplates(dir string) error {
+	loaded := make(map[string]*emailTemplate)
+	sub, err := fs.Sub(builtinTemplates, "templates")
+	if err != nil {
+		return err
+	}
+	if err := parseTemplates(sub, loaded); err != nil {
+		return err
+	}
+	if dir != "" {
+		if err := parseTemplates(os.DirFS(dir), loaded); err != nil {
+			return err
+		}
+	}
+
+	templatesMu.Lock()
+	templates = loaded
+	templatesMu.Unlock()
+	return nil
+}
+
+// Render executes a template into a message without sender or recipients
+func Render(name string, data interface{}) (*Message, error) {
+	templatesMu.RLock()
+	if templates == nil {
+		templatesMu.RUnlock()
+		if err := LoadTemplates(""); err != nil {
+			return nil, err
+		}
+		templatesMu.RLock()
+	}
+	tmpl, ok := templates[name]
+	templatesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownTemplate, name)
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := tmpl.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, fmt.Errorf("failed to render %s subject: %w", name, err)
+	}
+	if err := tmpl.text.ExecuteTemplate(&text, "text", data); err != nil {
+		return nil, fmt.Errorf("failed to render %s text: %w", name, err)
+	}
+	if tmpl.html.Lookup("html") != nil {
+		if err := tmpl.html.ExecuteTemplate(&html, "html", data); err != nil {
+			return nil, fmt.Errorf("failed to render %s html: %w", name, err)
+		}
+	}
+
+	return &Message{
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    strings.TrimSpace(text.String()) + "\n",
+		HTML:    strings.TrimSpace(html.String()),
+	}, nil
+}
+
+// parseTemplates parses every <name>.tmpl file of fsys into templates
+func parseTemplates(fsys fs.FS, templates map[string]*emailTemplate) error {
+	files, err := fs.Glob(fsys, "*.tmpl")
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		name := strings.TrimSuffix(file, ".tmpl")
+		text, err := texttemplate.ParseFS(fsys, file)
+		if err != nil {
+			return fmt.Errorf("failed to parse email template %s: %w", file, err)
+		}
+		html, err := htmltemplate.ParseFS(fsys, file)
+		if err != nil {
+			return fmt.Errorf("failed to parse email template %s: %w", file, err)
+		}
+		if text.Lookup("subject") == nil || text.Lookup("text") == nil {
+			return fmt.Errorf("email template %s must define subject and text", file)
+		}
+		templates[name] = &emailTemplate{text: text, html: html}
+	}
+	return nil
+}
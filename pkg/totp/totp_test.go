@@ -0,0 +1,72 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// Secret of the RFC 6238 SHA-1 test vectors, "12345678901234567890" in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	// RFC 6238 appendix B, truncated to 6 digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Counter(time.Unix(tt.unix, 0)))
+		if err != nil || got != tt.want {
+			t.Errorf("Code() at %d = %q, %v, want %q", tt.unix, got, err, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	counter := Counter(now)
+	code := func(step int64) string {
+		c, err := Code(rfcSecret, uint64(int64(counter)+step))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name        string
+		secret      string
+		code        string
+		skew        int
+		wantCounter uint64
+		wantOK      bool
+	}{
+		{"current step", rfcSecret, code(0), 0, counter, true},
+		{"previous step within skew", rfcSecret, code(-1), 1, counter - 1, true},
+		{"next step within skew", rfcSecret, code(1), 1, counter + 1, true},
+		{"previous step without skew", rfcSecret, code(-1), 0, 0, false},
+		{"outside skew", rfcSecret, code(-2), 1, 0, false},
+		{"lowercase secret", "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", code(0), 0, counter, true},
+		{"wrong code", rfcSecret, "000000", 1, 0, false},
+		{"too short", rfcSecret, code(0)[:5], 1, 0, false},
+		{"too long", rfcSecret, code(0) + "0", 1, 0, false},
+		{"invalid secret", "not base32!", code(0), 1, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Validate(tt.secret, tt.code, now, tt.skew)
+			if ok != tt.wantOK || got != tt.wantCounter {
+				t.Errorf("Validate() = %d, %v, want %d, %v", got, ok, tt.wantCounter, tt.wantOK)
+			}
+		})
+	}
+}